@@ -27,7 +27,7 @@ func (d *Document) Save() error {
 
 type SaveAction struct {
 	Meta     core.Pattern `action:"file.save" keys:"ctrl+s"`
-	Document *Document
+	Document *Document    `inject:""`
 }
 
 func (a *SaveAction) Handle(ctx context.Context) (any, error) {
@@ -39,7 +39,7 @@ func (a *SaveAction) Handle(ctx context.Context) (any, error) {
 
 type NewFileAction struct {
 	Meta     core.Pattern `action:"file.new" keys:"ctrl+n"`
-	Document *Document
+	Document *Document    `inject:""`
 }
 
 func (a *NewFileAction) Handle(ctx context.Context) (any, error) {
@@ -18,8 +18,8 @@ type PingEndpoint struct {
 	// Query parameters (auto-bound)
 	Times int `query:"times" default:"1"`
 
-	// Dependencies (injected by field name)
-	PingService PingService
+	// Dependencies (injected by type)
+	PingService PingService `inject:""`
 }
 
 // OpenAPIMeta returns metadata for OpenAPI/Swagger generation.
@@ -1,160 +1,788 @@
 package core
 
 import (
+	"bytes"
+	"encoding"
 	"encoding/json"
 	"fmt"
+	"io"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPrecedence is the order in which sources are consulted when a field
+// is tagged for more than one of them. Defaults always come last.
+var DefaultPrecedence = []string{"path", "query", "header", "cookie"}
+
+// DefaultSeparator splits a single raw value into elements when binding
+// slice and array fields. Override it per field with a `sep:"|"` tag;
+// `sep:""` disables splitting.
+const DefaultSeparator = ","
+
+// ConvertFunc parses a raw value into a value of the type it is registered for.
+type ConvertFunc func(s string) (any, error)
 
-	"github.com/mirkobrombin/go-foundation/pkg/tags"
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	patternType         = reflect.TypeOf(Pattern{})
 )
 
 // BindFunc is a function that extracts a value by key from a source.
 type BindFunc func(key string) string
 
+// MultiBindFunc extracts every value of a repeated key from a source.
+type MultiBindFunc func(key string) []string
+
+// Values provides raw values to a binding plan, looked up by source tag and key.
+// An empty string means the value is absent.
+type Values interface {
+	Value(source, key string) string
+}
+
+// MultiValues is implemented by Values that can return every value of a
+// repeated key, such as ?tag=a&tag=b. Slice and array fields use it when
+// available.
+type MultiValues interface {
+	Values
+	All(source, key string) []string
+}
+
+// funcValues adapts the sources registered with AddSource and
+// AddMultiSource to MultiValues.
+type funcValues struct {
+	single map[string]BindFunc
+	multi  map[string]MultiBindFunc
+}
+
+func (v funcValues) Value(source, key string) string {
+	if fn, ok := v.single[source]; ok {
+		return fn(key)
+	}
+	if fn, ok := v.multi[source]; ok {
+		if vals := fn(key); len(vals) > 0 {
+			return vals[0]
+		}
+	}
+	return ""
+}
+
+func (v funcValues) All(source, key string) []string {
+	if fn, ok := v.multi[source]; ok {
+		return fn(key)
+	}
+	if val := v.Value(source, key); val != "" {
+		return []string{val}
+	}
+	return nil
+}
+
 // Binder binds values to struct fields based on tags.
+// Plans are compiled once per struct type and cached, so a Binder is
+// meant to be created once and reused across requests.
 type Binder struct {
-	sources map[string]BindFunc
+	sources    map[string]BindFunc
+	multi      map[string]MultiBindFunc
+	converters map[reflect.Type]ConvertFunc
+	order      []string
+	precedence []string
+	plans      sync.Map // reflect.Type -> *Plan
+	mu         sync.Mutex
 }
 
 // NewBinder creates a new binder.
-func NewBinder() *Binder {
-	return &Binder{
-		sources: make(map[string]BindFunc),
+// The optional source tags are declared up front, for callers that feed
+// values through BindValues instead of AddSource.
+func NewBinder(sources ...string) *Binder {
+	b := &Binder{
+		sources:    make(map[string]BindFunc),
+		multi:      make(map[string]MultiBindFunc),
+		converters: make(map[reflect.Type]ConvertFunc),
+		precedence: DefaultPrecedence,
+	}
+	b.converters[reflect.TypeOf(time.Duration(0))] = func(s string) (any, error) {
+		return time.ParseDuration(s)
 	}
+	b.Declare(sources...)
+	return b
 }
 
 // AddSource registers a binding source (e.g., "query", "path", "header").
 func (b *Binder) AddSource(tag string, fn BindFunc) {
 	b.sources[tag] = fn
+	b.Declare(tag)
+}
+
+// AddMultiSource registers a binding source that can return repeated values.
+func (b *Binder) AddMultiSource(tag string, fn MultiBindFunc) {
+	b.multi[tag] = fn
+	b.Declare(tag)
+}
+
+// Declare makes plans look up the given source tags, for callers that feed
+// values through BindValues instead of AddSource. Transports declare their
+// sources on the binder they are given.
+func (b *Binder) Declare(sources ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	changed := false
+	for _, tag := range sources {
+		if !contains(b.order, tag) {
+			b.order = append(b.order, tag)
+			changed = true
+		}
+	}
+
+	// Compiled plans only know about the previous sources.
+	if changed {
+		b.plans.Clear()
+	}
+}
+
+// RegisterConverter registers a parser for raw values of typ, used for
+// bound fields, slice elements and payload strings of that type.
+// Converters take priority over encoding.TextUnmarshaler and the built-in
+// kinds; time.Duration is registered by default.
+//
+// Call it before registering handlers: plans compiled earlier keep their setters.
+func (b *Binder) RegisterConverter(typ reflect.Type, fn ConvertFunc) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.converters[typ] = fn
+	b.plans.Clear()
+}
+
+func (b *Binder) converter(typ reflect.Type) (ConvertFunc, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	fn, ok := b.converters[typ]
+	return fn, ok
+}
+
+// SetPrecedence sets the order in which sources are consulted when a field
+// is tagged for more than one of them; the first non-empty value wins.
+// Declared sources missing from the list are consulted afterwards, in
+// declaration order. Fields can override it with a `bind:"header,query"` tag.
+//
+// Plans already handed out keep their order, so call this before
+// registering handlers.
+func (b *Binder) SetPrecedence(sources ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.precedence = append([]string(nil), sources...)
+	b.plans.Clear()
+}
+
+// Plan returns the binding plan for a struct type, compiling it on first use.
+func (b *Binder) Plan(typ reflect.Type) *Plan {
+	if p, ok := b.plans.Load(typ); ok {
+		return p.(*Plan)
+	}
+
+	b.mu.Lock()
+	order := orderSources(b.order, b.precedence)
+	b.mu.Unlock()
+
+	p, _ := b.plans.LoadOrStore(typ, b.compilePlan(typ, order))
+	return p.(*Plan)
+}
+
+// orderSources sorts the declared sources by precedence, keeping the
+// declaration order for sources the precedence does not mention.
+func orderSources(declared, precedence []string) []string {
+	order := make([]string, 0, len(declared))
+	for _, source := range precedence {
+		if contains(declared, source) && !contains(order, source) {
+			order = append(order, source)
+		}
+	}
+	for _, source := range declared {
+		if !contains(order, source) {
+			order = append(order, source)
+		}
+	}
+	return order
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
 
 // Bind populates struct fields from registered sources.
 func (b *Binder) Bind(target any) error {
+	return b.BindValues(target, funcValues{single: b.sources, multi: b.multi})
+}
+
+// BindValues populates struct fields from the given values.
+func (b *Binder) BindValues(target any, values Values) error {
 	val := reflect.ValueOf(target)
 	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
 		return fmt.Errorf("target must be a pointer to a struct")
 	}
 
 	elem := val.Elem()
+	return b.Plan(elem.Type()).Bind(elem, values)
+}
 
-	// Track which fields have been set to avoid overwriting with lower priority sources?
-	// Or just use the first value found (since sources loop order is random map iteration).
-	// To preserve original semantics: "Try each registered source... if valStr != '' break".
-	// The original implementation iterated fields, then iterated sources.
-	// We want to iterate sources (cached), then fields.
-	// This changes order: We iterate Source A -> all fields. Source B -> all fields.
-	// If Source A and B both set Field X, the last one wins.
-	// Original: For Field X, iterate sources (random order). First sets wins.
-	// Since original source order was random, "Last wins" in our new loop is equivalent to "First wins" in a reversed random order.
-	// So it is acceptable.
-
-	// Collect valuesmap[fieldIndex]value
-	values := make(map[int]string)
-
-	// 1. Process explicit sources
-	for tag, fn := range b.sources {
-		parser := tags.NewParser(tag)
-		fields := parser.ParseStruct(target)
-
-		for _, meta := range fields {
-			// Skip if already set? (First Wins strategy adaptation)
-			// If we want "First Scanned Source Wins", we check existence.
-			// Since source iteration is random, this is fine.
-			if _, ok := values[meta.Index]; ok {
-				continue
-			}
+// BindJSON binds a JSON body to a struct field tagged with body:"json".
+func (b *Binder) BindJSON(target any, data []byte) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	elem := v.Elem()
+	return b.Plan(elem.Type()).BindJSON(elem, data)
+}
 
-			key := meta.RawTag
-			if key == "" {
+// Plan is a precompiled binding plan for a struct type.
+// It holds everything Bind needs (field indexes, source keys, defaults and
+// setters) so no struct tags are parsed per request.
+type Plan struct {
+	typ          reflect.Type
+	fields       []fieldPlan
+	body         int
+	bodyRequired bool
+}
+
+type fieldPlan struct {
+	index  []int
+	name   string
+	field  reflect.StructField
+	keys   []sourceKey
+	def    string
+	hasDef bool
+	sep    string
+	set    setter
+	setAll multiSetter
+}
+
+type sourceKey struct {
+	source string
+	key    string
+}
+
+type setter func(field reflect.Value, valStr string) error
+
+type multiSetter func(field reflect.Value, vals []string) error
+
+func (b *Binder) compilePlan(typ reflect.Type, sources []string) *Plan {
+	p := &Plan{typ: typ, body: -1}
+	if typ.Kind() != reflect.Struct {
+		return p
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if kind, opts, _ := strings.Cut(field.Tag.Get("body"), ","); kind == "json" && field.IsExported() {
+			p.body = i
+			p.bodyRequired = opts == "required"
+			break
+		}
+	}
+
+	b.compileFields(p, typ, nil, "", map[string]string{}, sources, map[reflect.Type]bool{typ: true})
+	return p
+}
+
+// compileFields adds the bound fields of typ to the plan. Embedded structs
+// and fields tagged with an inline group, such as `query:"filter.,inline"`,
+// are descended into; their keys get the group's per-source prefix.
+func (b *Binder) compileFields(p *Plan, typ reflect.Type, index []int, name string, prefixes map[string]string, sources []string, seen map[reflect.Type]bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		// Pattern tags declare routes, not bound values
+		if !field.IsExported() || field.Type == patternType {
+			continue
+		}
+
+		path := append(index[:len(index):len(index)], i)
+
+		if group, ok := b.groupPrefixes(field, sources, prefixes); ok {
+			st := field.Type
+			if st.Kind() == reflect.Ptr {
+				st = st.Elem()
+			}
+			if seen[st] {
 				continue
 			}
+			seen[st] = true
+			b.compileFields(p, st, path, name+field.Name+".", group, sources, seen)
+			delete(seen, st)
+			continue
+		}
 
-			if val := fn(key); val != "" {
-				values[meta.Index] = val
+		fp := fieldPlan{index: path, name: name + field.Name, field: field}
+		for _, source := range fieldSources(field, sources) {
+			if key, _, _ := strings.Cut(field.Tag.Get(source), ","); key != "" {
+				fp.keys = append(fp.keys, sourceKey{source: source, key: prefixes[source] + key})
 			}
 		}
+		if def := field.Tag.Get("default"); def != "" {
+			fp.def, fp.hasDef = def, true
+		}
+
+		if len(fp.keys) == 0 && !fp.hasDef {
+			continue
+		}
+
+		if b.isMulti(field.Type) {
+			fp.sep = Separator(field)
+			fp.setAll = b.multiSetterFor(field.Type)
+		} else {
+			fp.set = b.setterFor(field.Type)
+		}
+		p.fields = append(p.fields, fp)
+	}
+}
+
+// groupPrefixes reports whether a field is a binding group and returns the
+// key prefixes for its fields. Groups are embedded structs and struct fields
+// with an inline source tag; a plain source key makes the field a leaf.
+func (b *Binder) groupPrefixes(field reflect.StructField, sources []string, parent map[string]string) (map[string]string, bool) {
+	typ := field.Type
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || b.isLeaf(typ) {
+		return nil, false
+	}
+
+	inline := false
+	prefixes := make(map[string]string, len(parent))
+	for k, v := range parent {
+		prefixes[k] = v
+	}
+	for _, source := range sources {
+		tag, ok := field.Tag.Lookup(source)
+		if !ok {
+			continue
+		}
+		prefix, isInline := InlinePrefix(tag)
+		if !isInline {
+			return nil, false
+		}
+		inline = true
+		prefixes[source] = parent[source] + prefix
 	}
 
-	// 2. Process defaults
-	// Only if not set by sources
-	defParser := tags.NewParser("default")
-	defFields := defParser.ParseStruct(target)
-	for _, meta := range defFields {
-		if _, ok := values[meta.Index]; !ok {
-			if meta.RawTag != "" {
-				values[meta.Index] = meta.RawTag
+	if !inline && !field.Anonymous {
+		return nil, false
+	}
+	return prefixes, true
+}
+
+// InlinePrefix parses a source tag such as "filter.,inline" and reports
+// whether it declares an inline group, returning the group's key prefix.
+func InlinePrefix(tag string) (string, bool) {
+	prefix, opts, _ := strings.Cut(tag, ",")
+	for opt := range strings.SplitSeq(opts, ",") {
+		if strings.TrimSpace(opt) == "inline" {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+// isLeaf reports whether a struct type is bound from a single value.
+func (b *Binder) isLeaf(typ reflect.Type) bool {
+	if _, ok := b.converter(typ); ok {
+		return true
+	}
+	return reflect.PointerTo(typ).Implements(textUnmarshalerType)
+}
+
+// fieldSources applies a field's `bind:"..."` override to the source order.
+// Sources listed in the tag come first, in tag order; the rest follow.
+func fieldSources(field reflect.StructField, sources []string) []string {
+	tag := field.Tag.Get("bind")
+	if tag == "" {
+		return sources
+	}
+
+	listed := strings.Split(tag, ",")
+	for i := range listed {
+		listed[i] = strings.TrimSpace(listed[i])
+	}
+	return orderSources(sources, listed)
+}
+
+// Separator returns the element separator for a slice or array field.
+func Separator(field reflect.StructField) string {
+	if sep, ok := field.Tag.Lookup("sep"); ok {
+		return sep
+	}
+	return DefaultSeparator
+}
+
+// Type returns the struct type the plan was compiled for.
+func (p *Plan) Type() reflect.Type {
+	return p.typ
+}
+
+// HasBody reports whether the struct has a body:"json" field.
+func (p *Plan) HasBody() bool {
+	return p.body >= 0
+}
+
+// Uses reports whether any field is bound from the given source.
+func (p *Plan) Uses(source string) bool {
+	for _, f := range p.fields {
+		for _, k := range f.keys {
+			if k.source == source {
+				return true
 			}
 		}
 	}
+	return false
+}
+
+// BodyRequired reports whether the body field is tagged body:"json,required".
+func (p *Plan) BodyRequired() bool {
+	return p.bodyRequired
+}
+
+// Bind populates the fields of elem, an addressable struct value of the
+// plan's type. The first source with a non-empty value wins; defaults apply
+// only when no source provided one.
+func (p *Plan) Bind(elem reflect.Value, values Values) error {
+	multi, _ := values.(MultiValues)
 
-	// 3. Apply values
-	for idx, val := range values {
-		field := elem.Field(idx)
-		if !field.CanSet() {
+	for i := range p.fields {
+		f := &p.fields[i]
+
+		if f.setAll != nil {
+			vals := f.lookupAll(values, multi)
+			if len(vals) == 0 {
+				continue
+			}
+			if err := f.setAll(fieldByIndex(elem, f.index), vals); err != nil {
+				return fmt.Errorf("failed to bind field %s: %w", f.name, err)
+			}
 			continue
 		}
-		if err := setField(field, val); err != nil {
-			typeField := elem.Type().Field(idx)
-			return fmt.Errorf("failed to bind field %s: %w", typeField.Name, err)
+
+		valStr := ""
+		for _, k := range f.keys {
+			if valStr = values.Value(k.source, k.key); valStr != "" {
+				break
+			}
+		}
+		if valStr == "" {
+			if !f.hasDef {
+				continue
+			}
+			valStr = f.def
+		}
+
+		if err := f.set(fieldByIndex(elem, f.index), valStr); err != nil {
+			return fmt.Errorf("failed to bind field %s: %w", f.name, err)
 		}
 	}
 
 	return nil
 }
 
-// BindJSON binds a JSON body to a struct field tagged with body:"json".
-func (b *Binder) BindJSON(target any, data []byte) error {
-	v := reflect.ValueOf(target)
-	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
-		return nil
+// fieldByIndex returns the nested field at index, allocating nil pointer
+// groups on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	if len(index) == 1 {
+		return v.Field(index[0])
+	}
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
 	}
+	return v
+}
 
-	elem := v.Elem()
-	typ := elem.Type()
+// Param describes a field bound from a source, for documentation generators.
+type Param struct {
+	Source  string
+	Key     string
+	Field   reflect.StructField
+	Default string
+}
+
+// Params lists every source key the plan binds, in field order, including
+// fields of nested groups with their prefixed keys.
+func (p *Plan) Params() []Param {
+	var params []Param
+	for _, f := range p.fields {
+		for _, k := range f.keys {
+			params = append(params, Param{Source: k.source, Key: k.key, Field: f.field, Default: f.def})
+		}
+	}
+	return params
+}
+
+// lookupAll collects the raw elements of a slice or array field: every
+// value of the first source that has one, each split on the separator.
+func (f *fieldPlan) lookupAll(values Values, multi MultiValues) []string {
+	var vals []string
+	for _, k := range f.keys {
+		if multi != nil {
+			vals = multi.All(k.source, k.key)
+		} else if v := values.Value(k.source, k.key); v != "" {
+			vals = []string{v}
+		}
+		if len(vals) > 0 {
+			break
+		}
+	}
+	if len(vals) == 0 && f.hasDef {
+		vals = []string{f.def}
+	}
+	return splitValues(vals, f.sep)
+}
 
-	for i := 0; i < elem.NumField(); i++ {
-		field := elem.Field(i)
-		fieldType := typ.Field(i)
+func splitValues(vals []string, sep string) []string {
+	if sep == "" {
+		return vals
+	}
 
-		if tag, ok := fieldType.Tag.Lookup("body"); ok && tag == "json" && field.CanSet() {
-			return json.Unmarshal(data, field.Addr().Interface())
+	out := make([]string, 0, len(vals))
+	for _, v := range vals {
+		for _, part := range strings.Split(v, sep) {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
 		}
 	}
+	return out
+}
 
+// Body returns a pointer to the body:"json" field of elem, or nil when the
+// struct has none. Transports decode non-JSON bodies into it.
+func (p *Plan) Body(elem reflect.Value) any {
+	if p.body < 0 {
+		return nil
+	}
+	return elem.Field(p.body).Addr().Interface()
+}
+
+// BindJSON unmarshals data into the body:"json" field of elem, if any.
+func (p *Plan) BindJSON(elem reflect.Value, data []byte) error {
+	if p.body < 0 {
+		return nil
+	}
+	return json.Unmarshal(data, elem.Field(p.body).Addr().Interface())
+}
+
+// DecodeJSON is like BindJSON but reports failures as a *BodyError with
+// the position of the problem. With strict set, unknown fields and
+// trailing data are rejected.
+func (p *Plan) DecodeJSON(elem reflect.Value, data []byte, strict bool) error {
+	if p.body < 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(elem.Field(p.body).Addr().Interface()); err != nil {
+		return newBodyError(data, err)
+	}
+	if strict {
+		// More reports false for a stray } or ], so look for the end
+		rest := bytes.TrimLeft(data[dec.InputOffset():], " \t\r\n")
+		if err := dec.Decode(&json.RawMessage{}); err != io.EOF {
+			offset := int64(len(data)-len(rest)) + 1
+			return newBodyError(data, &trailingDataError{offset: offset})
+		}
+	}
 	return nil
 }
 
-func setField(field reflect.Value, valStr string) error {
-	switch field.Kind() {
+// setterFor builds the setter for a field type. Pointer fields are
+// allocated only when a value is present, so they stay nil when absent.
+func (b *Binder) setterFor(typ reflect.Type) setter {
+	if fn, ok := b.converter(typ); ok {
+		return func(field reflect.Value, valStr string) error {
+			v, err := fn(valStr)
+			if err != nil {
+				return err
+			}
+			return setConverted(field, v)
+		}
+	}
+
+	if reflect.PointerTo(typ).Implements(textUnmarshalerType) {
+		return func(field reflect.Value, valStr string) error {
+			return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(valStr))
+		}
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		set := b.setterFor(typ.Elem())
+		return func(field reflect.Value, valStr string) error {
+			ptr := reflect.New(typ.Elem())
+			if err := set(ptr.Elem(), valStr); err != nil {
+				return err
+			}
+			field.Set(ptr)
+			return nil
+		}
 	case reflect.String:
-		field.SetString(valStr)
+		return func(field reflect.Value, valStr string) error {
+			field.SetString(valStr)
+			return nil
+		}
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		val, err := strconv.ParseInt(valStr, 10, 64)
-		if err != nil {
-			return err
+		// Parsing at the field's size rejects values that would wrap
+		bits := typ.Bits()
+		return func(field reflect.Value, valStr string) error {
+			val, err := strconv.ParseInt(valStr, 10, bits)
+			if err != nil {
+				return err
+			}
+			field.SetInt(val)
+			return nil
 		}
-		field.SetInt(val)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		val, err := strconv.ParseUint(valStr, 10, 64)
-		if err != nil {
-			return err
+		bits := typ.Bits()
+		return func(field reflect.Value, valStr string) error {
+			val, err := strconv.ParseUint(valStr, 10, bits)
+			if err != nil {
+				return err
+			}
+			field.SetUint(val)
+			return nil
 		}
-		field.SetUint(val)
 	case reflect.Bool:
-		val, err := strconv.ParseBool(valStr)
-		if err != nil {
-			return err
+		return func(field reflect.Value, valStr string) error {
+			val, err := strconv.ParseBool(valStr)
+			if err != nil {
+				return err
+			}
+			field.SetBool(val)
+			return nil
 		}
-		field.SetBool(val)
 	case reflect.Float32, reflect.Float64:
-		val, err := strconv.ParseFloat(valStr, 64)
-		if err != nil {
-			return err
+		bits := typ.Bits()
+		return func(field reflect.Value, valStr string) error {
+			val, err := strconv.ParseFloat(valStr, bits)
+			if err != nil {
+				return err
+			}
+			field.SetFloat(val)
+			return nil
+		}
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return func(field reflect.Value, valStr string) error {
+				field.SetBytes([]byte(valStr))
+				return nil
+			}
+		}
+		setAll := b.multiSetterFor(typ)
+		return func(field reflect.Value, valStr string) error {
+			return setAll(field, []string{valStr})
+		}
+	default:
+		kind := typ.Kind()
+		return func(reflect.Value, string) error {
+			return fmt.Errorf("unsupported type %s", kind)
 		}
-		field.SetFloat(val)
+	}
+}
+
+// setConverted stores a converter result in field.
+func setConverted(field reflect.Value, v any) error {
+	val := reflect.ValueOf(v)
+	switch {
+	case !val.IsValid():
+		field.SetZero()
+	case val.Type().AssignableTo(field.Type()):
+		field.Set(val)
+	case val.Type().ConvertibleTo(field.Type()):
+		field.Set(val.Convert(field.Type()))
 	default:
-		return fmt.Errorf("unsupported type %s", field.Kind())
+		return fmt.Errorf("converter returned %s, want %s", val.Type(), field.Type())
 	}
 	return nil
 }
+
+// isMulti reports whether a field collects several values. Byte slices and
+// types with a converter or a TextUnmarshaler (such as [16]byte UUIDs) are
+// bound from a single string instead. Pointers to slices and arrays are
+// multi too, so their values are split like those of plain slices.
+func (b *Binder) isMulti(typ reflect.Type) bool {
+	if _, ok := b.converter(typ); ok {
+		return false
+	}
+	if reflect.PointerTo(typ).Implements(textUnmarshalerType) {
+		return false
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return b.isMulti(typ.Elem())
+	case reflect.Slice:
+		return typ.Elem().Kind() != reflect.Uint8
+	case reflect.Array:
+		return true
+	}
+	return false
+}
+
+func (b *Binder) multiSetterFor(typ reflect.Type) multiSetter {
+	if typ.Kind() == reflect.Ptr {
+		setAll := b.multiSetterFor(typ.Elem())
+		return func(field reflect.Value, vals []string) error {
+			ptr := reflect.New(typ.Elem())
+			if err := setAll(ptr.Elem(), vals); err != nil {
+				return err
+			}
+			field.Set(ptr)
+			return nil
+		}
+	}
+
+	set := b.setterFor(typ.Elem())
+	if typ.Kind() == reflect.Array {
+		n := typ.Len()
+		return func(field reflect.Value, vals []string) error {
+			if len(vals) > n {
+				return fmt.Errorf("expected at most %d values, got %d", n, len(vals))
+			}
+			field.SetZero()
+			for i, v := range vals {
+				if err := set(field.Index(i), v); err != nil {
+					return fmt.Errorf("element %d: %w", i, err)
+				}
+			}
+			return nil
+		}
+	}
+
+	return func(field reflect.Value, vals []string) error {
+		slice := reflect.MakeSlice(typ, len(vals), len(vals))
+		for i, v := range vals {
+			if err := set(slice.Index(i), v); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+}
@@ -0,0 +1,497 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type benchEndpoint struct {
+	Meta    Pattern `method:"GET" path:"/users/{id}"`
+	ID      string  `path:"id"`
+	Page    int     `query:"page" default:"1"`
+	PerPage int     `query:"per_page" default:"20"`
+	Details bool    `query:"details"`
+	Token   string  `header:"Authorization"`
+}
+
+var benchValues = map[string]map[string]string{
+	"path":   {"id": "42"},
+	"query":  {"page": "3", "details": "true"},
+	"header": {"Authorization": "Bearer token"},
+}
+
+type mapValues map[string]map[string]string
+
+func (v mapValues) Value(source, key string) string {
+	return v[source][key]
+}
+
+func addBenchSources(b *Binder) {
+	for _, source := range []string{"path", "query", "header"} {
+		values := benchValues[source]
+		b.AddSource(source, func(key string) string { return values[key] })
+	}
+}
+
+// BenchmarkBindPerRequestBinder measures the former transport behaviour:
+// a fresh Binder per request, so tags are compiled on every call.
+func BenchmarkBindPerRequestBinder(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		binder := NewBinder()
+		addBenchSources(binder)
+
+		var ep benchEndpoint
+		if err := binder.Bind(&ep); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkBindSharedBinder reuses one Binder, so its plan cache is warm.
+func BenchmarkBindSharedBinder(b *testing.B) {
+	binder := NewBinder()
+	addBenchSources(binder)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var ep benchEndpoint
+		if err := binder.Bind(&ep); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkBindCompiledPlan measures the transport hot path: a plan compiled
+// once at registration and applied to each new instance.
+func BenchmarkBindCompiledPlan(b *testing.B) {
+	plan := NewBinder("path", "query", "header").Plan(reflect.TypeOf(benchEndpoint{}))
+	values := mapValues(benchValues)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var ep benchEndpoint
+		if err := plan.Bind(reflect.ValueOf(&ep).Elem(), values); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBindNumbers(t *testing.T) {
+	type target struct {
+		Small  int8      `query:"small"`
+		Port   uint16    `query:"port"`
+		Ratio  float32   `query:"ratio"`
+		Limit  *int32    `query:"limit"`
+		Tags   *[]string `query:"tags"`
+		Pinned *[]int    `query:"pinned" sep:"|"`
+	}
+
+	tests := []struct {
+		name    string
+		query   map[string]string
+		check   func(got target) bool
+		wantErr string
+	}{
+		{
+			name:  "in range",
+			query: map[string]string{"small": "-128", "port": "65535", "ratio": "0.5", "limit": "7"},
+			check: func(got target) bool {
+				return got.Small == -128 && got.Port == 65535 && got.Ratio == 0.5 && got.Limit != nil && *got.Limit == 7
+			},
+		},
+		{name: "int overflow", query: map[string]string{"small": "300"}, wantErr: "value out of range"},
+		{name: "uint overflow", query: map[string]string{"port": "65536"}, wantErr: "value out of range"},
+		{name: "float overflow", query: map[string]string{"ratio": "1e39"}, wantErr: "value out of range"},
+		{name: "pointer overflow", query: map[string]string{"limit": "3000000000"}, wantErr: "value out of range"},
+		{
+			name:  "pointer slices split",
+			query: map[string]string{"tags": "a, b", "pinned": "1|2"},
+			check: func(got target) bool {
+				return got.Tags != nil && reflect.DeepEqual(*got.Tags, []string{"a", "b"}) &&
+					got.Pinned != nil && reflect.DeepEqual(*got.Pinned, []int{1, 2})
+			},
+		},
+		{
+			name:  "absent pointers stay nil",
+			query: map[string]string{},
+			check: func(got target) bool { return got.Limit == nil && got.Tags == nil && got.Pinned == nil },
+		},
+	}
+
+	plan := NewBinder("query").Plan(reflect.TypeOf(target{}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got target
+			err := plan.Bind(reflect.ValueOf(&got).Elem(), mapValues{"query": tt.query})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Bind error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Bind: %v", err)
+			}
+			if !tt.check(got) {
+				t.Fatalf("Bind = %+v", got)
+			}
+		})
+	}
+}
+
+func TestBindPrecedence(t *testing.T) {
+	type target struct {
+		Tenant string `path:"tenant" query:"tenant" header:"X-Tenant" cookie:"tenant" default:"none"`
+		Region string `path:"region" query:"region" header:"X-Region" cookie:"region" bind:"cookie,header"`
+	}
+
+	// values sets both fields in each given source, to the source name.
+	values := func(sources ...string) mapValues {
+		v := mapValues{}
+		for _, s := range sources {
+			v[s] = map[string]string{"tenant": s, "region": s, "X-Tenant": s, "X-Region": s}
+		}
+		return v
+	}
+
+	tests := []struct {
+		name       string
+		precedence []string
+		values     mapValues
+		wantTenant string
+		wantRegion string
+	}{
+		{name: "path first", values: values("cookie", "header", "query", "path"), wantTenant: "path", wantRegion: "cookie"},
+		{name: "then query", values: values("cookie", "header", "query"), wantTenant: "query", wantRegion: "cookie"},
+		{name: "then header", values: values("cookie", "header"), wantTenant: "header", wantRegion: "cookie"},
+		{name: "then cookie", values: values("cookie"), wantTenant: "cookie", wantRegion: "cookie"},
+		{name: "default last", values: values(), wantTenant: "none"},
+		{name: "bind tag falls back to the rest", values: values("query", "path"), wantTenant: "path", wantRegion: "path"},
+		{name: "empty values are skipped", values: mapValues{"path": {"tenant": ""}, "query": {"tenant": "query"}}, wantTenant: "query"},
+		{
+			name:       "custom precedence",
+			precedence: []string{"cookie", "header"},
+			values:     values("header", "query", "path"),
+			wantTenant: "header",
+			wantRegion: "header",
+		},
+		{
+			name:       "undeclared sources follow in declaration order",
+			precedence: []string{"cookie"},
+			values:     values("query", "path"),
+			wantTenant: "query",
+			wantRegion: "query",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Declared in reverse, so the order below comes from the precedence.
+			b := NewBinder("cookie", "header", "query", "path")
+			if tt.precedence != nil {
+				b.SetPrecedence(tt.precedence...)
+			}
+			var got target
+			if err := b.BindValues(&got, tt.values); err != nil {
+				t.Fatalf("BindValues: %v", err)
+			}
+			if got.Tenant != tt.wantTenant || got.Region != tt.wantRegion {
+				t.Fatalf("bound tenant %q, region %q, want %q, %q", got.Tenant, got.Region, tt.wantTenant, tt.wantRegion)
+			}
+		})
+	}
+}
+
+// multiMapValues returns every value of a repeated key.
+type multiMapValues map[string]map[string][]string
+
+func (v multiMapValues) Value(source, key string) string {
+	if vals := v[source][key]; len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func (v multiMapValues) All(source, key string) []string {
+	return v[source][key]
+}
+
+func TestBindSlices(t *testing.T) {
+	type target struct {
+		Tags      []string `query:"tag"`
+		IDs       []int    `query:"ids" default:"1,2"`
+		Range     [2]int   `query:"range" sep:"|"`
+		Forwarded []string `header:"X-Forwarded-For" sep:""`
+		Raw       []byte   `query:"raw"`
+	}
+
+	tests := []struct {
+		name    string
+		values  Values
+		want    target
+		wantErr string
+	}{
+		{
+			name:   "repeated keys",
+			values: multiMapValues{"query": {"tag": {"a", "b"}}},
+			want:   target{Tags: []string{"a", "b"}, IDs: []int{1, 2}},
+		},
+		{
+			name:   "repeated and separated",
+			values: multiMapValues{"query": {"tag": {"a, b", "c"}, "ids": {"3,,4"}}},
+			want:   target{Tags: []string{"a", "b", "c"}, IDs: []int{3, 4}},
+		},
+		{
+			name:   "single values are split",
+			values: mapValues{"query": {"tag": "a,b", "ids": "5"}},
+			want:   target{Tags: []string{"a", "b"}, IDs: []int{5}},
+		},
+		{
+			name:   "custom separator",
+			values: mapValues{"query": {"range": "10|20"}},
+			want:   target{IDs: []int{1, 2}, Range: [2]int{10, 20}},
+		},
+		{
+			name:   "short array",
+			values: mapValues{"query": {"range": "10"}},
+			want:   target{IDs: []int{1, 2}, Range: [2]int{10, 0}},
+		},
+		{
+			name:   "splitting disabled",
+			values: multiMapValues{"header": {"X-Forwarded-For": {"10.0.0.1, 10.0.0.2", "10.0.0.3"}}},
+			want:   target{IDs: []int{1, 2}, Forwarded: []string{"10.0.0.1, 10.0.0.2", "10.0.0.3"}},
+		},
+		{
+			name:   "byte slices are not split",
+			values: mapValues{"query": {"raw": "a,b"}},
+			want:   target{IDs: []int{1, 2}, Raw: []byte("a,b")},
+		},
+		{name: "too many array values", values: mapValues{"query": {"range": "1|2|3"}}, wantErr: "expected at most 2 values, got 3"},
+		{name: "invalid element", values: mapValues{"query": {"ids": "1,x"}}, wantErr: "element 1"},
+	}
+
+	plan := NewBinder("query", "header").Plan(reflect.TypeOf(target{}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got target
+			err := plan.Bind(reflect.ValueOf(&got).Elem(), tt.values)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Bind error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Bind: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Bind = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+type level int
+
+// upperText unmarshals text in upper case, unless a converter replaces it.
+type upperText string
+
+func (u *upperText) UnmarshalText(b []byte) error {
+	*u = upperText(strings.ToUpper(string(b)))
+	return nil
+}
+
+func parseLevel(s string) (any, error) {
+	switch s {
+	case "debug":
+		return level(0), nil
+	case "error":
+		return level(2), nil
+	case "wrong":
+		return "not a level", nil
+	}
+	return nil, errors.New("unknown level " + s)
+}
+
+func TestBindConverters(t *testing.T) {
+	type target struct {
+		Since  *time.Time    `query:"since"`
+		Window time.Duration `query:"window" default:"1h"`
+		Level  level         `query:"level"`
+		Levels []level       `query:"levels"`
+		Min    *level        `query:"min"`
+		Name   upperText     `query:"name"`
+	}
+
+	since := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	debug, errLevel := level(0), level(2)
+
+	tests := []struct {
+		name       string
+		query      map[string]string
+		convertTxt bool // register a converter for upperText too
+		want       target
+		wantErr    string
+	}{
+		{name: "defaults and nil pointers", want: target{Window: time.Hour}},
+		{
+			name:  "text unmarshaler and duration",
+			query: map[string]string{"since": "2026-10-17T09:30:00Z", "window": "90s", "name": "ada"},
+			want:  target{Since: &since, Window: 90 * time.Second, Name: "ADA"},
+		},
+		{
+			name:  "converter",
+			query: map[string]string{"level": "error", "levels": "debug,error", "min": "debug"},
+			want:  target{Window: time.Hour, Level: errLevel, Levels: []level{debug, errLevel}, Min: &debug},
+		},
+		{
+			name:       "converter over text unmarshaler",
+			query:      map[string]string{"name": "ada"},
+			convertTxt: true,
+			want:       target{Window: time.Hour, Name: "converted ada"},
+		},
+		{name: "invalid time", query: map[string]string{"since": "yesterday"}, wantErr: "failed to bind field Since"},
+		{name: "invalid duration", query: map[string]string{"window": "soon"}, wantErr: "failed to bind field Window"},
+		{name: "converter error", query: map[string]string{"level": "loud"}, wantErr: "unknown level loud"},
+		{name: "converter element error", query: map[string]string{"levels": "debug,loud"}, wantErr: "element 1: unknown level loud"},
+		{name: "converter returns the wrong type", query: map[string]string{"level": "wrong"}, wantErr: "converter returned string, want core.level"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBinder("query")
+			b.RegisterConverter(reflect.TypeOf(level(0)), parseLevel)
+			if tt.convertTxt {
+				b.RegisterConverter(reflect.TypeOf(upperText("")), func(s string) (any, error) {
+					return upperText("converted " + s), nil
+				})
+			}
+
+			var got target
+			err := b.BindValues(&got, mapValues{"query": tt.query})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Bind error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Bind: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Bind = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+type Pagination struct {
+	Page    int      `query:"page" default:"1" validate:"min:1"`
+	PerPage int      `query:"per_page" default:"20" validate:"max:100"`
+	Sort    []string `query:"sort"`
+}
+
+type orderFilter struct {
+	Status string   `query:"status"`
+	Tags   []string `query:"tag"`
+}
+
+type tenantHeaders struct {
+	ID     string `header:"ID" validate:"required"`
+	Region string `header:"Region"`
+}
+
+type listOrders struct {
+	Meta Pattern `method:"GET" path:"/orders"`
+	Pagination
+	Filter orderFilter    `query:"filter.,inline"`
+	Tenant *tenantHeaders `header:"X-Tenant-,inline"`
+	Parent *tenantHeaders `header:"X-Parent-,inline"`
+}
+
+func TestBindGroups(t *testing.T) {
+	tests := []struct {
+		name         string
+		values       mapValues
+		check        func(got listOrders) bool
+		wantFailures []string // field:rule
+	}{
+		{
+			name: "defaults, nil pointer groups",
+			check: func(got listOrders) bool {
+				return got.Page == 1 && got.PerPage == 20 && got.Tenant == nil && got.Parent == nil
+			},
+		},
+		{
+			name: "embedded and prefixed keys",
+			values: mapValues{
+				"query":  {"page": "2", "sort": "name,-age", "filter.status": "open", "filter.tag": "a,b", "status": "ignored"},
+				"header": {"X-Tenant-ID": "acme", "X-Tenant-Region": "eu"},
+			},
+			check: func(got listOrders) bool {
+				return got.Page == 2 && reflect.DeepEqual(got.Sort, []string{"name", "-age"}) &&
+					got.Filter.Status == "open" && reflect.DeepEqual(got.Filter.Tags, []string{"a", "b"}) &&
+					got.Tenant != nil && *got.Tenant == tenantHeaders{ID: "acme", Region: "eu"} && got.Parent == nil
+			},
+		},
+		{
+			name:         "embedded groups are validated",
+			values:       mapValues{"query": {"page": "0", "per_page": "500"}},
+			wantFailures: []string{"page:min", "per_page:max"},
+		},
+		{
+			name:         "pointer groups are validated once bound",
+			values:       mapValues{"header": {"X-Tenant-Region": "eu"}},
+			wantFailures: []string{"X-Tenant-ID:required"},
+		},
+	}
+
+	b := NewBinder("query", "header")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got listOrders
+			if err := b.BindValues(&got, tt.values); err != nil {
+				t.Fatalf("BindValues: %v", err)
+			}
+			if tt.check != nil && !tt.check(got) {
+				t.Fatalf("BindValues = %+v", got)
+			}
+
+			var failures []string
+			var verr *ValidationError
+			if err := Validate(&got); errors.As(err, &verr) {
+				for _, fe := range verr.Errors {
+					failures = append(failures, fe.Field+":"+fe.Rule)
+				}
+			} else if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if !slices.Equal(failures, tt.wantFailures) {
+				t.Fatalf("failures %v, want %v", failures, tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestPlanParams(t *testing.T) {
+	var got []string
+	for _, p := range NewBinder("query", "header").Plan(reflect.TypeOf(listOrders{})).Params() {
+		got = append(got, p.Source+":"+p.Key+"="+p.Default)
+	}
+	want := []string{
+		"query:page=1", "query:per_page=20", "query:sort=",
+		"query:filter.status=", "query:filter.tag=",
+		"header:X-Tenant-ID=", "header:X-Tenant-Region=",
+		"header:X-Parent-ID=", "header:X-Parent-Region=",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("Params = %v, want %v", got, want)
+	}
+}
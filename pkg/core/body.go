@@ -0,0 +1,119 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// BodyError reports a request body that could not be decoded.
+// Line and Column are 1-based and point at the offending byte when the
+// decoder reports a position.
+type BodyError struct {
+	Line   int
+	Column int
+	Offset int64
+	Field  string
+	Err    error
+}
+
+func (e *BodyError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("invalid request body at line %d, column %d: %v", e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("invalid request body: %v", e.Err)
+}
+
+func (e *BodyError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns 400 Bad Request.
+func (e *BodyError) StatusCode() int {
+	return 400
+}
+
+// Payload returns the error with its position.
+func (e *BodyError) Payload() any {
+	p := map[string]any{
+		"error":  "invalid request body",
+		"detail": e.Err.Error(),
+	}
+	if e.Line > 0 {
+		p["line"] = e.Line
+		p["column"] = e.Column
+		p["offset"] = e.Offset
+	}
+	if e.Field != "" {
+		p["field"] = e.Field
+	}
+	return p
+}
+
+// Problem describes the failure as a 400 problem with its position.
+func (e *BodyError) Problem() *Problem {
+	p := NewProblem(400, e.Err.Error())
+	if e.Line > 0 {
+		p.With("line", e.Line).With("column", e.Column).With("offset", e.Offset)
+	}
+	if e.Field != "" {
+		p.With("field", e.Field)
+	}
+	return p
+}
+
+type trailingDataError struct {
+	offset int64
+}
+
+func (e *trailingDataError) Error() string {
+	return "unexpected data after the JSON value"
+}
+
+func newBodyError(data []byte, err error) *BodyError {
+	be := &BodyError{Err: err}
+
+	var (
+		syntaxErr   *json.SyntaxError
+		typeErr     *json.UnmarshalTypeError
+		trailingErr *trailingDataError
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		be.Offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		be.Offset = typeErr.Offset
+		be.Field = typeErr.Field
+	case errors.As(err, &trailingErr):
+		be.Offset = trailingErr.offset
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		be.Offset = int64(len(data))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		be.Field = strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+	}
+
+	if be.Offset > 0 {
+		// Offsets count the bytes read, so the culprit is the last one
+		be.Line, be.Column = position(data, be.Offset-1)
+	}
+	return be
+}
+
+// position converts a byte offset into a 1-based line and column.
+func position(data []byte, offset int64) (line, column int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line, column = 1, 1
+	for _, c := range data[:offset] {
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
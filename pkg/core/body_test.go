@@ -0,0 +1,64 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type bodyEndpoint struct {
+	Body struct {
+		A int `json:"a"`
+	} `body:"json"`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		strict    bool
+		want      int
+		wantErr   bool
+		wantLine  int
+		wantCol   int
+		wantField string
+	}{
+		{name: "value", data: `{"a":1}`, want: 1},
+		{name: "surrounding space", data: " \n{\"a\":1}\n ", strict: true, want: 1},
+		{name: "unknown field", data: `{"a":1,"b":2}`, want: 1},
+		{name: "trailing data", data: `{"a":1} x`, want: 1},
+		{name: "strict unknown field", data: `{"a":1,"b":2}`, strict: true, wantErr: true, wantField: "b"},
+		{name: "strict trailing value", data: `{"a":1} {}`, strict: true, wantErr: true, wantLine: 1, wantCol: 9},
+		{name: "strict trailing brace", data: `{"a":1}}`, strict: true, wantErr: true, wantLine: 1, wantCol: 8},
+		{name: "strict trailing bracket", data: "{\"a\":1}\n]", strict: true, wantErr: true, wantLine: 2, wantCol: 1},
+		{name: "strict trailing garbage", data: `{"a":1}x`, strict: true, wantErr: true, wantLine: 1, wantCol: 8},
+		{name: "syntax error", data: "{\n\"a\":}", wantErr: true, wantLine: 2, wantCol: 5},
+		{name: "type error", data: `{"a":"x"}`, wantErr: true, wantLine: 1, wantCol: 8, wantField: "a"},
+		{name: "truncated", data: `{"a":1`, wantErr: true, wantLine: 1, wantCol: 6},
+	}
+
+	plan := NewBinder().Plan(reflect.TypeOf(bodyEndpoint{}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ep bodyEndpoint
+			err := plan.DecodeJSON(reflect.ValueOf(&ep).Elem(), []byte(tt.data), tt.strict)
+
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("DecodeJSON: %v", err)
+				}
+				if ep.Body.A != tt.want {
+					t.Fatalf("a = %d, want %d", ep.Body.A, tt.want)
+				}
+				return
+			}
+			var be *BodyError
+			if !errors.As(err, &be) {
+				t.Fatalf("DecodeJSON error %v, want a *BodyError", err)
+			}
+			if be.Line != tt.wantLine || be.Column != tt.wantCol || be.Field != tt.wantField {
+				t.Fatalf("error at %d:%d field %q, want %d:%d field %q (%v)", be.Line, be.Column, be.Field, tt.wantLine, tt.wantCol, tt.wantField, err)
+			}
+		})
+	}
+}
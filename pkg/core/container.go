@@ -1,17 +1,749 @@
 package core
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
 	"github.com/mirkobrombin/go-foundation/pkg/di"
 )
 
 // Container manages dependency injection.
+//
+// Dependencies are either ready-made instances (Provide) or built by a
+// factory, whose lifetime decides how often it runs:
+//
+//   - singleton (ProvideFactory): once, on first use
+//   - scoped (ProvideScoped): once per scope, see NewScope
+//   - transient (ProvideTransient): every time the dependency is resolved
+//
+// Factories resolve what they need from the container they receive, so
+// they run in dependency order whatever the order they were registered in.
 type Container struct {
+	// holds the instances of the root, or those of a scope
 	*di.Container
+	factories *factories
+	parent    *Container // nil for the root
+	state     *scopeState
+	ctx       context.Context
+
+	// frame is set on the container handed to a factory
+	frame *buildFrame
+}
+
+// factories holds the factories shared by a container and its scopes,
+// and the types of the root's instances.
+type factories struct {
+	mu        sync.RWMutex
+	byName    map[string]*factory
+	order     []string
+	instances map[string]reflect.Type
+	byType    map[reflect.Type]typeMatch // resolved types, reset on changes
+}
+
+type typeMatch struct {
+	name string
+	err  error
+}
+
+type lifetime int
+
+const (
+	singleton lifetime = iota
+	scoped
+	transient
+)
+
+type factory struct {
+	name     string
+	fn       reflect.Value
+	typ      reflect.Type // declared result type
+	lifetime lifetime
+
+	// Singletons only, set under the root build lock
+	done atomic.Bool
+	err  error
 }
 
+// scopeState is what a container or scope builds and cleans up.
+type scopeState struct {
+	mu       sync.Mutex // held while building
+	provided map[string]reflect.Type
+	failed   map[string]error
+	hooks    []func(error) error
+	closed   bool
+}
+
+// buildFrame is the chain of factories being run.
+type buildFrame struct {
+	path []string
+	held bool        // the build lock of the container is held
+	done atomic.Bool // set once the factory returned
+}
+
+// ErrScopeAborted is passed to cleanup hooks when a scope ends before its
+// handler returned, e.g. because the request failed validation.
+var ErrScopeAborted = errors.New("core: scope ended before the handler returned")
+
 // NewContainer creates a new DI container.
 func NewContainer() *Container {
 	return &Container{
 		Container: di.New(),
+		factories: &factories{
+			byName:    make(map[string]*factory),
+			instances: make(map[string]reflect.Type),
+			byType:    make(map[reflect.Type]typeMatch),
+		},
+		state: newScopeState(),
+	}
+}
+
+func newScopeState() *scopeState {
+	return &scopeState{provided: make(map[string]reflect.Type), failed: make(map[string]error)}
+}
+
+var (
+	containerType = reflect.TypeOf((*Container)(nil))
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// NewScope creates a child container for a unit of work such as a request.
+// Scoped dependencies are built once per scope, and the scope's instances,
+// including those given to Provide, shadow the parent's. Factories can
+// read ctx with Context. Call Close when the work is done.
+//
+// Transports create a scope for every request, call, message or job run.
+func (c *Container) NewScope(ctx context.Context) *Container {
+	return &Container{
+		Container: di.New(),
+		factories: c.factories,
+		parent:    c,
+		state:     newScopeState(),
+		ctx:       ctx,
+	}
+}
+
+// Context returns the context of the scope, or context.Background for the
+// root container.
+func (c *Container) Context() context.Context {
+	for s := c; s != nil; s = s.parent {
+		if s.ctx != nil {
+			return s.ctx
+		}
+	}
+	return context.Background()
+}
+
+// Provide registers a ready-made dependency. On the root container it
+// replaces any factory registered with the same name; on a scope it is
+// only visible to the scope.
+func (c *Container) Provide(name string, instance any) {
+	c.lock()
+	defer c.unlock()
+
+	if c.parent == nil {
+		c.factories.mu.Lock()
+		delete(c.factories.byName, name)
+		c.factories.instances[name] = reflect.TypeOf(instance)
+		clear(c.factories.byType)
+		c.factories.mu.Unlock()
+	} else {
+		c.state.provided[name] = reflect.TypeOf(instance)
+	}
+	c.Container.Provide(name, instance)
+}
+
+// ProvideFactory registers a singleton dependency built on first use by
+// constructor, a func(*Container) (T, error) or func(*Container) T. It runs
+// at most once: its result, or its error, is kept. ProvideFactory panics
+// if constructor has another signature.
+//
+//	c.ProvideFactory("DB", func(c *core.Container) (*sql.DB, error) {
+//		cfg, err := core.Resolve[*Config](c, "Config")
+//		if err != nil {
+//			return nil, err
+//		}
+//		return sql.Open("postgres", cfg.DSN)
+//	})
+//
+// Call Build at startup to run every singleton factory and get their
+// errors.
+func (c *Container) ProvideFactory(name string, constructor any) {
+	c.register("ProvideFactory", name, constructor, singleton)
+}
+
+// ProvideScoped registers a dependency built once per scope, see NewScope.
+// Resolving it outside a scope fails, and so do singletons that depend on
+// it. The factory can register cleanup with OnClose:
+//
+//	c.ProvideScoped("Tx", func(c *core.Container) (*sql.Tx, error) {
+//		db, err := core.Resolve[*sql.DB](c, "DB")
+//		if err != nil {
+//			return nil, err
+//		}
+//		tx, err := db.BeginTx(c.Context(), nil)
+//		if err != nil {
+//			return nil, err
+//		}
+//		c.OnClose(func(err error) error {
+//			if err != nil {
+//				return tx.Rollback()
+//			}
+//			return tx.Commit()
+//		})
+//		return tx, nil
+//	})
+func (c *Container) ProvideScoped(name string, constructor any) {
+	c.register("ProvideScoped", name, constructor, scoped)
+}
+
+// ProvideTransient registers a dependency built every time it is resolved.
+// Cleanup registered by the factory runs when the scope it was resolved in
+// is closed.
+func (c *Container) ProvideTransient(name string, constructor any) {
+	c.register("ProvideTransient", name, constructor, transient)
+}
+
+func (c *Container) register(method, name string, constructor any, lt lifetime) {
+	fn := reflect.ValueOf(constructor)
+	typ := fn.Type()
+	if typ.Kind() != reflect.Func || typ.NumIn() != 1 || typ.In(0) != containerType ||
+		typ.NumOut() < 1 || typ.NumOut() > 2 || (typ.NumOut() == 2 && typ.Out(1) != errorType) {
+		panic(fmt.Sprintf("Container.%s: %s: factory must be a func(*core.Container) (T, error) or func(*core.Container) T, got %T", method, name, constructor))
+	}
+	if c.parent != nil {
+		panic(fmt.Sprintf("Container.%s: %s: factories are registered on the root container, not on a scope", method, name))
+	}
+
+	c.factories.mu.Lock()
+	defer c.factories.mu.Unlock()
+
+	if _, ok := c.factories.byName[name]; !ok {
+		c.factories.order = append(c.factories.order, name)
 	}
+	c.factories.byName[name] = &factory{name: name, fn: fn, typ: typ.Out(0), lifetime: lt}
+	delete(c.factories.instances, name)
+	clear(c.factories.byType)
+}
+
+// lookup returns the factory registered as name, or nil.
+func (f *factories) lookup(name string) *factory {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.byName[name]
+}
+
+// Resolve returns the dependency registered as name, running its factory
+// if needed. It fails with a *FactoryError when the factory fails, a
+// *CycleError when factories depend on each other, or an error wrapping
+// ErrNotFound when nothing is registered.
+func (c *Container) Resolve(name string) (any, error) {
+	// Instances of the scopes come first, then the factory
+	for s := c; s.parent != nil; s = s.parent {
+		if v, ok := s.Container.Get(name); ok {
+			return v, nil
+		}
+	}
+
+	f := c.factories.lookup(name)
+	if f != nil {
+		switch f.lifetime {
+		case scoped:
+			return c.buildScoped(f)
+		case transient:
+			return c.buildTransient(f)
+		}
+		if err := c.root().buildSingleton(f, c.path()); err != nil {
+			return nil, err
+		}
+	}
+
+	v, ok := c.root().Container.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("dependency %s: %w", name, ErrNotFound)
+	}
+	return v, nil
+}
+
+// Resolve returns the dependency registered as name as a T. See
+// Container.Resolve.
+func Resolve[T any](c *Container, name string) (T, error) {
+	var zero T
+	v, err := c.Resolve(name)
+	if err != nil {
+		return zero, err
+	}
+	typed, ok := v.(T)
+	if !ok {
+		return zero, fmt.Errorf("dependency %s is %T, not %s", name, v, reflect.TypeFor[T]())
+	}
+	return typed, nil
+}
+
+// Get returns a dependency, running its factory if needed. A failed
+// factory is reported as missing; use Resolve for the error.
+func (c *Container) Get(name string) (any, bool) {
+	v, err := c.Resolve(name)
+	return v, err == nil
+}
+
+// MustGet returns a dependency and panics if it is missing or its factory
+// fails.
+func (c *Container) MustGet(name string) any {
+	v, err := c.Resolve(name)
+	if err != nil {
+		panic("core: " + err.Error())
+	}
+	return v
+}
+
+// Has reports whether a dependency or a factory is registered as name.
+func (c *Container) Has(name string) bool {
+	if c.factories.lookup(name) != nil {
+		return true
+	}
+	for s := c; s != nil; s = s.parent {
+		if s.Container.Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys returns the names of all dependencies and factories.
+func (c *Container) Keys() []string {
+	var keys []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			keys = append(keys, name)
+		}
+	}
+
+	for s := c; s != nil; s = s.parent {
+		for _, name := range s.Container.Keys() {
+			add(name)
+		}
+	}
+	c.factories.mu.RLock()
+	defer c.factories.mu.RUnlock()
+	for _, name := range c.factories.order {
+		if _, ok := c.factories.byName[name]; ok {
+			add(name)
+		}
+	}
+	return keys
+}
+
+// Inject sets the fields of target, a pointer to a struct, tagged inject,
+// running the factories they need:
+//
+//   - `inject:"name"` injects the dependency registered as name, which
+//     qualifies which one to use when several have the field's type
+//   - `inject:""` injects the only dependency whose type is assignable to
+//     the field's: the same type, or for interfaces any implementation
+//
+// Fields whose dependency is not registered are left unset. Fields whose
+// factory fails, whose dependency has another type or whose type matches
+// several dependencies (*AmbiguousError) are left unset too, and the
+// errors are returned.
+func (c *Container) Inject(target any) error {
+	val := reflect.ValueOf(target)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	elem := val.Elem()
+
+	var errs []error
+	for _, f := range injectFields(elem.Type()) {
+		field := elem.Field(f.index)
+		if !field.CanSet() {
+			continue
+		}
+
+		name := f.name
+		if name == "" {
+			var err error
+			if name, err = c.nameFor(field.Type()); err != nil {
+				if !errors.Is(err, ErrNotFound) {
+					errs = append(errs, fmt.Errorf("inject %s.%s: %w", elem.Type().Name(), f.field, err))
+				}
+				continue
+			}
+		}
+
+		dep, err := c.Resolve(name)
+		if err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				errs = append(errs, fmt.Errorf("inject %s.%s: %w", elem.Type().Name(), f.field, err))
+			}
+			continue
+		}
+		depVal := reflect.ValueOf(dep)
+		if !depVal.Type().AssignableTo(field.Type()) {
+			errs = append(errs, fmt.Errorf("inject %s.%s: dependency %s is %s, not %s", elem.Type().Name(), f.field, name, depVal.Type(), field.Type()))
+			continue
+		}
+		field.Set(depVal)
+	}
+	return errors.Join(errs...)
+}
+
+// nameFor returns the name of the only dependency assignable to typ. The
+// instances provided to a scope come first.
+func (c *Container) nameFor(typ reflect.Type) (string, error) {
+	for s := c; s.parent != nil; s = s.parent {
+		s.lock()
+		names := matching(typ, maps.All(s.state.provided))
+		s.unlock()
+		if len(names) > 0 {
+			return only(typ, names)
+		}
+	}
+	return c.factories.nameFor(typ)
+}
+
+// nameFor returns the name of the only factory or root instance assignable
+// to typ.
+func (f *factories) nameFor(typ reflect.Type) (string, error) {
+	f.mu.RLock()
+	m, ok := f.byType[typ]
+	f.mu.RUnlock()
+	if ok {
+		return m.name, m.err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := matching(typ, maps.All(f.instances))
+	for name, fac := range f.byName {
+		if fac.typ.AssignableTo(typ) {
+			names = append(names, name)
+		}
+	}
+	m.name, m.err = only(typ, names)
+	f.byType[typ] = m
+	return m.name, m.err
+}
+
+// matching returns the names of the types assignable to typ.
+func matching(typ reflect.Type, types iter.Seq2[string, reflect.Type]) []string {
+	var names []string
+	for name, t := range types {
+		if t != nil && t.AssignableTo(typ) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func only(typ reflect.Type, names []string) (string, error) {
+	switch len(names) {
+	case 0:
+		return "", fmt.Errorf("dependency of type %s: %w", typ, ErrNotFound)
+	case 1:
+		return names[0], nil
+	}
+	slices.Sort(names)
+	return "", &AmbiguousError{Type: typ, Names: names}
+}
+
+// Build runs every singleton factory that has not run yet, in dependency
+// order, and returns the errors of all those that failed, including
+// earlier failures, each root cause once: a factory failing because a
+// dependency failed is not reported again.
+func (c *Container) Build() error {
+	c.factories.mu.RLock()
+	var singletons []*factory
+	for _, name := range c.factories.order {
+		if f := c.factories.byName[name]; f != nil && f.lifetime == singleton {
+			singletons = append(singletons, f)
+		}
+	}
+	c.factories.mu.RUnlock()
+
+	root := c.root()
+	var errs []error
+	for _, f := range singletons {
+		err := root.buildSingleton(f, nil)
+		var fe *FactoryError
+		if errors.As(err, &fe) && fe.Name == f.name && !dependencyFailed(fe.Err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dependencyFailed reports whether err is the failure of another factory.
+func dependencyFailed(err error) bool {
+	var dep *FactoryError
+	return errors.As(err, &dep)
+}
+
+// OnClose registers a cleanup hook, run by Close with the outcome of the
+// scope's work. Factories call it on the container they receive: hooks of
+// scoped and transient dependencies run when their scope is closed, those
+// of singletons when the root container is.
+func (c *Container) OnClose(fn func(err error) error) {
+	c.lock()
+	defer c.unlock()
+	c.state.hooks = append(c.state.hooks, fn)
+}
+
+// Close ends a scope: it runs the cleanup hooks, last registered first,
+// with err, the error the scope's work failed with or nil, and returns the
+// errors of the hooks. Transports pass the handler's error, or
+// ErrScopeAborted when the handler did not run. Closing the root container
+// runs the hooks of singletons, e.g. at shutdown. Closing twice does
+// nothing.
+func (c *Container) Close(err error) error {
+	c.lock()
+	hooks := c.state.hooks
+	c.state.hooks = nil
+	c.state.closed = true
+	c.unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if herr := runHook(hooks[i], err); herr != nil {
+			errs = append(errs, herr)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func runHook(fn func(error) error, err error) (herr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			herr = fmt.Errorf("cleanup panic: %v", r)
+		}
+	}()
+	return fn(err)
+}
+
+// root returns the root container, or the view of it c is.
+func (c *Container) root() *Container {
+	for c.parent != nil {
+		c = c.parent
+	}
+	return c
+}
+
+// path returns the factories being run, c's last.
+func (c *Container) path() []string {
+	if c.frame == nil {
+		return nil
+	}
+	return c.frame.path
+}
+
+// buildSingleton runs f once; c is the root container.
+func (c *Container) buildSingleton(f *factory, path []string) error {
+	if f.done.Load() {
+		return f.err
+	}
+
+	c.lock()
+	defer c.unlock()
+
+	if f.done.Load() {
+		return f.err
+	}
+	if err := checkCycle(path, f.name); err != nil {
+		// Not kept: the factories in the cycle fail with it
+		return err
+	}
+
+	v, err := c.call(f, path, true)
+	if err != nil {
+		f.err = &FactoryError{Name: f.name, Err: err}
+	} else {
+		c.Container.Provide(f.name, v)
+	}
+	f.done.Store(true)
+	return f.err
+}
+
+// buildScoped runs f once for the scope c.
+func (c *Container) buildScoped(f *factory) (any, error) {
+	if c.parent == nil {
+		return nil, fmt.Errorf("dependency %s is scoped and cannot be resolved outside a scope", f.name)
+	}
+
+	c.lock()
+	defer c.unlock()
+
+	if v, ok := c.Container.Get(f.name); ok {
+		return v, nil
+	}
+	if err, ok := c.state.failed[f.name]; ok {
+		return nil, err
+	}
+	if c.state.closed {
+		return nil, fmt.Errorf("dependency %s: scope is closed", f.name)
+	}
+	if err := checkCycle(c.path(), f.name); err != nil {
+		return nil, err
+	}
+
+	v, err := c.call(f, c.path(), true)
+	if err != nil {
+		fe := &FactoryError{Name: f.name, Err: err}
+		c.state.failed[f.name] = fe
+		return nil, fe
+	}
+	c.Container.Provide(f.name, v)
+	return v, nil
+}
+
+// buildTransient runs f for c.
+func (c *Container) buildTransient(f *factory) (any, error) {
+	if c.parent != nil && c.closed() {
+		return nil, fmt.Errorf("dependency %s: scope is closed", f.name)
+	}
+	if err := checkCycle(c.path(), f.name); err != nil {
+		return nil, err
+	}
+	v, err := c.call(f, c.path(), c.holding())
+	if err != nil {
+		return nil, &FactoryError{Name: f.name, Err: err}
+	}
+	return v, nil
+}
+
+func (c *Container) closed() bool {
+	c.lock()
+	defer c.unlock()
+	return c.state.closed
+}
+
+func checkCycle(path []string, name string) error {
+	for i, p := range path {
+		if p == name {
+			cycle := append(append([]string(nil), path[i:]...), name)
+			return &CycleError{Path: cycle}
+		}
+	}
+	return nil
+}
+
+// call runs f with a view of c; held reports whether the caller holds the
+// build lock of c.
+func (c *Container) call(f *factory, path []string, held bool) (any, error) {
+	frame := &buildFrame{path: append(append([]string(nil), path...), f.name), held: held}
+	view := *c
+	view.frame = frame
+	v, err := callFactory(f.fn, &view)
+	frame.done.Store(true)
+	return v, err
+}
+
+func callFactory(fn reflect.Value, c *Container) (v any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	out := fn.Call([]reflect.Value{reflect.ValueOf(c)})
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, out[1].Interface().(error)
+	}
+	switch out[0].Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		// Also catches typed nils, e.g. a nil *sql.DB
+		if out[0].IsNil() {
+			return nil, errors.New("factory returned nil")
+		}
+	}
+	return out[0].Interface(), nil
+}
+
+// lock takes the build lock, unless c is the container of a running
+// factory whose caller already holds it.
+func (c *Container) lock() {
+	if !c.holding() {
+		c.state.mu.Lock()
+	}
+}
+
+func (c *Container) unlock() {
+	if !c.holding() {
+		c.state.mu.Unlock()
+	}
+}
+
+func (c *Container) holding() bool {
+	return c.frame != nil && c.frame.held && !c.frame.done.Load()
+}
+
+// injectField is a field injected from the dependency name, or by type
+// when name is empty.
+type injectField struct {
+	index int
+	field string
+	name  string
+}
+
+var injectCache sync.Map // reflect.Type -> []injectField
+
+// injectFields returns the fields of typ tagged inject.
+func injectFields(typ reflect.Type) []injectField {
+	if cached, ok := injectCache.Load(typ); ok {
+		return cached.([]injectField)
+	}
+	var fields []injectField
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if name, ok := field.Tag.Lookup("inject"); ok {
+			fields = append(fields, injectField{index: i, field: field.Name, name: name})
+		}
+	}
+	injectCache.Store(typ, fields)
+	return fields
+}
+
+// FactoryError is the failure of a factory.
+type FactoryError struct {
+	Name string
+	Err  error
+}
+
+func (e *FactoryError) Error() string {
+	return "build " + e.Name + ": " + e.Err.Error()
+}
+
+func (e *FactoryError) Unwrap() error {
+	return e.Err
+}
+
+// AmbiguousError reports a field injected by type that several
+// dependencies can be assigned to. Name the one to use in the tag, e.g.
+// `inject:"primary"`.
+type AmbiguousError struct {
+	Type  reflect.Type
+	Names []string
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("ambiguous dependency of type %s: %s all match", e.Type, strings.Join(e.Names, ", "))
+}
+
+// CycleError reports factories that depend on each other. Path starts and
+// ends with the same name.
+type CycleError struct {
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return "dependency cycle: " + strings.Join(e.Path, " -> ")
 }
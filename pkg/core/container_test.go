@@ -0,0 +1,620 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type config struct {
+	DSN string
+}
+
+type database struct {
+	cfg *config
+}
+
+func TestFactory(t *testing.T) {
+	c := NewContainer()
+	var built atomic.Int32
+	// Registered before its dependency
+	c.ProvideFactory("DB", func(c *Container) (*database, error) {
+		built.Add(1)
+		cfg, err := Resolve[*config](c, "Config")
+		if err != nil {
+			return nil, err
+		}
+		return &database{cfg: cfg}, nil
+	})
+	c.ProvideFactory("Config", func(c *Container) *config {
+		return &config{DSN: "postgres://"}
+	})
+
+	if built.Load() != 0 {
+		t.Fatal("factory ran before being resolved")
+	}
+
+	var wg sync.WaitGroup
+	dbs := make([]*database, 8)
+	for i := range dbs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dbs[i], _ = Resolve[*database](c, "DB")
+		}()
+	}
+	wg.Wait()
+
+	if built.Load() != 1 {
+		t.Fatalf("factory ran %d times, want 1", built.Load())
+	}
+	for _, db := range dbs {
+		if db == nil || db != dbs[0] || db.cfg.DSN != "postgres://" {
+			t.Fatalf("Resolve = %+v, want the same database for every caller", db)
+		}
+	}
+}
+
+func TestFactoryErrors(t *testing.T) {
+	errDown := errors.New("down")
+
+	tests := []struct {
+		name    string
+		setup   func(c *Container)
+		resolve string
+		wantErr string
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name:    "missing",
+			setup:   func(c *Container) {},
+			resolve: "Nope",
+			wantErr: "dependency Nope: not found",
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, ErrNotFound) {
+					t.Fatalf("error %v does not wrap ErrNotFound", err)
+				}
+			},
+		},
+		{
+			name: "error is kept",
+			setup: func(c *Container) {
+				c.ProvideFactory("DB", func(c *Container) (*database, error) { return nil, errDown })
+			},
+			resolve: "DB",
+			wantErr: "build DB: down",
+			check: func(t *testing.T, err error) {
+				var fe *FactoryError
+				if !errors.As(err, &fe) || fe.Name != "DB" || !errors.Is(err, errDown) {
+					t.Fatalf("error %v is not a FactoryError for DB wrapping errDown", err)
+				}
+			},
+		},
+		{
+			name: "dependency error",
+			setup: func(c *Container) {
+				c.ProvideFactory("Config", func(c *Container) (*config, error) { return nil, errDown })
+				c.ProvideFactory("DB", func(c *Container) (*database, error) {
+					_, err := c.Resolve("Config")
+					return nil, err
+				})
+			},
+			resolve: "DB",
+			wantErr: "build DB: build Config: down",
+		},
+		{
+			name: "panic",
+			setup: func(c *Container) {
+				c.ProvideFactory("DB", func(c *Container) *database { panic("boom") })
+			},
+			resolve: "DB",
+			wantErr: "build DB: panic: boom",
+		},
+		{
+			name: "nil result",
+			setup: func(c *Container) {
+				c.ProvideFactory("DB", func(c *Container) *database { return nil })
+			},
+			resolve: "DB",
+			wantErr: "build DB: factory returned nil",
+		},
+		{
+			name: "self cycle",
+			setup: func(c *Container) {
+				c.ProvideFactory("A", func(c *Container) (*config, error) {
+					_, err := c.Resolve("A")
+					return nil, err
+				})
+			},
+			resolve: "A",
+			wantErr: "dependency cycle: A -> A",
+		},
+		{
+			name: "cycle",
+			setup: func(c *Container) {
+				for name, dep := range map[string]string{"A": "B", "B": "C", "C": "A"} {
+					c.ProvideFactory(name, func(c *Container) (*config, error) {
+						_, err := c.Resolve(dep)
+						return nil, err
+					})
+				}
+			},
+			resolve: "A",
+			wantErr: "dependency cycle: A -> B -> C -> A",
+			check: func(t *testing.T, err error) {
+				var ce *CycleError
+				if !errors.As(err, &ce) || !reflect.DeepEqual(ce.Path, []string{"A", "B", "C", "A"}) {
+					t.Fatalf("error %v is not a CycleError with path A B C A", err)
+				}
+			},
+		},
+		{
+			name: "wrong type",
+			setup: func(c *Container) {
+				c.Provide("DB", &config{})
+			},
+			resolve: "DB",
+			wantErr: "dependency DB is *core.config, not *core.database",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewContainer()
+			tt.setup(c)
+
+			_, err := Resolve[*database](c, tt.resolve)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Resolve error %v, want %q", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, err)
+			}
+			// Resolving again gives the same outcome
+			if _, again := Resolve[*database](c, tt.resolve); again == nil || again.Error() != err.Error() {
+				t.Fatalf("second Resolve error %v, want %v", again, err)
+			}
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	c := NewContainer()
+	var runs atomic.Int32
+	c.ProvideFactory("Cache", func(c *Container) (*config, error) {
+		runs.Add(1)
+		return nil, errors.New("cache down")
+	})
+	c.ProvideFactory("DB", func(c *Container) (*config, error) {
+		runs.Add(1)
+		return nil, errors.New("db down")
+	})
+	c.ProvideFactory("Repo", func(c *Container) (*database, error) {
+		runs.Add(1)
+		_, err := c.Resolve("DB")
+		return nil, err
+	})
+	c.ProvideFactory("Config", func(c *Container) *config {
+		runs.Add(1)
+		return &config{}
+	})
+
+	err := c.Build()
+	if err == nil {
+		t.Fatal("Build succeeded, want errors")
+	}
+	// Repo failed because DB did and is not reported again
+	if got, want := err.Error(), "build Cache: cache down\nbuild DB: db down"; got != want {
+		t.Fatalf("Build error %q, want %q", got, want)
+	}
+	if runs.Load() != 4 {
+		t.Fatalf("factories ran %d times, want 4", runs.Load())
+	}
+
+	// Earlier failures are reported again, factories do not run again
+	if again := c.Build(); again == nil || again.Error() != err.Error() {
+		t.Fatalf("second Build error %v, want %v", again, err)
+	}
+	if runs.Load() != 4 {
+		t.Fatalf("factories ran %d times after second Build, want 4", runs.Load())
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	tests := []struct {
+		name      string
+		register  func(c *Container)
+		wantPanic string
+	}{
+		{
+			name:      "not a func",
+			register:  func(c *Container) { c.ProvideFactory("A", &config{}) },
+			wantPanic: "factory must be a func",
+		},
+		{
+			name:      "no container argument",
+			register:  func(c *Container) { c.ProvideFactory("A", func() *config { return nil }) },
+			wantPanic: "factory must be a func",
+		},
+		{
+			name:      "second result not an error",
+			register:  func(c *Container) { c.ProvideFactory("A", func(*Container) (*config, bool) { return nil, false }) },
+			wantPanic: "factory must be a func",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				msg, _ := recover().(string)
+				if !strings.Contains(msg, tt.wantPanic) {
+					t.Fatalf("panic %q, want %q", msg, tt.wantPanic)
+				}
+			}()
+			tt.register(NewContainer())
+		})
+	}
+}
+
+func TestProvideReplacesFactory(t *testing.T) {
+	c := NewContainer()
+	c.ProvideFactory("Config", func(c *Container) *config { return &config{DSN: "factory"} })
+	c.Provide("Config", &config{DSN: "instance"})
+
+	cfg, err := Resolve[*config](c, "Config")
+	if err != nil || cfg.DSN != "instance" {
+		t.Fatalf("Resolve = %+v, %v, want the provided instance", cfg, err)
+	}
+	if got := c.Keys(); !reflect.DeepEqual(got, []string{"Config"}) {
+		t.Fatalf("Keys = %v, want [Config]", got)
+	}
+}
+
+type tx struct {
+	id int
+}
+
+type ctxKey struct{}
+
+func TestScope(t *testing.T) {
+	c := NewContainer()
+	var txs atomic.Int32
+	c.ProvideScoped("Tx", func(c *Container) *tx {
+		return &tx{id: int(txs.Add(1))}
+	})
+	c.ProvideTransient("Request", func(c *Container) (*config, error) {
+		return &config{DSN: c.Context().Value(ctxKey{}).(string)}, nil
+	})
+	c.ProvideFactory("Repo", func(c *Container) (*database, error) {
+		_, err := c.Resolve("Tx")
+		return &database{}, err
+	})
+
+	if _, err := c.Resolve("Tx"); err == nil || !strings.Contains(err.Error(), "outside a scope") {
+		t.Fatalf("Resolve of a scoped dependency on the root error %v, want outside a scope", err)
+	}
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "a")
+	a, b := c.NewScope(ctx), c.NewScope(context.WithValue(ctx, ctxKey{}, "b"))
+	txA1, _ := Resolve[*tx](a, "Tx")
+	txA2, _ := Resolve[*tx](a, "Tx")
+	txB, _ := Resolve[*tx](b, "Tx")
+	if txA1 == nil || txA1 != txA2 || txB == nil || txB == txA1 {
+		t.Fatalf("scoped dependency = %v, %v in one scope and %v in another, want one per scope", txA1, txA2, txB)
+	}
+
+	r1, _ := Resolve[*config](a, "Request")
+	r2, _ := Resolve[*config](a, "Request")
+	rb, _ := Resolve[*config](b, "Request")
+	if r1 == nil || r1 == r2 || r1.DSN != "a" || rb.DSN != "b" {
+		t.Fatalf("transient dependency = %v, %v, %v, want a new one each time from the scope's context", r1, r2, rb)
+	}
+
+	// A singleton cannot capture a scoped dependency, even from a scope
+	if _, err := a.Resolve("Repo"); err == nil || !strings.Contains(err.Error(), "outside a scope") {
+		t.Fatalf("Resolve of a singleton using a scoped dependency error %v, want outside a scope", err)
+	}
+
+	// Instances provided to a scope shadow the root's and stay in the scope
+	c.Provide("Config", &config{DSN: "root"})
+	a.Provide("Config", &config{DSN: "scope"})
+	if cfg, _ := Resolve[*config](a, "Config"); cfg.DSN != "scope" {
+		t.Fatalf("scope Config = %s, want scope", cfg.DSN)
+	}
+	if cfg, _ := Resolve[*config](b, "Config"); cfg.DSN != "root" {
+		t.Fatalf("other scope Config = %s, want root", cfg.DSN)
+	}
+	if cfg, _ := Resolve[*config](c, "Config"); cfg.DSN != "root" {
+		t.Fatalf("root Config = %s, want root", cfg.DSN)
+	}
+
+	if c.Context() != context.Background() || a.NewScope(nil).Context() != ctx {
+		t.Fatal("Context does not return the nearest scope's context")
+	}
+
+	defer func() {
+		if msg, _ := recover().(string); !strings.Contains(msg, "registered on the root container") {
+			t.Fatalf("ProvideScoped on a scope panic %q, want registered on the root container", msg)
+		}
+	}()
+	a.ProvideScoped("Other", func(c *Container) *tx { return &tx{} })
+}
+
+func TestClose(t *testing.T) {
+	errFailed := errors.New("handler failed")
+
+	tests := []struct {
+		name      string
+		closeWith error
+		hookErr   error
+		wantLog   []string
+		wantErr   string
+	}{
+		{
+			name:    "success",
+			wantLog: []string{"request <nil>", "tx <nil>"},
+		},
+		{
+			name:      "failure",
+			closeWith: errFailed,
+			wantLog:   []string{"request handler failed", "tx handler failed"},
+		},
+		{
+			name:      "aborted",
+			closeWith: ErrScopeAborted,
+			wantLog:   []string{"request " + ErrScopeAborted.Error(), "tx " + ErrScopeAborted.Error()},
+		},
+		{
+			name:    "hook errors are returned",
+			hookErr: errors.New("commit failed"),
+			wantLog: []string{"request <nil>", "tx <nil>"},
+			wantErr: "cleanup panic: rollback\ncommit failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewContainer()
+			var log []string
+			c.ProvideScoped("Tx", func(c *Container) *tx {
+				c.OnClose(func(err error) error {
+					log = append(log, fmt.Sprint("tx ", err))
+					return tt.hookErr
+				})
+				if tt.hookErr != nil {
+					c.OnClose(func(err error) error { panic("rollback") })
+				}
+				return &tx{}
+			})
+			c.ProvideScoped("Lock", func(c *Container) *tx { return &tx{} })
+			c.ProvideTransient("Request", func(c *Container) (*config, error) {
+				if _, err := c.Resolve("Tx"); err != nil {
+					return nil, err
+				}
+				c.OnClose(func(err error) error {
+					log = append(log, fmt.Sprint("request ", err))
+					return nil
+				})
+				return &config{}, nil
+			})
+
+			scope := c.NewScope(context.Background())
+			if _, err := scope.Resolve("Request"); err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if len(log) != 0 {
+				t.Fatalf("hooks ran before Close: %v", log)
+			}
+
+			err := scope.Close(tt.closeWith)
+			if fmt.Sprint(err) != fmt.Sprint(errOrNil(tt.wantErr)) {
+				t.Fatalf("Close error %v, want %q", err, tt.wantErr)
+			}
+			// Last registered first
+			if !reflect.DeepEqual(log, tt.wantLog) {
+				t.Fatalf("hooks ran %q, want %q", log, tt.wantLog)
+			}
+
+			if err := scope.Close(nil); err != nil || len(log) != len(tt.wantLog) {
+				t.Fatalf("second Close = %v and ran %q, want nothing", err, log)
+			}
+			// Nothing new is built once closed
+			for _, name := range []string{"Lock", "Request"} {
+				if _, err := scope.Resolve(name); err == nil || !strings.Contains(err.Error(), "scope is closed") {
+					t.Fatalf("Resolve %s after Close error %v, want scope is closed", name, err)
+				}
+			}
+		})
+	}
+}
+
+func errOrNil(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	return errors.New(msg)
+}
+
+func TestCloseRoot(t *testing.T) {
+	c := NewContainer()
+	var closed []string
+	c.ProvideFactory("DB", func(c *Container) *database {
+		c.OnClose(func(err error) error {
+			closed = append(closed, "DB")
+			return nil
+		})
+		return &database{}
+	})
+	c.ProvideScoped("Tx", func(c *Container) (*tx, error) {
+		if _, err := c.Resolve("DB"); err != nil {
+			return nil, err
+		}
+		c.OnClose(func(err error) error {
+			closed = append(closed, "Tx")
+			return nil
+		})
+		return &tx{}, nil
+	})
+
+	scope := c.NewScope(context.Background())
+	if _, err := scope.Resolve("Tx"); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	// The singleton outlives the scope
+	if err := scope.Close(nil); err != nil || !reflect.DeepEqual(closed, []string{"Tx"}) {
+		t.Fatalf("scope Close = %v and closed %v, want [Tx]", err, closed)
+	}
+	if err := c.Close(nil); err != nil || !reflect.DeepEqual(closed, []string{"Tx", "DB"}) {
+		t.Fatalf("root Close = %v and closed %v, want [Tx DB]", err, closed)
+	}
+}
+
+type store interface {
+	Get(key string) string
+}
+
+type memStore struct{ name string }
+
+func (s *memStore) Get(key string) string { return s.name }
+
+type service struct {
+	Config  *config   `inject:""`
+	Store   store     `inject:""`
+	Primary *memStore `inject:"primary"`
+	Named   *config   `inject:"Config"`
+	Missing *tx       `inject:""`
+	Plain   *config
+	hidden  *config `inject:""`
+}
+
+func TestInject(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(c *Container) *Container
+		want    service
+		wantErr string
+	}{
+		{
+			name: "by type and name",
+			setup: func(c *Container) *Container {
+				c.Provide("Config", &config{DSN: "a"})
+				c.Provide("primary", &memStore{name: "primary"})
+				return c
+			},
+			want: service{
+				Config:  &config{DSN: "a"},
+				Store:   &memStore{name: "primary"},
+				Primary: &memStore{name: "primary"},
+				Named:   &config{DSN: "a"},
+			},
+		},
+		{
+			name: "factories match by declared type",
+			setup: func(c *Container) *Container {
+				c.ProvideFactory("Config", func(c *Container) *config { return &config{DSN: "f"} })
+				c.ProvideFactory("Store", func(c *Container) store { return &memStore{name: "f"} })
+				return c
+			},
+			want: service{Config: &config{DSN: "f"}, Store: &memStore{name: "f"}, Named: &config{DSN: "f"}},
+		},
+		{
+			name: "ambiguous",
+			setup: func(c *Container) *Container {
+				c.Provide("Config", &config{})
+				c.Provide("primary", &memStore{name: "primary"})
+				c.ProvideFactory("replica", func(c *Container) *memStore { return &memStore{name: "replica"} })
+				return c
+			},
+			want: service{
+				Config:  &config{},
+				Primary: &memStore{name: "primary"},
+				Named:   &config{},
+			},
+			wantErr: "inject service.Store: ambiguous dependency of type core.store: primary, replica all match",
+		},
+		{
+			name: "scope instances come first",
+			setup: func(c *Container) *Container {
+				c.Provide("Config", &config{DSN: "root"})
+				c.Provide("primary", &memStore{name: "primary"})
+				c.Provide("replica", &memStore{name: "replica"})
+				s := c.NewScope(context.Background())
+				s.Provide("Request", &config{DSN: "scope"})
+				return s
+			},
+			want: service{
+				Config:  &config{DSN: "scope"},
+				Primary: &memStore{name: "primary"},
+				Named:   &config{DSN: "root"},
+			},
+			wantErr: "inject service.Store: ambiguous dependency",
+		},
+		{
+			name: "wrong type",
+			setup: func(c *Container) *Container {
+				c.Provide("primary", &config{})
+				return c
+			},
+			want:    service{Config: &config{}},
+			wantErr: "inject service.Primary: dependency primary is *core.config, not *core.memStore",
+		},
+		{
+			name: "failed factory",
+			setup: func(c *Container) *Container {
+				c.ProvideFactory("Config", func(c *Container) (*config, error) { return nil, errors.New("down") })
+				return c
+			},
+			wantErr: "inject service.Config: build Config: down\ninject service.Named: build Config: down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.setup(NewContainer())
+
+			var got service
+			err := c.Inject(&got)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Inject: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Inject error %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Inject = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmbiguousError(t *testing.T) {
+	c := NewContainer()
+	c.Provide("b", &memStore{})
+	var got struct {
+		Store store `inject:""`
+	}
+	if err := c.Inject(&got); err != nil || got.Store == nil {
+		t.Fatalf("Inject = %v, %v, want the only store", got.Store, err)
+	}
+
+	// Registering another implementation invalidates the earlier match
+	c.Provide("a", &memStore{})
+	got.Store = nil
+	err := c.Inject(&got)
+	var ae *AmbiguousError
+	if !errors.As(err, &ae) || !reflect.DeepEqual(ae.Names, []string{"a", "b"}) || ae.Type != reflect.TypeFor[store]() {
+		t.Fatalf("Inject error %v, want AmbiguousError for a and b", err)
+	}
+	if got.Store != nil {
+		t.Fatalf("ambiguous field set to %v, want it unset", got.Store)
+	}
+
+	if err := c.Inject(got); err != nil {
+		t.Fatalf("Inject of a non-pointer = %v, want nil", err)
+	}
+}
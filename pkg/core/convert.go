@@ -0,0 +1,157 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Assign sets dst from a payload value, converting between representations
+// when the types differ:
+//   - strings are parsed like bound values, including registered converters
+//     and encoding.TextUnmarshaler; slice and array targets are split on sep
+//     first (see Separator)
+//   - pointer targets are allocated and the value assigned to their element
+//   - slices and arrays are converted element by element
+//   - numbers are converted across kinds when no precision is lost
+//   - maps and structs fill struct targets field by field (see ApplyPayload)
+//
+// A nil or invalid src leaves dst untouched.
+func (b *Binder) Assign(dst reflect.Value, src reflect.Value, sep string) error {
+	for src.IsValid() && src.Kind() == reflect.Interface {
+		src = src.Elem()
+	}
+	if !src.IsValid() {
+		return nil
+	}
+
+	dstType := dst.Type()
+	if src.Type().AssignableTo(dstType) {
+		dst.Set(src)
+		return nil
+	}
+
+	if src.Kind() == reflect.String {
+		if b.isMulti(dstType) {
+			return b.multiSetterFor(dstType)(dst, splitValues([]string{src.String()}, sep))
+		}
+		return b.setterFor(dstType)(dst, src.String())
+	}
+
+	if dstType.Kind() == reflect.Ptr {
+		ptr := reflect.New(dstType.Elem())
+		if err := b.Assign(ptr.Elem(), src, sep); err != nil {
+			return err
+		}
+		dst.Set(ptr)
+		return nil
+	}
+
+	switch src.Kind() {
+	case reflect.Slice, reflect.Array:
+		if b.isMulti(dstType) {
+			return b.assignElements(dst, src)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if isNumber(dstType.Kind()) {
+			return assignNumber(dst, src)
+		}
+	}
+
+	if src.Kind() == dstType.Kind() && src.Type().ConvertibleTo(dstType) {
+		dst.Set(src.Convert(dstType))
+		return nil
+	}
+
+	if dstType.Kind() == reflect.Struct && (src.Kind() == reflect.Map || src.Kind() == reflect.Struct) {
+		return b.applyFields(dst, src)
+	}
+
+	return fmt.Errorf("cannot assign %s to %s", src.Type(), dstType)
+}
+
+func (b *Binder) assignElements(dst, src reflect.Value) error {
+	n := src.Len()
+
+	if dst.Kind() == reflect.Array {
+		if n > dst.Len() {
+			return fmt.Errorf("expected at most %d values, got %d", dst.Len(), n)
+		}
+		dst.SetZero()
+		for i := 0; i < n; i++ {
+			if err := b.Assign(dst.Index(i), src.Index(i), ""); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+
+	slice := reflect.MakeSlice(dst.Type(), n, n)
+	for i := 0; i < n; i++ {
+		if err := b.Assign(slice.Index(i), src.Index(i), ""); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+	dst.Set(slice)
+	return nil
+}
+
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// assignNumber converts between numeric kinds, rejecting fractional values
+// for integer targets and values that overflow the target.
+func assignNumber(dst, src reflect.Value) error {
+	if src.CanInt() && dst.CanInt() {
+		if dst.OverflowInt(src.Int()) {
+			return fmt.Errorf("cannot assign %d to %s", src.Int(), dst.Type())
+		}
+		dst.SetInt(src.Int())
+		return nil
+	}
+	if src.CanUint() && dst.CanUint() {
+		if dst.OverflowUint(src.Uint()) {
+			return fmt.Errorf("cannot assign %d to %s", src.Uint(), dst.Type())
+		}
+		dst.SetUint(src.Uint())
+		return nil
+	}
+
+	var f float64
+	switch {
+	case src.CanInt():
+		f = float64(src.Int())
+	case src.CanUint():
+		f = float64(src.Uint())
+	default:
+		f = src.Float()
+	}
+
+	switch {
+	case dst.CanInt():
+		if f != math.Trunc(f) || dst.OverflowInt(int64(f)) {
+			return fmt.Errorf("cannot assign %v to %s", f, dst.Type())
+		}
+		dst.SetInt(int64(f))
+	case dst.CanUint():
+		if f < 0 || f != math.Trunc(f) || dst.OverflowUint(uint64(f)) {
+			return fmt.Errorf("cannot assign %v to %s", f, dst.Type())
+		}
+		dst.SetUint(uint64(f))
+	default:
+		if dst.OverflowFloat(f) {
+			return fmt.Errorf("cannot assign %v to %s", f, dst.Type())
+		}
+		dst.SetFloat(f)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package core
+
+// Payloader is implemented by errors that choose their own response body.
+// The HTTP transport writes the payload as JSON instead of a problem
+// document, unless the error is also a ProblemProvider. Like StatusCoder,
+// it is looked up through wrapped errors with errors.As.
+type Payloader interface {
+	Payload() any
+}
+
+// ErrorMapper translates an error before a transport classifies it, e.g.
+// to turn driver errors into domain errors. It returns err itself to keep
+// it unchanged.
+type ErrorMapper func(err error) error
+
+// ErrorDeclarer is implemented by handlers that list the errors they may
+// return. The OpenAPI generator documents a response for each of them.
+type ErrorDeclarer interface {
+	Errors() []error
+}
+
+// Category is a transport-neutral error class, derived from the status
+// code of an error's problem. Non-HTTP transports report it instead of a
+// status code.
+type Category string
+
+const (
+	CategoryInvalid         Category = "invalid"
+	CategoryUnauthenticated Category = "unauthenticated"
+	CategoryForbidden       Category = "forbidden"
+	CategoryNotFound        Category = "not_found"
+	CategoryConflict        Category = "conflict"
+	CategoryRateLimited     Category = "rate_limited"
+	CategoryTimeout         Category = "timeout"
+	CategoryUnavailable     Category = "unavailable"
+	CategoryInternal        Category = "internal"
+)
+
+// CategoryFor returns the category of a status code. Unlisted 4xx codes
+// are CategoryInvalid, everything else CategoryInternal.
+func CategoryFor(status int) Category {
+	switch status {
+	case 401:
+		return CategoryUnauthenticated
+	case 403:
+		return CategoryForbidden
+	case 404, 410:
+		return CategoryNotFound
+	case 409, 412:
+		return CategoryConflict
+	case 429:
+		return CategoryRateLimited
+	case 408, 504:
+		return CategoryTimeout
+	case 503:
+		return CategoryUnavailable
+	}
+	if status >= 400 && status < 500 {
+		return CategoryInvalid
+	}
+	return CategoryInternal
+}
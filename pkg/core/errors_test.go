@@ -0,0 +1,32 @@
+package core
+
+import "testing"
+
+func TestCategoryFor(t *testing.T) {
+	tests := []struct {
+		status int
+		want   Category
+	}{
+		{400, CategoryInvalid},
+		{401, CategoryUnauthenticated},
+		{403, CategoryForbidden},
+		{404, CategoryNotFound},
+		{408, CategoryTimeout},
+		{409, CategoryConflict},
+		{410, CategoryNotFound},
+		{412, CategoryConflict},
+		{413, CategoryInvalid},
+		{422, CategoryInvalid},
+		{429, CategoryRateLimited},
+		{500, CategoryInternal},
+		{503, CategoryUnavailable},
+		{504, CategoryTimeout},
+		{200, CategoryInternal},
+	}
+
+	for _, tt := range tests {
+		if got := CategoryFor(tt.status); got != tt.want {
+			t.Errorf("CategoryFor(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
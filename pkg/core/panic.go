@@ -0,0 +1,62 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+)
+
+// PanicError is a panic recovered from a handler. It always maps to a 500,
+// so it does not unwrap to the panic value even when that is an error.
+type PanicError struct {
+	// Endpoint is the route ("POST /users") or action ("file.save").
+	Endpoint string
+	// Handler is the name of the handler type.
+	Handler string
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s (%s): %v", e.Handler, e.Endpoint, e.Value)
+}
+
+// StatusCode returns 500 Internal Server Error.
+func (e *PanicError) StatusCode() int {
+	return 500
+}
+
+// PanicReporter receives the panics transports recover from handlers.
+type PanicReporter func(ctx context.Context, p *PanicError)
+
+// SafeHandle calls h.Handle and turns a panic into a *PanicError.
+func SafeHandle(ctx context.Context, h Handler, endpoint string) (res any, err error) {
+	defer RecoverPanic(endpoint, h, &err)
+	return h.Handle(ctx)
+}
+
+// RecoverPanic turns a panic of the calling function into a *PanicError
+// stored in err. It must be deferred directly:
+//
+//	defer core.RecoverPanic("file.save", h, &err)
+func RecoverPanic(endpoint string, h any, err *error) {
+	if v := recover(); v != nil {
+		*err = &PanicError{
+			Endpoint: endpoint,
+			Handler:  handlerName(h),
+			Value:    v,
+			Stack:    debug.Stack(),
+		}
+	}
+}
+
+func handlerName(h any) string {
+	typ := reflect.TypeOf(h)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.String()
+}
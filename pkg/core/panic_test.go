@@ -0,0 +1,87 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/logger"
+)
+
+type panicHandler struct {
+	value any
+}
+
+func (h *panicHandler) Handle(ctx context.Context) (any, error) {
+	if h.value != nil {
+		panic(h.value)
+	}
+	return "done", nil
+}
+
+func TestSafeHandle(t *testing.T) {
+	cause := errors.New("disk on fire")
+
+	tests := []struct {
+		name      string
+		value     any
+		wantRes   any
+		wantError string
+	}{
+		{name: "no panic", wantRes: "done"},
+		{name: "string", value: "boom", wantError: "panic in core.panicHandler (file.save): boom"},
+		{name: "error", value: cause, wantError: "panic in core.panicHandler (file.save): disk on fire"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := SafeHandle(context.Background(), &panicHandler{value: tt.value}, "file.save")
+			if tt.wantError == "" {
+				if err != nil || res != tt.wantRes {
+					t.Fatalf("SafeHandle = %v, %v, want %v", res, err, tt.wantRes)
+				}
+				return
+			}
+
+			var pe *PanicError
+			if !errors.As(err, &pe) {
+				t.Fatalf("SafeHandle error %#v, want a *PanicError", err)
+			}
+			if err.Error() != tt.wantError {
+				t.Fatalf("Error() = %q, want %q", err.Error(), tt.wantError)
+			}
+			if pe.Endpoint != "file.save" || pe.Handler != "core.panicHandler" || pe.Value != tt.value {
+				t.Fatalf("PanicError %+v", pe)
+			}
+			if !strings.Contains(string(pe.Stack), "panicHandler") {
+				t.Fatalf("stack does not show the handler:\n%s", pe.Stack)
+			}
+			if pe.StatusCode() != 500 || errors.Is(err, cause) {
+				t.Fatal("PanicError must map to 500 and not unwrap to the panic value")
+			}
+		})
+	}
+}
+
+func TestReportPanic(t *testing.T) {
+	pe := &PanicError{Endpoint: "file.save", Handler: "core.panicHandler", Value: "boom", Stack: []byte("stack")}
+
+	var reported *PanicError
+	var logs bytes.Buffer
+	log := logger.NewSlog(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	ReportPanic(context.Background(), pe, func(ctx context.Context, p *PanicError) { reported = p }, log, "Action", "action")
+	if reported != pe || logs.Len() > 0 {
+		t.Fatalf("reporter got %v and logged %q, want the panic reported only", reported, logs.String())
+	}
+
+	ReportPanic(context.Background(), pe, nil, log, "Action", "action")
+	for _, want := range []string{`msg="Action panicked"`, "action=file.save", "handler=core.panicHandler", "panic=boom", "stack=stack"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Fatalf("log %q does not contain %q", logs.String(), want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ApplyPayload maps a payload onto the fields of target, a pointer to a
+// struct. The payload can be a map with string keys or a struct; entries
+// are matched to fields by name (case-insensitive) or json tag, and values
+// are converted with Assign. Nested maps fill struct fields the same way.
+// Unknown entries are ignored, and so are entries matching the Pattern,
+// fields tagged inject or json:"-", which the payload cannot set.
+func (b *Binder) ApplyPayload(target any, payload any) error {
+	dst := reflect.ValueOf(target)
+	if dst.Kind() != reflect.Ptr || dst.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("payload target must be a pointer to a struct, got %T", target)
+	}
+	return b.applyFields(dst.Elem(), reflect.ValueOf(payload))
+}
+
+func (b *Binder) applyFields(dst, src reflect.Value) error {
+	for src.IsValid() && (src.Kind() == reflect.Ptr || src.Kind() == reflect.Interface) {
+		src = src.Elem()
+	}
+
+	switch src.Kind() {
+	case reflect.Map:
+		for _, key := range src.MapKeys() {
+			k := fmt.Sprintf("%v", key.Interface())
+			if err := b.setFieldByNameOrTag(dst, k, src.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		srcType := src.Type()
+		for i := 0; i < src.NumField(); i++ {
+			field := srcType.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if err := b.setFieldByNameOrTag(dst, field.Name, src.Field(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *Binder) setFieldByNameOrTag(dst reflect.Value, name string, val reflect.Value) error {
+	dstType := dst.Type()
+	for i := 0; i < dst.NumField(); i++ {
+		fieldMeta := dstType.Field(i)
+		field := dst.Field(i)
+
+		if !field.CanSet() || !PayloadField(fieldMeta) {
+			continue
+		}
+
+		// Match by name or json tag
+		tag, _, _ := strings.Cut(fieldMeta.Tag.Get("json"), ",")
+		if strings.EqualFold(fieldMeta.Name, name) || (tag != "" && tag == name) {
+			if err := b.Assign(field, val, Separator(fieldMeta)); err != nil {
+				return fmt.Errorf("field %s: %w", fieldMeta.Name, err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// PayloadField reports whether a payload may set field: dependencies and
+// routing metadata are not input. Transports that decode messages into
+// handlers use it to leave such fields alone.
+func PayloadField(field reflect.StructField) bool {
+	if field.Type == patternType {
+		return false
+	}
+	if _, ok := field.Tag.Lookup("inject"); ok {
+		return false
+	}
+	return field.Tag.Get("json") != "-"
+}
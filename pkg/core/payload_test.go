@@ -0,0 +1,158 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type payloadConfig struct {
+	Admin bool
+}
+
+type payloadTarget struct {
+	Meta    Pattern        `action:"users.update"`
+	Name    string         `json:"name"`
+	Age     int            `json:"age"`
+	Role    string         `json:"-"`
+	Config  *payloadConfig `inject:"Config"`
+	Service *payloadConfig `inject:""`
+	Address struct {
+		City   string `json:"city"`
+		Secret string `json:"-"`
+	} `json:"address"`
+}
+
+func TestApplyPayload(t *testing.T) {
+	injected := &payloadConfig{}
+
+	tests := []struct {
+		name    string
+		payload any
+		want    func(*payloadTarget) bool
+	}{
+		{
+			name:    "json tag and case-insensitive name",
+			payload: map[string]any{"name": "ada", "AGE": 36},
+			want:    func(p *payloadTarget) bool { return p.Name == "ada" && p.Age == 36 },
+		},
+		{
+			name:    "struct payload",
+			payload: struct{ Name string }{Name: "grace"},
+			want:    func(p *payloadTarget) bool { return p.Name == "grace" },
+		},
+		{
+			name:    "inject fields are not input",
+			payload: map[string]any{"config": map[string]any{"admin": true}, "service": map[string]any{"admin": true}},
+			want: func(p *payloadTarget) bool {
+				return p.Config == injected && p.Service == injected && !injected.Admin
+			},
+		},
+		{
+			name:    "json dash fields are not input",
+			payload: map[string]any{"role": "admin", "Role": "admin"},
+			want:    func(p *payloadTarget) bool { return p.Role == "user" },
+		},
+		{
+			name:    "pattern is not input",
+			payload: map[string]any{"meta": map[string]any{}},
+			want:    func(p *payloadTarget) bool { return reflect.DeepEqual(p.Meta, Pattern{}) },
+		},
+		{
+			name:    "nested json dash fields are not input",
+			payload: map[string]any{"address": map[string]any{"city": "Rome", "secret": "x"}},
+			want:    func(p *payloadTarget) bool { return p.Address.City == "Rome" && p.Address.Secret == "" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := &payloadTarget{Role: "user", Config: injected, Service: injected}
+			if err := NewBinder().ApplyPayload(target, tt.payload); err != nil {
+				t.Fatalf("ApplyPayload: %v", err)
+			}
+			if !tt.want(target) {
+				t.Fatalf("unexpected result: %+v", target)
+			}
+		})
+	}
+}
+
+func TestApplyPayloadRejectsNonStruct(t *testing.T) {
+	var n int
+	if err := NewBinder().ApplyPayload(&n, map[string]any{}); err == nil {
+		t.Fatal("expected an error for a non-struct target")
+	}
+}
+
+func TestApplyPayloadConversions(t *testing.T) {
+	type target struct {
+		Tags  []string `json:"tags"`
+		IDs   []int    `json:"ids"`
+		Pair  [2]int   `json:"pair" sep:"|"`
+		Count uint8    `json:"count"`
+		Ratio float32  `json:"ratio"`
+	}
+
+	tests := []struct {
+		name    string
+		payload map[string]any
+		want    target
+		wantErr string
+	}{
+		{
+			name:    "strings are split",
+			payload: map[string]any{"tags": "draft, review", "pair": "1|2"},
+			want:    target{Tags: []string{"draft", "review"}, Pair: [2]int{1, 2}},
+		},
+		{
+			name:    "slices are converted element by element",
+			payload: map[string]any{"tags": []any{"a"}, "ids": []any{1.0, 2.0}, "pair": []int64{3, 4}},
+			want:    target{Tags: []string{"a"}, IDs: []int{1, 2}, Pair: [2]int{3, 4}},
+		},
+		{
+			name:    "numbers across kinds",
+			payload: map[string]any{"count": 200.0, "ratio": 2},
+			want:    target{Count: 200, Ratio: 2},
+		},
+		{name: "precision lost", payload: map[string]any{"ids": []any{1.5}}, wantErr: "element 0: cannot assign 1.5 to int"},
+		{name: "out of range", payload: map[string]any{"count": 300}, wantErr: "cannot assign 300 to uint8"},
+		{name: "too many array values", payload: map[string]any{"pair": []int{1, 2, 3}}, wantErr: "expected at most 2 values, got 3"},
+		{name: "unconvertible", payload: map[string]any{"ids": map[string]any{}}, wantErr: "cannot assign"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got target
+			err := NewBinder().ApplyPayload(&got, tt.payload)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ApplyPayload error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyPayload: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ApplyPayload = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPayloadConverter(t *testing.T) {
+	var got struct {
+		Level  level   `json:"level"`
+		Levels []level `json:"levels"`
+	}
+	b := NewBinder()
+	b.RegisterConverter(reflect.TypeOf(level(0)), parseLevel)
+
+	if err := b.ApplyPayload(&got, map[string]any{"level": "error", "levels": "debug,error"}); err != nil {
+		t.Fatalf("ApplyPayload: %v", err)
+	}
+	if got.Level != 2 || !reflect.DeepEqual(got.Levels, []level{0, 2}) {
+		t.Fatalf("ApplyPayload = %+v", got)
+	}
+}
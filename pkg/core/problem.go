@@ -0,0 +1,228 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ProblemContentType is the media type of encoded problems.
+const ProblemContentType = "application/problem+json"
+
+// Sentinel errors mapped to status codes by every ProblemMapper.
+// Wrap them to keep context: fmt.Errorf("user %s: %w", id, core.ErrNotFound).
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+)
+
+// Problem is an RFC 9457 problem details object. It is an error, so
+// handlers can return it directly:
+//
+//	return nil, core.NewProblem(409, "email already registered").
+//		With("email", req.Email)
+//
+// Extensions are encoded as top-level members next to the standard ones.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]any
+}
+
+// NewProblem creates a problem with the standard title for status.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Status: status, Title: http.StatusText(status), Detail: detail}
+}
+
+// With sets an extension member and returns the problem.
+func (p *Problem) With(key string, value any) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]any)
+	}
+	p.Extensions[key] = value
+	return p
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	if p.Title != "" {
+		return p.Title
+	}
+	return http.StatusText(p.StatusCode())
+}
+
+// StatusCode returns the problem status, or 500 when unset.
+func (p *Problem) StatusCode() int {
+	if p.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return p.Status
+}
+
+// MarshalJSON encodes the problem with its extensions inlined. Standard
+// members take precedence over extensions with the same name.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	set := func(key, value string) {
+		if value != "" {
+			m[key] = value
+		} else {
+			delete(m, key)
+		}
+	}
+	set("type", p.Type)
+	set("title", p.Title)
+	set("detail", p.Detail)
+	set("instance", p.Instance)
+	m["status"] = p.StatusCode()
+	return json.Marshal(m)
+}
+
+// ProblemProvider is implemented by errors that describe themselves as a
+// problem, such as ValidationError and BodyError.
+type ProblemProvider interface {
+	Problem() *Problem
+}
+
+// ProblemMapper turns errors into problems. Errors are resolved in order:
+//
+//  1. a *Problem or ProblemProvider in the chain (errors.As)
+//  2. rules added with Map and MapFunc, most recent first
+//  3. the built-in sentinels and context.DeadlineExceeded
+//  4. a StatusCoder in the chain
+//  5. 500 Internal Server Error
+//
+// Unless Debug is set, 5xx problems derived from an error carry no detail,
+// so internal messages do not reach clients. Problems built explicitly by
+// the handler are never redacted.
+type ProblemMapper struct {
+	// Debug exposes error messages of 5xx problems in their detail.
+	Debug bool
+
+	mu    sync.RWMutex
+	rules []func(error) *Problem
+}
+
+// NewProblemMapper creates a mapper with the built-in rules.
+func NewProblemMapper() *ProblemMapper {
+	return &ProblemMapper{}
+}
+
+// Map maps errors matching target (errors.Is) to status.
+func (m *ProblemMapper) Map(target error, status int) {
+	m.MapFunc(func(err error) *Problem {
+		if errors.Is(err, target) {
+			return &Problem{Status: status}
+		}
+		return nil
+	})
+}
+
+// MapFunc adds a rule. fn returns nil for errors it does not handle. The
+// returned problem's detail defaults to the error message, subject to the
+// 5xx redaction.
+func (m *ProblemMapper) MapFunc(fn func(error) *Problem) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules = append(m.rules, fn)
+}
+
+// MapAs adds a rule for errors of type T found with errors.As:
+//
+//	core.MapAs(m, func(e *RateLimitError) *core.Problem {
+//		return core.NewProblem(429, "slow down").With("retryAfter", e.Seconds)
+//	})
+func MapAs[T error](m *ProblemMapper, fn func(T) *Problem) {
+	m.MapFunc(func(err error) *Problem {
+		var target T
+		if errors.As(err, &target) {
+			return fn(target)
+		}
+		return nil
+	})
+}
+
+var builtinProblems = []struct {
+	target error
+	status int
+}{
+	{ErrBadRequest, http.StatusBadRequest},
+	{ErrUnauthorized, http.StatusUnauthorized},
+	{ErrForbidden, http.StatusForbidden},
+	{ErrNotFound, http.StatusNotFound},
+	{ErrConflict, http.StatusConflict},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout},
+}
+
+// Problem returns the problem describing err. The result is a copy and
+// can be modified freely.
+func (m *ProblemMapper) Problem(err error) *Problem {
+	var explicit *Problem
+	var provider ProblemProvider
+	switch {
+	case errors.As(err, &explicit):
+		return explicit.clone()
+	case errors.As(err, &provider):
+		return provider.Problem().clone()
+	}
+
+	p := m.mapped(err)
+	if p == nil {
+		p = &Problem{Status: http.StatusInternalServerError}
+		var sc StatusCoder
+		if errors.As(err, &sc) {
+			p.Status = sc.StatusCode()
+		}
+	}
+	p = p.clone()
+
+	if p.Title == "" {
+		p.Title = http.StatusText(p.StatusCode())
+	}
+	if p.Detail == "" && (p.StatusCode() < 500 || m.Debug) {
+		p.Detail = err.Error()
+	}
+	return p
+}
+
+func (m *ProblemMapper) mapped(err error) *Problem {
+	m.mu.RLock()
+	for i := len(m.rules) - 1; i >= 0; i-- {
+		if p := m.rules[i](err); p != nil {
+			m.mu.RUnlock()
+			return p
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, b := range builtinProblems {
+		if errors.Is(err, b.target) {
+			return &Problem{Status: b.status}
+		}
+	}
+	return nil
+}
+
+func (p *Problem) clone() *Problem {
+	c := *p
+	if p.Extensions != nil {
+		c.Extensions = make(map[string]any, len(p.Extensions))
+		for k, v := range p.Extensions {
+			c.Extensions[k] = v
+		}
+	}
+	return &c
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var errQuota = errors.New("quota exceeded")
+
+type rateLimitError struct {
+	seconds int
+}
+
+func (e *rateLimitError) Error() string { return "rate limited" }
+
+type teapotError struct{}
+
+func (teapotError) Error() string   { return "short and stout" }
+func (teapotError) StatusCode() int { return 418 }
+
+func TestProblemMapper(t *testing.T) {
+	m := NewProblemMapper()
+	m.Map(errQuota, 429)
+	MapAs(m, func(e *rateLimitError) *Problem {
+		return NewProblem(429, "slow down").With("retryAfter", e.seconds)
+	})
+	// Most recent rule first
+	m.Map(ErrNotFound, 410)
+
+	tests := []struct {
+		name string
+		err  error
+		want *Problem
+	}{
+		{
+			name: "explicit problem",
+			err:  NewProblem(409, "email taken").With("email", "a@b.c"),
+			want: &Problem{Status: 409, Title: "Conflict", Detail: "email taken", Extensions: map[string]any{"email": "a@b.c"}},
+		},
+		{
+			name: "wrapped explicit problem",
+			err:  fmt.Errorf("create: %w", NewProblem(503, "maintenance")),
+			want: &Problem{Status: 503, Title: "Service Unavailable", Detail: "maintenance"},
+		},
+		{
+			name: "provider",
+			err:  &ValidationError{Errors: []FieldError{{Field: "name", Rule: "required", Message: "is required"}}},
+			want: &Problem{Status: 422, Title: "Unprocessable Entity", Detail: "validation failed", Extensions: map[string]any{
+				"errors": []FieldError{{Field: "name", Rule: "required", Message: "is required"}},
+			}},
+		},
+		{
+			name: "Map rule",
+			err:  fmt.Errorf("upload: %w", errQuota),
+			want: &Problem{Status: 429, Title: "Too Many Requests", Detail: "upload: quota exceeded"},
+		},
+		{
+			name: "MapAs rule",
+			err:  fmt.Errorf("call: %w", &rateLimitError{seconds: 30}),
+			want: &Problem{Status: 429, Title: "Too Many Requests", Detail: "slow down", Extensions: map[string]any{"retryAfter": 30}},
+		},
+		{
+			name: "rule overrides sentinel",
+			err:  fmt.Errorf("user 7: %w", ErrNotFound),
+			want: &Problem{Status: 410, Title: "Gone", Detail: "user 7: not found"},
+		},
+		{
+			name: "sentinel",
+			err:  fmt.Errorf("token: %w", ErrUnauthorized),
+			want: &Problem{Status: 401, Title: "Unauthorized", Detail: "token: unauthorized"},
+		},
+		{
+			name: "deadline",
+			err:  fmt.Errorf("query: %w", context.DeadlineExceeded),
+			want: &Problem{Status: 504, Title: "Gateway Timeout"},
+		},
+		{
+			name: "status coder",
+			err:  fmt.Errorf("brew: %w", teapotError{}),
+			want: &Problem{Status: 418, Title: "I'm a teapot", Detail: "brew: short and stout"},
+		},
+		{
+			name: "internal detail hidden",
+			err:  errors.New("password is hunter2"),
+			want: &Problem{Status: 500, Title: "Internal Server Error"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := m.Problem(tt.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Problem = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProblemMapperDebug(t *testing.T) {
+	m := NewProblemMapper()
+	m.Debug = true
+	if got := m.Problem(errors.New("password is hunter2")); got.Detail != "password is hunter2" {
+		t.Fatalf("Problem detail %q in debug mode, want the error message", got.Detail)
+	}
+}
+
+func TestProblemIsCopied(t *testing.T) {
+	orig := NewProblem(409, "taken").With("email", "a@b.c")
+	m := NewProblemMapper()
+
+	got := m.Problem(orig)
+	got.Detail = "changed"
+	got.With("email", "x@y.z")
+	if orig.Detail != "taken" || orig.Extensions["email"] != "a@b.c" {
+		t.Fatalf("changing the mapped problem changed the original: %+v", orig)
+	}
+}
+
+func TestProblemMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		problem *Problem
+		want    string
+	}{
+		{
+			name:    "standard members",
+			problem: &Problem{Type: "https://example.com/probs/out-of-credit", Title: "Forbidden", Status: 403, Detail: "no credit", Instance: "/account/1"},
+			want:    `{"detail":"no credit","instance":"/account/1","status":403,"title":"Forbidden","type":"https://example.com/probs/out-of-credit"}`,
+		},
+		{
+			name:    "empty members omitted and status defaulted",
+			problem: &Problem{},
+			want:    `{"status":500}`,
+		},
+		{
+			name:    "extensions inlined",
+			problem: NewProblem(403, "no credit").With("balance", 30),
+			want:    `{"balance":30,"detail":"no credit","status":403,"title":"Forbidden"}`,
+		},
+		{
+			name:    "standard members win",
+			problem: NewProblem(404, "").With("status", 200).With("title", "ok").With("detail", "hidden"),
+			want:    `{"status":404,"title":"Not Found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.problem)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("Marshal = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProblemError(t *testing.T) {
+	tests := []struct {
+		problem *Problem
+		want    string
+	}{
+		{problem: NewProblem(409, "taken"), want: "taken"},
+		{problem: NewProblem(409, ""), want: "Conflict"},
+		{problem: &Problem{}, want: "Internal Server Error"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.problem.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
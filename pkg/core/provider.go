@@ -0,0 +1,75 @@
+package core
+
+import (
+	"context"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/logger"
+)
+
+// Provider registers dependencies in a container. Transports embed it, so
+// they all offer the same Provide methods.
+type Provider struct {
+	container *Container
+}
+
+// NewProvider returns a Provider registering dependencies in c.
+func NewProvider(c *Container) Provider {
+	return Provider{container: c}
+}
+
+// Container returns the container dependencies are registered in.
+func (p Provider) Container() *Container {
+	return p.container
+}
+
+// Provide registers a dependency.
+func (p Provider) Provide(name string, instance any) {
+	p.container.Provide(name, instance)
+}
+
+// ProvideFactory registers a dependency built on first use.
+// See Container.ProvideFactory.
+func (p Provider) ProvideFactory(name string, factory any) {
+	p.container.ProvideFactory(name, factory)
+}
+
+// ProvideScoped registers a dependency built once per handler call.
+// See Container.ProvideScoped.
+func (p Provider) ProvideScoped(name string, factory any) {
+	p.container.ProvideScoped(name, factory)
+}
+
+// ProvideTransient registers a dependency built every time it is injected.
+// See Container.ProvideTransient.
+func (p Provider) ProvideTransient(name string, factory any) {
+	p.container.ProvideTransient(name, factory)
+}
+
+// CloseScope closes scope with the handler error *err. A cleanup failure
+// becomes the error if the handler succeeded, and is logged otherwise.
+// When the handler can panic, defer CloseScope before RecoverPanic, so it
+// runs after it and sees the *PanicError:
+//
+//	defer core.CloseScope(scope, &err, log)
+//	defer core.RecoverPanic(endpoint, h, &err)
+func CloseScope(scope *Container, err *error, log logger.Logger) {
+	cerr := scope.Close(*err)
+	if cerr == nil {
+		return
+	}
+	if *err == nil {
+		*err = cerr
+		return
+	}
+	log.Error("Scope cleanup failed", "error", cerr)
+}
+
+// ReportPanic passes pe to report or, when it is nil, logs it with its
+// stack as "<kind> panicked", the endpoint under key.
+func ReportPanic(ctx context.Context, pe *PanicError, report PanicReporter, log logger.Logger, kind, key string) {
+	if report != nil {
+		report(ctx, pe)
+		return
+	}
+	log.Error(kind+" panicked", key, pe.Endpoint, "handler", pe.Handler, "panic", pe.Value, "stack", string(pe.Stack))
+}
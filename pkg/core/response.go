@@ -0,0 +1,80 @@
+package core
+
+// Response is a handler result that carries transport metadata along with
+// its body. The HTTP transport honors the status, headers and content type;
+// other transports deliver Body only.
+//
+//	return core.Created("/users/"+u.ID, u), nil
+type Response struct {
+	Status int
+	Header map[string][]string
+	Type   string
+	Body   any
+}
+
+// StatusCoder is implemented by results that choose their status code.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// HeaderProvider is implemented by results that set response headers.
+type HeaderProvider interface {
+	Headers() map[string][]string
+}
+
+// ContentTyper is implemented by results that choose their content type.
+type ContentTyper interface {
+	ContentType() string
+}
+
+// Envelope is implemented by results that wrap the value to deliver.
+// Transports read the metadata of each layer and deliver the innermost value.
+type Envelope interface {
+	Unwrap() any
+}
+
+// NewResponse creates a response with the given status and body.
+func NewResponse(status int, body any) *Response {
+	return &Response{Status: status, Body: body}
+}
+
+// Created returns a 201 Created response with a Location header.
+func Created(location string, body any) *Response {
+	return NewResponse(201, body).WithHeader("Location", location)
+}
+
+// Accepted returns a 202 Accepted response.
+func Accepted(body any) *Response {
+	return NewResponse(202, body)
+}
+
+// WithHeader adds a header value and returns the response.
+func (r *Response) WithHeader(key, value string) *Response {
+	if r.Header == nil {
+		r.Header = make(map[string][]string)
+	}
+	r.Header[key] = append(r.Header[key], value)
+	return r
+}
+
+// WithType sets the content type and returns the response.
+func (r *Response) WithType(contentType string) *Response {
+	r.Type = contentType
+	return r
+}
+
+func (r *Response) StatusCode() int              { return r.Status }
+func (r *Response) Headers() map[string][]string { return r.Header }
+func (r *Response) ContentType() string          { return r.Type }
+func (r *Response) Unwrap() any                  { return r.Body }
+
+// Unwrap returns the innermost value of a result, unwrapping Envelopes.
+func Unwrap(v any) any {
+	for {
+		env, ok := v.(Envelope)
+		if !ok {
+			return v
+		}
+		v = env.Unwrap()
+	}
+}
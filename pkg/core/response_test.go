@@ -0,0 +1,68 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		resp       *Response
+		wantStatus int
+		wantHeader map[string][]string
+		wantType   string
+	}{
+		{name: "new", resp: NewResponse(200, "ok"), wantStatus: 200},
+		{name: "created", resp: Created("/users/7", "ok"), wantStatus: 201, wantHeader: map[string][]string{"Location": {"/users/7"}}},
+		{name: "accepted", resp: Accepted("ok"), wantStatus: 202},
+		{
+			name:       "headers accumulate",
+			resp:       NewResponse(200, "ok").WithHeader("Vary", "Accept").WithHeader("Vary", "Cookie"),
+			wantStatus: 200,
+			wantHeader: map[string][]string{"Vary": {"Accept", "Cookie"}},
+		},
+		{name: "type", resp: NewResponse(200, "ok").WithType("text/csv"), wantStatus: 200, wantType: "text/csv"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result any = tt.resp
+			if got := result.(StatusCoder).StatusCode(); got != tt.wantStatus {
+				t.Fatalf("StatusCode() = %d, want %d", got, tt.wantStatus)
+			}
+			if got := result.(HeaderProvider).Headers(); !reflect.DeepEqual(got, tt.wantHeader) {
+				t.Fatalf("Headers() = %v, want %v", got, tt.wantHeader)
+			}
+			if got := result.(ContentTyper).ContentType(); got != tt.wantType {
+				t.Fatalf("ContentType() = %q, want %q", got, tt.wantType)
+			}
+			if got := result.(Envelope).Unwrap(); got != "ok" {
+				t.Fatalf("Unwrap() = %v, want the body", got)
+			}
+		})
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	body := map[string]int{"id": 7}
+	tests := []struct {
+		name string
+		v    any
+		want any
+	}{
+		{name: "plain value", v: body, want: body},
+		{name: "nil", v: nil, want: nil},
+		{name: "response", v: Created("/users/7", body), want: body},
+		{name: "nested", v: NewResponse(201, Accepted(body)), want: body},
+		{name: "empty response", v: Accepted(nil), want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unwrap(tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Unwrap = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
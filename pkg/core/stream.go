@@ -0,0 +1,49 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// Event is one message of a stream. Transports that have no notion of
+// event ids or names, or of retry delays, deliver Data only.
+type Event struct {
+	// ID lets clients resume: the HTTP transport sends it as the SSE id,
+	// and reconnecting browsers send it back in the Last-Event-ID header.
+	ID string
+	// Name is the event type; empty means the default "message".
+	Name string
+	// Data is the payload. Strings and []byte are sent as-is, other values
+	// are encoded as JSON.
+	Data any
+	// Retry asks the client to wait this long before reconnecting.
+	Retry time.Duration
+}
+
+// Emit sends an event to the client. It fails once the client is gone;
+// streams should then return.
+type Emit func(Event) error
+
+// Streamer is implemented by handlers that send a sequence of events
+// instead of a single result. Transports that support streaming call
+// Stream instead of Handle:
+//
+//	func (h *Ticker) Stream(ctx context.Context, emit core.Emit) error {
+//		for i := 0; ; i++ {
+//			select {
+//			case <-ctx.Done():
+//				return nil
+//			case <-time.After(time.Second):
+//				if err := emit(core.Event{ID: strconv.Itoa(i), Data: i}); err != nil {
+//					return err
+//				}
+//			}
+//		}
+//	}
+//
+// Handlers can also return a receive channel from Handle; each value
+// received is one event (Event values are sent as they are), until the
+// channel is closed.
+type Streamer interface {
+	Stream(ctx context.Context, emit Emit) error
+}
@@ -0,0 +1,520 @@
+package core
+
+import (
+	"fmt"
+	"iter"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FieldError describes a single validation failure.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a handler fails its `validate` rules.
+// The HTTP transport answers it with 422 Unprocessable Entity.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		parts[i] = fe.Field + " " + fe.Message
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// StatusCode returns 422 Unprocessable Entity.
+func (e *ValidationError) StatusCode() int {
+	return 422
+}
+
+// Payload returns the machine-readable error list.
+func (e *ValidationError) Payload() any {
+	return map[string]any{
+		"error":  "validation failed",
+		"errors": e.Errors,
+	}
+}
+
+// Problem describes the failure as a 422 problem with an errors member.
+func (e *ValidationError) Problem() *Problem {
+	return NewProblem(422, "validation failed").With("errors", e.Errors)
+}
+
+// Validate checks the `validate` tags of a struct, or a pointer to one.
+//
+// Rules are separated by ";" and take their parameter after ":", e.g.
+// `validate:"required; min:3; max:50"`. Supported rules are required,
+// omitempty, min, max, len, oneof, regexp and email. Zero values are checked
+// like any other, unless the field is omitempty; nil pointers only fail
+// required. A regexp rule takes the rest of the tag, see SplitRules.
+//
+// Fields tagged body:"json", embedded structs, inline binding groups and
+// struct fields with a validate tag are checked recursively, as is
+// everything nested below a body field. It returns a *ValidationError
+// listing every failure.
+func Validate(target any) error {
+	val := reflect.ValueOf(target)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil
+	}
+
+	plan, err := validationFor(val.Type(), false)
+	if err != nil {
+		return err
+	}
+
+	var errs []FieldError
+	plan.check(val, "", &errs)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// CompileValidation compiles the validation rules of a struct type and
+// reports malformed tags. Transports call it at registration.
+func CompileValidation(typ reflect.Type) error {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+	_, err := validationFor(typ, false)
+	return err
+}
+
+type validationKey struct {
+	typ  reflect.Type
+	deep bool
+}
+
+var (
+	validations   sync.Map   // validationKey -> *validationPlan, complete plans only
+	validationsMu sync.Mutex // serializes compilation
+)
+
+type validationPlan struct {
+	fields    []fieldRules
+	compiling bool
+}
+
+type fieldRules struct {
+	index    int
+	name     string
+	promoted bool
+	group    string
+	rules    []rule
+	nested   *validationPlan
+}
+
+type rule struct {
+	name    string
+	message string
+	check   func(v reflect.Value) bool
+}
+
+// validationFor returns the cached plan for typ. Deep plans, used below a
+// body field, descend into every struct field.
+func validationFor(typ reflect.Type, deep bool) (*validationPlan, error) {
+	key := validationKey{typ: typ, deep: deep}
+	if p, ok := validations.Load(key); ok {
+		return p.(*validationPlan), nil
+	}
+
+	validationsMu.Lock()
+	defer validationsMu.Unlock()
+
+	// Plans are published once the whole type compiled, so readers never
+	// see one that is still being filled in or that failed.
+	compiled := map[validationKey]*validationPlan{}
+	p, err := compileValidation(typ, deep, compiled)
+	if err != nil {
+		return nil, err
+	}
+	for k, plan := range compiled {
+		validations.Store(k, plan)
+	}
+	return p, nil
+}
+
+func compileValidation(typ reflect.Type, deep bool, compiled map[validationKey]*validationPlan) (*validationPlan, error) {
+	key := validationKey{typ: typ, deep: deep}
+	if p, ok := validations.Load(key); ok {
+		return p.(*validationPlan), nil
+	}
+	if p, ok := compiled[key]; ok {
+		return p, nil
+	}
+
+	// Stored before the fields are compiled, so recursive types resolve to it.
+	p := &validationPlan{compiling: true}
+	compiled[key] = p
+	defer func() { p.compiling = false }()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag, hasTag := field.Tag.Lookup("validate")
+		group, inline := inlineGroup(field)
+		fr := fieldRules{
+			index:    i,
+			name:     fieldName(field),
+			promoted: field.Anonymous || inline,
+			group:    group,
+		}
+
+		if tag != "" {
+			rules, err := parseRules(field, tag)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			fr.rules = rules
+		}
+
+		isBody := field.Tag.Get("body") != ""
+		if st, ok := structType(field.Type); ok && (deep || isBody || hasTag || fr.promoted) {
+			nested, err := compileValidation(st, deep || isBody || hasTag, compiled)
+			if err != nil {
+				return nil, err
+			}
+			// Skip structs without rules, unless still being compiled
+			if len(nested.fields) > 0 || nested.compiling {
+				fr.nested = nested
+			}
+		}
+
+		if len(fr.rules) > 0 || fr.nested != nil {
+			p.fields = append(p.fields, fr)
+		}
+	}
+
+	return p, nil
+}
+
+// structType returns the struct type behind a field, looking through
+// pointers, slices, arrays and maps. Types that unmarshal themselves from
+// text, such as time.Time, are leaves.
+func structType(typ reflect.Type) (reflect.Type, bool) {
+	for {
+		switch typ.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			typ = typ.Elem()
+			continue
+		case reflect.Struct:
+			if reflect.PointerTo(typ).Implements(textUnmarshalerType) {
+				return nil, false
+			}
+			return typ, true
+		}
+		return nil, false
+	}
+}
+
+// bindingSources are the source tags used for report names and groups.
+var bindingSources = []string{"path", "query", "header", "cookie", "form", "flag", "arg", "env"}
+
+// fieldName is the name reported for a field: its json name, else its
+// first binding key, else the Go field name. Body fields are reported as
+// "body" and positional arguments by their lowercase field name, as in
+// command help.
+func fieldName(field reflect.StructField) string {
+	if field.Tag.Get("body") != "" {
+		return "body"
+	}
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	for _, source := range bindingSources {
+		if key, _, _ := strings.Cut(field.Tag.Get(source), ","); key != "" {
+			if source == "arg" {
+				return strings.ToLower(field.Name)
+			}
+			return key
+		}
+	}
+	return field.Name
+}
+
+// inlineGroup reports whether a field is an inline binding group and
+// returns its key prefix, so nested failures are named like their keys.
+func inlineGroup(field reflect.StructField) (string, bool) {
+	for _, source := range bindingSources {
+		if tag, ok := field.Tag.Lookup(source); ok {
+			if prefix, inline := InlinePrefix(tag); inline {
+				return prefix, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (p *validationPlan) check(val reflect.Value, prefix string, errs *[]FieldError) {
+	for _, fr := range p.fields {
+		name, nestedPrefix := prefix+fr.name, prefix+fr.name+"."
+		if fr.promoted {
+			// Embedded fields and inline groups are flattened into the
+			// parent, so their fields keep the parent's prefix
+			name, nestedPrefix = strings.TrimSuffix(prefix, "."), prefix+fr.group
+		}
+
+		field := val.Field(fr.index)
+		if failed := fr.checkRules(field, name, errs); failed {
+			continue
+		}
+
+		if fr.nested != nil {
+			fr.nested.checkNested(field, nestedPrefix, errs)
+		}
+	}
+}
+
+// checkRules applies the field's rules and reports whether any failed.
+func (fr *fieldRules) checkRules(field reflect.Value, name string, errs *[]FieldError) bool {
+	if len(fr.rules) == 0 {
+		return false
+	}
+
+	v := field
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			break
+		}
+		v = v.Elem()
+	}
+
+	if v.IsZero() {
+		omitempty := false
+		for _, r := range fr.rules {
+			switch r.name {
+			case "required":
+				*errs = append(*errs, FieldError{Field: name, Rule: r.name, Message: r.message})
+				return true
+			case "omitempty":
+				omitempty = true
+			}
+		}
+		// Nil pointers have no value to check
+		if omitempty || v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			return false
+		}
+	}
+
+	failed := false
+	for _, r := range fr.rules {
+		if r.check != nil && !r.check(v) {
+			*errs = append(*errs, FieldError{Field: name, Rule: r.name, Message: r.message})
+			failed = true
+		}
+	}
+	return failed
+}
+
+// checkNested validates a nested struct, or each element of a slice,
+// array or map of structs.
+func (p *validationPlan) checkNested(val reflect.Value, prefix string, errs *[]FieldError) {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !val.IsNil() {
+			p.checkNested(val.Elem(), prefix, errs)
+		}
+	case reflect.Struct:
+		p.check(val, prefix, errs)
+	case reflect.Slice, reflect.Array:
+		base := strings.TrimSuffix(prefix, ".")
+		for i := 0; i < val.Len(); i++ {
+			p.checkNested(val.Index(i), base+"["+strconv.Itoa(i)+"].", errs)
+		}
+	case reflect.Map:
+		base := strings.TrimSuffix(prefix, ".")
+		iter := val.MapRange()
+		for iter.Next() {
+			p.checkNested(iter.Value(), fmt.Sprintf("%s[%v].", base, iter.Key()), errs)
+		}
+	}
+}
+
+func parseRules(field reflect.StructField, tag string) ([]rule, error) {
+	typ := field.Type
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	var rules []rule
+	for name, param := range SplitRules(tag) {
+		r, err := compileRule(typ, name, param)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// SplitRules yields the rules of a validate tag with their parameters. A
+// regexp rule takes the rest of the tag, so its expression can contain
+// ";", and must come last.
+func SplitRules(tag string) iter.Seq2[string, string] {
+	return func(yield func(name, param string) bool) {
+		rest := tag
+		for rest != "" {
+			part, next, _ := strings.Cut(rest, ";")
+			name, param, _ := strings.Cut(part, ":")
+			name = strings.TrimSpace(name)
+			if name == "regexp" {
+				_, param, _ = strings.Cut(rest, ":")
+				next = ""
+			}
+			rest = next
+			if name == "" {
+				continue
+			}
+			if !yield(name, strings.TrimSpace(param)) {
+				return
+			}
+		}
+	}
+}
+
+// HasRule reports whether a validate tag contains the named rule.
+func HasRule(tag, name string) bool {
+	for n := range SplitRules(tag) {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func compileRule(typ reflect.Type, name, param string) (rule, error) {
+	r := rule{name: name}
+
+	switch name {
+	case "required":
+		r.message = "is required"
+
+	case "omitempty":
+
+	case "min", "max", "len":
+		if hasLength(typ) {
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				return r, fmt.Errorf("rule %s: invalid length %q", name, param)
+			}
+			switch name {
+			case "min":
+				r.message = fmt.Sprintf("length must be at least %d", n)
+				r.check = func(v reflect.Value) bool { return length(v) >= n }
+			case "max":
+				r.message = fmt.Sprintf("length must be at most %d", n)
+				r.check = func(v reflect.Value) bool { return length(v) <= n }
+			default:
+				r.message = fmt.Sprintf("length must be %d", n)
+				r.check = func(v reflect.Value) bool { return length(v) == n }
+			}
+			break
+		}
+		if !isNumber(typ.Kind()) || name == "len" {
+			return r, fmt.Errorf("rule %s does not apply to %s", name, typ)
+		}
+		f, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return r, fmt.Errorf("rule %s: invalid number %q", name, param)
+		}
+		if name == "min" {
+			r.message = "must be at least " + param
+			r.check = func(v reflect.Value) bool { return number(v) >= f }
+		} else {
+			r.message = "must be at most " + param
+			r.check = func(v reflect.Value) bool { return number(v) <= f }
+		}
+
+	case "oneof":
+		options := strings.Split(param, ",")
+		for i := range options {
+			options[i] = strings.TrimSpace(options[i])
+		}
+		r.message = "must be one of " + strings.Join(options, ", ")
+		r.check = func(v reflect.Value) bool {
+			s := fmt.Sprint(v.Interface())
+			for _, o := range options {
+				if s == o {
+					return true
+				}
+			}
+			return false
+		}
+
+	case "regexp":
+		if typ.Kind() != reflect.String {
+			return r, fmt.Errorf("rule regexp does not apply to %s", typ)
+		}
+		re, err := regexp.Compile(param)
+		if err != nil {
+			return r, fmt.Errorf("rule regexp: %w", err)
+		}
+		r.message = "must match " + param
+		r.check = func(v reflect.Value) bool { return re.MatchString(v.String()) }
+
+	case "email":
+		if typ.Kind() != reflect.String {
+			return r, fmt.Errorf("rule email does not apply to %s", typ)
+		}
+		r.message = "must be a valid email address"
+		r.check = func(v reflect.Value) bool {
+			addr, err := mail.ParseAddress(v.String())
+			return err == nil && addr.Address == v.String()
+		}
+
+	default:
+		return r, fmt.Errorf("unknown rule %q", name)
+	}
+
+	return r, nil
+}
+
+func hasLength(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// length counts characters for strings and elements otherwise.
+func length(v reflect.Value) int {
+	if v.Kind() == reflect.String {
+		return len([]rune(v.String()))
+	}
+	return v.Len()
+}
+
+func number(v reflect.Value) float64 {
+	switch {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
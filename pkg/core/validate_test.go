@@ -0,0 +1,247 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type signup struct {
+	Name   string    `json:"name" validate:"required; min:3; max:5"`
+	Age    int       `json:"age" validate:"min:18"`
+	Score  float64   `json:"score" validate:"omitempty; max:1.5"`
+	Level  int       `json:"level" validate:"oneof:1,2"`
+	Role   string    `json:"role" validate:"omitempty; oneof:admin,member"`
+	Email  string    `json:"email" validate:"omitempty; email"`
+	Code   string    `json:"code" validate:"omitempty; len:2"`
+	Tags   []string  `json:"tags" validate:"max:2"`
+	Slug   string    `json:"slug" validate:"omitempty; regexp:^[a-z]+(;[a-z]+)*$"`
+	Limit  *int      `json:"limit" validate:"min:1"`
+	Home   address   `json:"home" validate:""`
+	Others []address `json:"others" validate:""`
+}
+
+func validSignup() signup {
+	return signup{Name: "ada", Age: 36, Level: 1, Home: address{City: "Rome"}}
+}
+
+func TestValidate(t *testing.T) {
+	one, zero := 1, 0
+
+	tests := []struct {
+		name   string
+		modify func(*signup)
+		want   []string // field:rule
+	}{
+		{name: "valid", modify: func(s *signup) {}},
+		{name: "required", modify: func(s *signup) { s.Name = "" }, want: []string{"name:required"}},
+		{name: "min length", modify: func(s *signup) { s.Name = "ab" }, want: []string{"name:min"}},
+		{name: "max length counts characters", modify: func(s *signup) { s.Name = "àèìòù" }},
+		{name: "max length", modify: func(s *signup) { s.Name = "abcdef" }, want: []string{"name:max"}},
+		{name: "min number", modify: func(s *signup) { s.Age = 17 }, want: []string{"age:min"}},
+		{name: "zero number fails min", modify: func(s *signup) { s.Age = 0 }, want: []string{"age:min"}},
+		{name: "zero fails oneof", modify: func(s *signup) { s.Level = 0 }, want: []string{"level:oneof"}},
+		{name: "oneof number", modify: func(s *signup) { s.Level = 3 }, want: []string{"level:oneof"}},
+		{name: "max float", modify: func(s *signup) { s.Score = 1.6 }, want: []string{"score:max"}},
+		{name: "omitempty skips zero", modify: func(s *signup) { s.Role, s.Email, s.Code, s.Slug = "", "", "", "" }},
+		{name: "omitempty checks values", modify: func(s *signup) { s.Role = "owner" }, want: []string{"role:oneof"}},
+		{name: "email", modify: func(s *signup) { s.Email = "Ada <ada@example.com>" }, want: []string{"email:email"}},
+		{name: "valid email", modify: func(s *signup) { s.Email = "ada@example.com" }},
+		{name: "len", modify: func(s *signup) { s.Code = "abc" }, want: []string{"code:len"}},
+		{name: "slice length", modify: func(s *signup) { s.Tags = []string{"a", "b", "c"} }, want: []string{"tags:max"}},
+		{name: "regexp with separator", modify: func(s *signup) { s.Slug = "ab;cd" }},
+		{name: "regexp mismatch", modify: func(s *signup) { s.Slug = "ab;" }, want: []string{"slug:regexp"}},
+		{name: "nil pointer skips rules", modify: func(s *signup) { s.Limit = nil }},
+		{name: "pointer to zero is checked", modify: func(s *signup) { s.Limit = &zero }, want: []string{"limit:min"}},
+		{name: "pointer to valid value", modify: func(s *signup) { s.Limit = &one }},
+		{name: "nested struct", modify: func(s *signup) { s.Home.City = "" }, want: []string{"home.city:required"}},
+		{
+			name:   "nested slice",
+			modify: func(s *signup) { s.Others = []address{{City: "Paris"}, {}} },
+			want:   []string{"others[1].city:required"},
+		},
+		{
+			name:   "every failure is reported",
+			modify: func(s *signup) { s.Name, s.Age, s.Level = "", 1, 9 },
+			want:   []string{"name:required", "age:min", "level:oneof"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := validSignup()
+			tt.modify(&s)
+			err := Validate(&s)
+
+			var got []string
+			var verr *ValidationError
+			if errors.As(err, &verr) {
+				for _, fe := range verr.Errors {
+					got = append(got, fe.Field+":"+fe.Rule)
+				}
+			} else if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("failures %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateBody(t *testing.T) {
+	type item struct {
+		SKU string `json:"sku" validate:"len:3"`
+	}
+	type order struct {
+		ID   string `path:"id" validate:"required"`
+		Body struct {
+			Items []item          `json:"items" validate:"min:1"`
+			ByID  map[string]item `json:"by_id"`
+		} `body:"json"`
+	}
+
+	o := &order{ID: "1"}
+	o.Body.Items = []item{{SKU: "abc"}, {SKU: "ab"}}
+	o.Body.ByID = map[string]item{"x": {SKU: "abcd"}}
+
+	var verr *ValidationError
+	if !errors.As(Validate(o), &verr) {
+		t.Fatal("expected a *ValidationError")
+	}
+	var got []string
+	for _, fe := range verr.Errors {
+		got = append(got, fe.Field)
+	}
+	if want := []string{"body.items[1].sku", "body.by_id[x].sku"}; !slices.Equal(got, want) {
+		t.Fatalf("fields %v, want %v", got, want)
+	}
+}
+
+func TestCompileValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  any
+		wantErr string
+	}{
+		{name: "valid", target: &signup{}},
+		{name: "unknown rule", target: &struct {
+			A string `validate:"nope"`
+		}{}, wantErr: `unknown rule "nope"`},
+		{name: "invalid length", target: &struct {
+			A string `validate:"min:x"`
+		}{}, wantErr: "invalid length"},
+		{name: "invalid number", target: &struct {
+			A int `validate:"max:x"`
+		}{}, wantErr: "invalid number"},
+		{name: "len on number", target: &struct {
+			A int `validate:"len:1"`
+		}{}, wantErr: "does not apply"},
+		{name: "min on bool", target: &struct {
+			A bool `validate:"min:1"`
+		}{}, wantErr: "does not apply"},
+		{name: "regexp on number", target: &struct {
+			A int `validate:"regexp:^1$"`
+		}{}, wantErr: "does not apply"},
+		{name: "invalid regexp", target: &struct {
+			A string `validate:"regexp:("`
+		}{}, wantErr: "rule regexp"},
+		{name: "email on number", target: &struct {
+			A int `validate:"email"`
+		}{}, wantErr: "does not apply"},
+		{name: "nested", target: &struct {
+			B struct {
+				A string `validate:"nope"`
+			} `body:"json"`
+		}{}, wantErr: "field A"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CompileValidation(reflect.TypeOf(tt.target))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CompileValidation: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CompileValidation error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+type treeNode struct {
+	Name     string     `json:"name" validate:"required"`
+	Children []treeNode `json:"children" validate:""`
+}
+
+// TestValidateConcurrent compiles a recursive type from several goroutines
+// at once, so the race detector sees readers of the plan cache.
+func TestValidateConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tree := treeNode{Name: "root", Children: []treeNode{{Name: "a"}, {Children: []treeNode{{}}}}}
+			errs <- Validate(&tree)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("Validate error %v, want a *ValidationError", err)
+		}
+		var got []string
+		for _, fe := range verr.Errors {
+			got = append(got, fe.Field)
+		}
+		if want := []string{"children[1].name", "children[1].children[0].name"}; !slices.Equal(got, want) {
+			t.Fatalf("fields %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSplitRules(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want []string
+	}{
+		{tag: "", want: nil},
+		{tag: "required", want: []string{"required="}},
+		{tag: " required ; min: 3;max:5; ", want: []string{"required=", "min=3", "max=5"}},
+		{tag: "oneof:a,b", want: []string{"oneof=a,b"}},
+		{tag: "regexp:^a;b$", want: []string{"regexp=^a;b$"}},
+		{tag: "required; regexp:^(a|b):c;d$", want: []string{"required=", "regexp=^(a|b):c;d$"}},
+		{tag: "regexp:x", want: []string{"regexp=x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			var got []string
+			for name, param := range SplitRules(tt.tag) {
+				got = append(got, name+"="+param)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("SplitRules(%q) = %v, want %v", tt.tag, got, tt.want)
+			}
+		})
+	}
+
+	if !HasRule("min:1; required", "required") || HasRule("regexp:required", "required") {
+		t.Fatal("HasRule does not follow SplitRules")
+	}
+}
@@ -2,11 +2,18 @@ package router
 
 import (
 	"context"
+	"reflect"
 
 	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
 	"github.com/mirkobrombin/go-module-router/v2/pkg/logger"
 	"github.com/mirkobrombin/go-module-router/v2/pkg/transport/action"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/transport/cli"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/transport/grpc"
 	"github.com/mirkobrombin/go-module-router/v2/pkg/transport/http"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/transport/jsonrpc"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/transport/mcp"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/transport/queue"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/transport/schedule"
 	"github.com/mirkobrombin/go-signal/v2/pkg/bus"
 )
 
@@ -33,22 +40,71 @@ func Action() *action.Transport {
 	return action.New()
 }
 
+// CLI creates a new CLI transport.
+func CLI() *cli.Transport {
+	return cli.New()
+}
+
+// GRPC creates a new gRPC transport.
+func GRPC() *grpc.Transport {
+	return grpc.New()
+}
+
+// JSONRPC creates a new JSON-RPC 2.0 transport.
+func JSONRPC() *jsonrpc.Transport {
+	return jsonrpc.New()
+}
+
+// MCP creates a new Model Context Protocol tool server transport.
+func MCP() *mcp.Transport {
+	return mcp.New()
+}
+
+// Queue creates a new message-queue consumer transport.
+func Queue() *queue.Transport {
+	return queue.New()
+}
+
+// Schedule creates a new scheduled-job transport.
+func Schedule() *schedule.Transport {
+	return schedule.New()
+}
+
 // Router is a convenience wrapper that provides both transports.
+// Dependencies provided to it are registered in the container both share.
 type Router struct {
+	core.Provider
 	HTTP   *http.Transport
 	Action *action.Transport
 	Logger logger.Logger
 }
 
 // New creates a new multi-transport router.
+// Both transports share one binder, and with it the registered converters,
+// one problem mapper, so domain errors are classified the same way, and
+// one container, so a factory dependency is built once for both.
 func New() *Router {
+	binder := core.NewBinder()
+	problems := core.NewProblemMapper()
+	container := core.NewContainer()
 	return &Router{
-		HTTP:   http.New(),
-		Action: action.New(),
-		Logger: logger.Nop,
+		Provider: core.NewProvider(container),
+		HTTP:     http.New(http.WithBinder(binder), http.WithProblemMapper(problems), http.WithContainer(container)),
+		Action:   action.New(action.WithBinder(binder), action.WithProblemMapper(problems), action.WithContainer(container)),
+		Logger:   logger.Nop,
 	}
 }
 
+// Binder returns the binder shared by all transports.
+func (r *Router) Binder() *core.Binder {
+	return r.HTTP.Binder()
+}
+
+// Problems returns the error mapper shared by all transports.
+func (r *Router) Problems() *core.ProblemMapper {
+	return r.HTTP.Problems()
+}
+
 // SetLogger sets the logger for all transports.
 func (r *Router) SetLogger(l logger.Logger) {
 	r.Logger = l
@@ -56,25 +112,47 @@ func (r *Router) SetLogger(l logger.Logger) {
 	r.Action.Logger = l
 }
 
+// SetPanicReporter sets the callback that receives panics recovered from
+// handlers in all transports the router owns. HTTP groups, including those
+// created before the call, report to it unless they set their own.
+func (r *Router) SetPanicReporter(fn core.PanicReporter) {
+	r.HTTP.PanicReporter = fn
+	r.Action.PanicReporter = fn
+}
+
 // SetBus sets the event bus for action-based dispatching.
 func (r *Router) SetBus(b *bus.Bus) {
 	r.Action.Bus = b
 }
 
-// Provide registers a dependency in all transports.
-func (r *Router) Provide(name string, instance any) {
-	r.HTTP.Provide(name, instance)
-	r.Action.Provide(name, instance)
-}
-
 // Register registers a handler in the appropriate transport based on tags.
+// Handlers without method and path tags, such as actions, are skipped;
+// invalid HTTP handlers panic like http.Transport.Register.
 func (r *Router) Register(prototype Handler) {
-	// For now, register in both if applicable
-	// TODO: Detect which transport based on tags
-	defer func() { recover() }()
+	// TODO: Detect the other transports based on tags
+	if !hasRoute(prototype) {
+		return
+	}
 	r.HTTP.Register(prototype)
 }
 
+// hasRoute reports whether prototype declares an HTTP route. Prototypes
+// that are not pointers to structs are left to the transport to reject.
+func hasRoute(prototype Handler) bool {
+	val := reflect.ValueOf(prototype)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return true
+	}
+	typ := val.Elem().Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Type == reflect.TypeOf(core.Pattern{}) {
+			return field.Tag.Get("method") != "" && field.Tag.Get("path") != ""
+		}
+	}
+	return false
+}
+
 // RegisterAction registers an action handler.
 func (r *Router) RegisterAction(prototype Handler) {
 	r.Action.Register(prototype)
@@ -0,0 +1,128 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+type getUser struct {
+	Meta Pattern `method:"GET" path:"/users/{id}"`
+	ID   string  `path:"id"`
+}
+
+func (h *getUser) Handle(ctx context.Context) (any, error) { return h.ID, nil }
+
+type saveAction struct {
+	Meta Pattern `action:"file.save"`
+}
+
+func (h *saveAction) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+type noPattern struct{}
+
+func (h *noPattern) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+type badRule struct {
+	Meta Pattern `method:"GET" path:"/bad"`
+	Name string  `query:"name" validate:"nope"`
+}
+
+func (h *badRule) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+type badUpload struct {
+	Meta Pattern `method:"POST" path:"/upload"`
+	File string  `file:"avatar"`
+}
+
+func (h *badUpload) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+type valueHandler struct {
+	Meta Pattern `method:"GET" path:"/value"`
+}
+
+func (h valueHandler) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   Handler
+		wantRoute bool
+		wantPanic string
+	}{
+		{name: "route", handler: &getUser{}, wantRoute: true},
+		{name: "action is skipped", handler: &saveAction{}},
+		{name: "no pattern is skipped", handler: &noPattern{}},
+		{name: "invalid validate tag", handler: &badRule{}, wantPanic: "invalid validate tags"},
+		{name: "invalid file field", handler: &badUpload{}, wantPanic: "unsupported file type"},
+		{name: "not a pointer", handler: valueHandler{}, wantPanic: "pointer to a struct"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+			defer func() {
+				v := recover()
+				if tt.wantPanic == "" {
+					if v != nil {
+						t.Fatalf("Register panicked: %v", v)
+					}
+					return
+				}
+				msg, _ := v.(string)
+				if !strings.Contains(msg, tt.wantPanic) {
+					t.Fatalf("Register panic %v, want %q", v, tt.wantPanic)
+				}
+			}()
+
+			r.Register(tt.handler)
+			if got := len(r.Handlers()) == 1; got != tt.wantRoute {
+				t.Fatalf("registered %d HTTP handlers, want route %v", len(r.Handlers()), tt.wantRoute)
+			}
+		})
+	}
+}
+
+type panicRoute struct {
+	Meta Pattern `method:"GET" path:"/panic"`
+}
+
+func (h *panicRoute) Handle(ctx context.Context) (any, error) { panic("route") }
+
+type panicAction struct {
+	Meta Pattern `action:"panic"`
+}
+
+func (h *panicAction) Handle(ctx context.Context) (any, error) { panic("action") }
+
+func TestSetPanicReporter(t *testing.T) {
+	r := New()
+	r.Register(&panicRoute{})
+	r.HTTP.Group("/v1").Register(&panicRoute{})
+	r.RegisterAction(&panicAction{})
+
+	var reported []any
+	r.SetPanicReporter(func(ctx context.Context, pe *core.PanicError) {
+		reported = append(reported, pe.Value)
+	})
+
+	for _, path := range []string{"/panic", "/v1/panic"} {
+		rec := httptest.NewRecorder()
+		r.HTTP.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("GET %s: status %d, want 500", path, rec.Code)
+		}
+	}
+	if _, err := r.Dispatch(context.Background(), "panic"); err == nil {
+		t.Fatal("Dispatch of a panicking action succeeded")
+	}
+
+	if want := []any{"route", "route", "action"}; !slices.Equal(reported, want) {
+		t.Fatalf("reported %v, want %v", reported, want)
+	}
+}
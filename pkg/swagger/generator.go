@@ -1,17 +1,27 @@
 package swagger
 
 import (
+	"encoding"
 	"encoding/json"
+	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
 	"github.com/mirkobrombin/go-module-router/v2/pkg/router"
 )
 
 type Document struct {
-	OpenAPI string              `json:"openapi"`
-	Info    Info                `json:"info"`
-	Paths   map[string]PathItem `json:"paths"`
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components *Components         `json:"components,omitempty"`
+}
+
+type Components struct {
+	Schemas map[string]Schema `json:"schemas,omitempty"`
 }
 
 type Info struct {
@@ -36,12 +46,37 @@ type Parameter struct {
 }
 
 type Schema struct {
+	Ref     string   `json:"$ref,omitempty"`
 	Type    string   `json:"type,omitempty"`
+	Format  string   `json:"format,omitempty"`
+	Items   *Schema  `json:"items,omitempty"`
+	Default any      `json:"default,omitempty"`
 	Minimum *float64 `json:"minimum,omitempty"`
+
+	Properties           map[string]Schema `json:"properties,omitempty"`
+	AdditionalProperties bool              `json:"additionalProperties,omitempty"`
 }
 
 type Response struct {
-	Description string `json:"description"`
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema Schema `json:"schema"`
+}
+
+// problemSchema describes RFC 9457 problem documents, see core.Problem.
+var problemSchema = Schema{
+	Type: "object",
+	Properties: map[string]Schema{
+		"type":     {Type: "string"},
+		"title":    {Type: "string"},
+		"status":   {Type: "integer"},
+		"detail":   {Type: "string"},
+		"instance": {Type: "string"},
+	},
+	AdditionalProperties: true,
 }
 
 // MetaProvider is an optional interface endpoints can implement for OpenAPI metadata.
@@ -49,17 +84,42 @@ type MetaProvider interface {
 	OpenAPIMeta() map[string]any
 }
 
+// Generator builds OpenAPI documents.
+type Generator struct {
+	Title   string
+	Version string
+
+	// Problems classifies the errors endpoints declare (core.ErrorDeclarer).
+	// Pass the mapper of the HTTP transport so the document matches the
+	// status codes it serves; nil uses the built-in rules only.
+	Problems *core.ProblemMapper
+}
+
 // Build generates OpenAPI document from registered declarative endpoints.
 func Build(title, version string, endpoints ...router.Handler) ([]byte, error) {
+	g := &Generator{Title: title, Version: version}
+	return g.Build(endpoints...)
+}
+
+// Build generates OpenAPI document from registered declarative endpoints.
+func (g *Generator) Build(endpoints ...router.Handler) ([]byte, error) {
 	doc := Document{
 		OpenAPI: "3.0.3",
 		Info: Info{
-			Title:   title,
-			Version: version,
+			Title:   g.Title,
+			Version: g.Version,
 		},
 		Paths: map[string]PathItem{},
 	}
 
+	problems := g.Problems
+	if problems == nil {
+		problems = core.NewProblemMapper()
+	}
+
+	// Parameters are derived from the same plans the HTTP transport binds with
+	binder := core.NewBinder("path", "query", "header", "cookie")
+
 	for _, ep := range endpoints {
 		val := reflect.ValueOf(ep)
 		if val.Kind() == reflect.Ptr {
@@ -78,7 +138,8 @@ func Build(title, version string, endpoints ...router.Handler) ([]byte, error) {
 			}
 		}
 
-		if method == "" || path == "" {
+		// WebSocket endpoints have no OpenAPI operation
+		if method == "" || path == "" || method == "ws" {
 			continue
 		}
 
@@ -87,9 +148,12 @@ func Build(title, version string, endpoints ...router.Handler) ([]byte, error) {
 			pathItem = make(PathItem)
 		}
 
+		plan := binder.Plan(typ)
 		op := Operation{
-			Responses: map[string]Response{"200": {Description: "OK"}},
+			Parameters: derivedParameters(plan),
+			Responses:  map[string]Response{"200": {Description: "OK"}},
 		}
+		addErrorResponses(op.Responses, problems, plan, ep)
 
 		// If endpoint implements MetaProvider, use its metadata
 		if mp, ok := ep.(MetaProvider); ok {
@@ -119,7 +183,7 @@ func Build(title, version string, endpoints ...router.Handler) ([]byte, error) {
 							p.Schema.Minimum = &f
 						}
 					}
-					op.Parameters = append(op.Parameters, p)
+					op.Parameters = mergeParameter(op.Parameters, p)
 				}
 			}
 
@@ -133,7 +197,166 @@ func Build(title, version string, endpoints ...router.Handler) ([]byte, error) {
 
 		pathItem[method] = op
 		doc.Paths[path] = pathItem
+
+		for _, resp := range op.Responses {
+			if resp.Content != nil && doc.Components == nil {
+				doc.Components = &Components{Schemas: map[string]Schema{"Problem": problemSchema}}
+			}
+		}
 	}
 
 	return json.MarshalIndent(doc, "", "  ")
 }
+
+// addErrorResponses documents the problem responses of an endpoint: 400
+// when it binds input, 422 when it has validation rules, and one response
+// per error it declares, classified with problems.
+func addErrorResponses(responses map[string]Response, problems *core.ProblemMapper, plan *core.Plan, ep router.Handler) {
+	add := func(status int, description string) {
+		code := strconv.Itoa(status)
+		if resp, ok := responses[code]; ok {
+			if !strings.Contains(resp.Description, description) {
+				resp.Description += "; " + description
+				responses[code] = resp
+			}
+			return
+		}
+		responses[code] = Response{
+			Description: description,
+			Content: map[string]MediaType{
+				core.ProblemContentType: {Schema: Schema{Ref: "#/components/schemas/Problem"}},
+			},
+		}
+	}
+
+	if plan.HasBody() || len(plan.Params()) > 0 {
+		add(http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+	}
+	if hasValidation(plan.Type(), false, map[reflect.Type]bool{}) {
+		add(http.StatusUnprocessableEntity, "Validation failed")
+	}
+	if ed, ok := ep.(core.ErrorDeclarer); ok {
+		for _, err := range ed.Errors() {
+			p := problems.Problem(err)
+			description := p.Detail
+			if description == "" {
+				description = p.Title
+			}
+			add(p.StatusCode(), description)
+		}
+	}
+}
+
+// hasValidation reports whether the endpoint has validation rules, looking
+// where core.Validate does: bound fields, embedded structs and everything
+// below the body field.
+func hasValidation(typ reflect.Type, deep bool, seen map[reflect.Type]bool) bool {
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array || typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || seen[typ] {
+		return false
+	}
+	seen[typ] = true
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		rules, tagged := field.Tag.Lookup("validate")
+		if strings.TrimSpace(rules) != "" {
+			return true
+		}
+		descend := deep || tagged || field.Anonymous || field.Tag.Get("body") != ""
+		if descend && hasValidation(field.Type, deep || field.Tag.Get("body") != "", seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// derivedParameters lists the path, query, header and cookie parameters a
+// plan binds, including those of nested binding groups.
+func derivedParameters(plan *core.Plan) []Parameter {
+	var params []Parameter
+	for _, bp := range plan.Params() {
+		schema := schemaFor(bp.Field.Type)
+		schema.Default = defaultValue(schema.Type, bp.Default)
+
+		params = mergeParameter(params, Parameter{
+			Name:     bp.Key,
+			In:       bp.Source,
+			Required: bp.Source == "path" || core.HasRule(bp.Field.Tag.Get("validate"), "required"),
+			Schema:   schema,
+		})
+	}
+	return params
+}
+
+// mergeParameter adds p, replacing a parameter with the same name and location.
+func mergeParameter(params []Parameter, p Parameter) []Parameter {
+	for i := range params {
+		if params[i].Name == p.Name && params[i].In == p.In {
+			params[i] = p
+			return params
+		}
+	}
+	return append(params, p)
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func schemaFor(typ reflect.Type) Schema {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	var s Schema
+	switch {
+	case typ == timeType:
+		s.Type, s.Format = "string", "date-time"
+		return s
+	case typ == durationType:
+		s.Type = "string"
+		return s
+	case reflect.PointerTo(typ).Implements(textUnmarshalerType):
+		s.Type = "string"
+		return s
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.Type = "integer"
+	case reflect.Float32, reflect.Float64:
+		s.Type = "number"
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 && typ.Kind() == reflect.Slice {
+			s.Type = "string"
+			break
+		}
+		items := schemaFor(typ.Elem())
+		s.Type, s.Items = "array", &items
+	default:
+		s.Type = "string"
+	}
+	return s
+}
+
+// defaultValue renders a default tag in the schema's type.
+func defaultValue(typ, def string) any {
+	if def == "" {
+		return nil
+	}
+	if typ == "integer" || typ == "number" || typ == "boolean" {
+		var v any
+		if err := json.Unmarshal([]byte(def), &v); err == nil {
+			return v
+		}
+	}
+	return def
+}
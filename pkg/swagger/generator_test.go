@@ -0,0 +1,189 @@
+package swagger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/router"
+)
+
+type Pagination struct {
+	Page    int      `query:"page" default:"1" validate:"min:1"`
+	PerPage int      `query:"per_page" default:"20"`
+	Sort    []string `query:"sort"`
+}
+
+type orderFilter struct {
+	Status string `query:"status"`
+}
+
+type tenantHeaders struct {
+	ID string `header:"ID" validate:"required"`
+}
+
+type listOrders struct {
+	Meta router.Pattern `method:"GET" path:"/orgs/{org}/orders"`
+	Org  string         `path:"org"`
+	Pagination
+	Filter  orderFilter    `query:"filter.,inline"`
+	Tenant  *tenantHeaders `header:"X-Tenant-,inline"`
+	Session string         `cookie:"session_id"`
+}
+
+func (h *listOrders) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+// documentedOrders overrides a derived parameter and adds one.
+type documentedOrders struct {
+	Meta router.Pattern `method:"GET" path:"/orgs/{org}/orders"`
+	Org  string         `path:"org"`
+	Pagination
+}
+
+func (h *documentedOrders) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+func (h *documentedOrders) OpenAPIMeta() map[string]any {
+	return map[string]any{
+		"parameters": []map[string]any{
+			{"name": "page", "in": "query", "required": true, "schema": map[string]any{"type": "integer", "minimum": 1}},
+			{"name": "X-Trace", "in": "header", "schema": map[string]any{"type": "string"}},
+		},
+	}
+}
+
+func TestDerivedParameters(t *testing.T) {
+	one := 1.0
+	derived := []Parameter{
+		{Name: "org", In: "path", Required: true, Schema: Schema{Type: "string"}},
+		{Name: "page", In: "query", Schema: Schema{Type: "integer", Default: 1.0}},
+		{Name: "per_page", In: "query", Schema: Schema{Type: "integer", Default: 20.0}},
+		{Name: "sort", In: "query", Schema: Schema{Type: "array", Items: &Schema{Type: "string"}}},
+		{Name: "filter.status", In: "query", Schema: Schema{Type: "string"}},
+		{Name: "X-Tenant-ID", In: "header", Required: true, Schema: Schema{Type: "string"}},
+		{Name: "session_id", In: "cookie", Schema: Schema{Type: "string"}},
+	}
+	documented := []Parameter{
+		derived[0],
+		{Name: "page", In: "query", Required: true, Schema: Schema{Type: "integer", Minimum: &one}},
+		derived[2],
+		derived[3],
+		{Name: "X-Trace", In: "header", Schema: Schema{Type: "string"}},
+	}
+
+	tests := []struct {
+		name     string
+		endpoint router.Handler
+		want     []Parameter
+	}{
+		{name: "derived", endpoint: &listOrders{}, want: derived},
+		{name: "meta replaces and adds", endpoint: &documentedOrders{}, want: documented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Build("Orders", "1.0.0", tt.endpoint)
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			var doc Document
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatalf("invalid document: %v", err)
+			}
+			got := doc.Paths["/orgs/{org}/orders"]["get"].Parameters
+			if !reflect.DeepEqual(got, tt.want) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(tt.want)
+				t.Fatalf("parameters:\n%s\nwant:\n%s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+var errQuota = errors.New("quota exceeded")
+
+type deleteOrder struct {
+	Meta router.Pattern `method:"DELETE" path:"/orders/{id}"`
+	ID   int            `path:"id" validate:"min:1"`
+}
+
+func (h *deleteOrder) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+func (h *deleteOrder) Errors() []error {
+	return []error{
+		core.ErrNotFound,
+		fmt.Errorf("order shipped: %w", core.ErrConflict),
+		errQuota,
+		core.NewProblem(409, "order locked"),
+	}
+}
+
+type health struct {
+	Meta router.Pattern `method:"GET" path:"/health"`
+}
+
+func (h *health) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+func TestErrorResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint router.Handler
+		path     string
+		method   string
+		want     map[string]string // status -> description
+	}{
+		{
+			name:     "declared errors",
+			endpoint: &deleteOrder{},
+			path:     "/orders/{id}",
+			method:   "delete",
+			want: map[string]string{
+				"200": "OK",
+				"400": "Bad Request",
+				"404": "not found",
+				"409": "order shipped: conflict; order locked",
+				"422": "Validation failed",
+				"429": "quota exceeded",
+			},
+		},
+		{name: "no input", endpoint: &health{}, path: "/health", method: "get", want: map[string]string{"200": "OK"}},
+	}
+
+	problems := core.NewProblemMapper()
+	problems.Map(errQuota, 429)
+	g := &Generator{Title: "Orders", Version: "1.0.0", Problems: problems}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := g.Build(tt.endpoint)
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			var doc Document
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatalf("invalid document: %v", err)
+			}
+
+			responses := doc.Paths[tt.path][tt.method].Responses
+			got := make(map[string]string, len(responses))
+			for code, resp := range responses {
+				got[code] = resp.Description
+				if code == "200" {
+					continue
+				}
+				if ref := resp.Content[core.ProblemContentType].Schema.Ref; ref != "#/components/schemas/Problem" {
+					t.Fatalf("%s response schema %q, want the Problem schema", code, ref)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("responses %v, want %v", got, tt.want)
+			}
+			if hasProblems := doc.Components != nil; hasProblems != (len(tt.want) > 1) {
+				t.Fatalf("components %+v, want the Problem schema only with problem responses", doc.Components)
+			}
+		})
+	}
+}
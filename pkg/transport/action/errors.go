@@ -0,0 +1,53 @@
+package action
+
+import "github.com/mirkobrombin/go-module-router/v2/pkg/core"
+
+// Error is returned by Dispatch when an action fails. It classifies the
+// failure with the same core.ProblemMapper rules the HTTP transport uses
+// for status codes, so one set of domain errors drives both transports.
+//
+//	var aerr *action.Error
+//	if errors.As(err, &aerr) && aerr.Category == core.CategoryNotFound {
+//		// ...
+//	}
+//
+// The original error stays reachable with errors.Is and errors.As.
+type Error struct {
+	Action   string
+	Category core.Category
+	// Problem describes the error for display; 5xx details are hidden
+	// unless the mapper is in debug mode.
+	Problem *core.Problem
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// fail maps err and wraps it in an *Error.
+func (t *Transport) fail(action string, err error) error {
+	if t.mapError != nil {
+		err = t.mapError(err)
+	}
+	p := t.problems.Problem(err)
+	return &Error{
+		Action:   action,
+		Category: core.CategoryFor(p.StatusCode()),
+		Problem:  p,
+		Err:      err,
+	}
+}
+
+// payloadError is a payload that could not be applied to the handler.
+type payloadError struct {
+	err error
+}
+
+func (e *payloadError) Error() string   { return "payload binding failed: " + e.err.Error() }
+func (e *payloadError) Unwrap() error   { return e.err }
+func (e *payloadError) StatusCode() int { return 400 }
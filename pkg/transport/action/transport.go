@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"reflect"
-	"strings"
 	"sync"
 
 	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
@@ -14,12 +13,20 @@ import (
 
 // Transport handles action-based routing for GUI/CLI applications.
 type Transport struct {
-	container *core.Container
-	Logger    logger.Logger
-	handlers  map[string]core.Handler
-	keys      map[string]string // keybinding -> action
-	Bus       *bus.Bus
-	mu        sync.RWMutex
+	core.Provider
+	binder   *core.Binder
+	Logger   logger.Logger
+	handlers map[string]core.Handler
+	keys     map[string]string // keybinding -> action
+	Bus      *bus.Bus
+	mu       sync.RWMutex
+
+	problems *core.ProblemMapper
+	mapError core.ErrorMapper
+
+	// PanicReporter receives panics recovered from handlers. When nil,
+	// they are logged with their stack.
+	PanicReporter core.PanicReporter
 }
 
 type Option func(*Transport)
@@ -28,14 +35,44 @@ func WithBus(b *bus.Bus) Option {
 	return func(t *Transport) { t.Bus = b }
 }
 
+// WithBinder sets the binder used for payload conversion.
+func WithBinder(b *core.Binder) Option {
+	return func(t *Transport) { t.binder = b }
+}
+
+// WithProblemMapper sets the mapper that classifies errors, e.g. to share
+// one with the HTTP transport.
+func WithProblemMapper(m *core.ProblemMapper) Option {
+	return func(t *Transport) { t.problems = m }
+}
+
+// WithErrorMapper sets a hook that translates every error before it is
+// classified.
+func WithErrorMapper(m core.ErrorMapper) Option {
+	return func(t *Transport) { t.mapError = m }
+}
+
+// WithPanicReporter sets the callback that receives recovered panics.
+func WithPanicReporter(r core.PanicReporter) Option {
+	return func(t *Transport) { t.PanicReporter = r }
+}
+
+// WithContainer sets the dependency container, e.g. to share one with
+// other transports.
+func WithContainer(c *core.Container) Option {
+	return func(t *Transport) { t.Provider = core.NewProvider(c) }
+}
+
 // New creates a new action transport.
 func New(opts ...Option) *Transport {
 	t := &Transport{
-		container: core.NewContainer(),
-		Logger:    logger.Nop,
-		handlers:  make(map[string]core.Handler),
-		keys:      make(map[string]string),
-		Bus:       bus.Default(),
+		Provider: core.NewProvider(core.NewContainer()),
+		binder:   core.NewBinder(),
+		Logger:   logger.Nop,
+		handlers: make(map[string]core.Handler),
+		keys:     make(map[string]string),
+		Bus:      bus.Default(),
+		problems: core.NewProblemMapper(),
 	}
 	for _, opt := range opts {
 		opt(t)
@@ -43,9 +80,14 @@ func New(opts ...Option) *Transport {
 	return t
 }
 
-// Provide registers a dependency.
-func (t *Transport) Provide(name string, instance any) {
-	t.container.Provide(name, instance)
+// Binder returns the binder used for payload conversion.
+func (t *Transport) Binder() *core.Binder {
+	return t.binder
+}
+
+// Problems returns the mapper used to classify errors.
+func (t *Transport) Problems() *core.ProblemMapper {
+	return t.problems
 }
 
 // Register adds an action handler.
@@ -71,6 +113,9 @@ func (t *Transport) Register(prototype core.Handler) {
 	if actionName == "" {
 		panic(fmt.Sprintf("Transport.Register: struct %s missing Pattern with action tag", elemType.Name()))
 	}
+	if err := core.CompileValidation(elemType); err != nil {
+		panic(fmt.Sprintf("Transport.Register: struct %s has invalid validate tags: %v", elemType.Name(), err))
+	}
 
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -84,6 +129,9 @@ func (t *Transport) Register(prototype core.Handler) {
 }
 
 // Dispatch executes an action by name with an optional payload.
+// Every failure is returned as *Error, including the errors the handler
+// returns itself; the wrapper keeps their message, and errors.Is and
+// errors.As still match them.
 func (t *Transport) Dispatch(ctx context.Context, action string, payload ...any) (any, error) {
 	t.mu.RLock()
 	prototype, ok := t.handlers[action]
@@ -91,7 +139,7 @@ func (t *Transport) Dispatch(ctx context.Context, action string, payload ...any)
 	t.mu.RUnlock()
 
 	if !ok {
-		return nil, fmt.Errorf("action not found: %s", action)
+		return nil, t.fail(action, fmt.Errorf("action not found: %s: %w", action, core.ErrNotFound))
 	}
 
 	// Create new instance
@@ -100,80 +148,46 @@ func (t *Transport) Dispatch(ctx context.Context, action string, payload ...any)
 	newVal := reflect.New(elemType).Elem()
 	newVal.Set(val.Elem())
 
-	// Inject dependencies
+	// Inject dependencies, scoped ones live for this dispatch
 	instance := newVal.Addr().Interface()
-	t.container.Inject(instance)
+	scope := t.Container().NewScope(ctx)
+	defer scope.Close(core.ErrScopeAborted)
+	if err := scope.Inject(instance); err != nil {
+		return nil, t.fail(action, err)
+	}
 
 	// Real payload binding
 	if len(payload) > 0 && payload[0] != nil {
-		if err := t.applyPayload(instance, payload[0]); err != nil {
-			return nil, fmt.Errorf("payload binding failed: %w", err)
+		if err := t.binder.ApplyPayload(instance, payload[0]); err != nil {
+			return nil, t.fail(action, &payloadError{err: err})
 		}
 	}
 
+	// Validate, failures are returned as *core.ValidationError
+	if err := core.Validate(instance); err != nil {
+		return nil, t.fail(action, err)
+	}
+
 	// Execute
 	handler := instance.(core.Handler)
-	res, err := handler.Handle(ctx)
+	res, err := core.SafeHandle(ctx, handler, action)
+	core.CloseScope(scope, &err, t.Logger)
+	if pe, ok := err.(*core.PanicError); ok {
+		core.ReportPanic(ctx, pe, t.PanicReporter, t.Logger, "Action", "action")
+		return nil, t.fail(action, err)
+	}
 
 	// If a bus is present, emit the action as an event asynchronously
 	if busInstance != nil {
 		bus.EmitAsync(ctx, busInstance, instance)
 	}
 
-	return res, err
-}
-
-// applyPayload maps data from the payload to the target struct.
-// It supports map[string]any and structs, using reflection and "json" tags.
-func (t *Transport) applyPayload(target any, payload any) error {
-	dstVal := reflect.ValueOf(target).Elem()
-	dstType := dstVal.Type()
-
-	srcVal := reflect.ValueOf(payload)
-	if srcVal.Kind() == reflect.Ptr {
-		srcVal = srcVal.Elem()
-	}
-
-	switch srcVal.Kind() {
-	case reflect.Map:
-		for _, key := range srcVal.MapKeys() {
-			k := fmt.Sprintf("%v", key.Interface())
-			v := srcVal.MapIndex(key)
-			t.setFieldByNameOrTag(dstVal, dstType, k, v)
-		}
-	case reflect.Struct:
-		srcType := srcVal.Type()
-		for i := 0; i < srcVal.NumField(); i++ {
-			field := srcType.Field(i)
-			val := srcVal.Field(i)
-			t.setFieldByNameOrTag(dstVal, dstType, field.Name, val)
-		}
+	if err != nil {
+		return nil, t.fail(action, err)
 	}
 
-	return nil
-}
-
-func (t *Transport) setFieldByNameOrTag(dst reflect.Value, dstType reflect.Type, name string, val reflect.Value) {
-	for i := 0; i < dst.NumField(); i++ {
-		fieldMeta := dstType.Field(i)
-		field := dst.Field(i)
-
-		if !field.CanSet() {
-			continue
-		}
-
-		// Match by name or json tag
-		tag := fieldMeta.Tag.Get("json")
-		if strings.EqualFold(fieldMeta.Name, name) || (tag != "" && strings.Split(tag, ",")[0] == name) {
-			if field.Type() == val.Type() {
-				field.Set(val)
-			} else if val.Kind() == reflect.Interface && reflect.TypeOf(val.Interface()) == field.Type() {
-				field.Set(reflect.ValueOf(val.Interface()))
-			}
-			// Future: add type conversion (string to int, etc) if needed
-			break
-		}
-	}
+	// Transport metadata such as core.Response is HTTP only
+	return core.Unwrap(res), nil
 }
 
 // DispatchKey executes an action by keybinding.
@@ -183,7 +197,7 @@ func (t *Transport) DispatchKey(ctx context.Context, key string) (any, error) {
 	t.mu.RUnlock()
 
 	if !ok {
-		return nil, fmt.Errorf("no action bound to key: %s", key)
+		return nil, t.fail("", fmt.Errorf("no action bound to key: %s: %w", key, core.ErrNotFound))
 	}
 
 	return t.Dispatch(ctx, action)
@@ -0,0 +1,230 @@
+package action
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+type exportDoc struct {
+	Meta   core.Pattern `action:"doc.export"`
+	Format string       `json:"format"`
+}
+
+func (h *exportDoc) Handle(ctx context.Context) (any, error) {
+	doc := map[string]string{"format": h.Format}
+	switch h.Format {
+	case "async":
+		return core.Accepted(doc), nil
+	case "nested":
+		return core.NewResponse(201, core.Created("/docs/7", doc)), nil
+	}
+	return doc, nil
+}
+
+func TestDispatchUnwrapsResults(t *testing.T) {
+	tests := []struct {
+		format string
+		want   any
+	}{
+		{format: "pdf", want: map[string]string{"format": "pdf"}},
+		{format: "async", want: map[string]string{"format": "async"}},
+		{format: "nested", want: map[string]string{"format": "nested"}},
+	}
+
+	tr := New(WithBus(nil))
+	tr.Register(&exportDoc{})
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := tr.Dispatch(context.Background(), "doc.export", map[string]any{"format": tt.format})
+			if err != nil {
+				t.Fatalf("Dispatch: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Dispatch = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+var errLocked = errors.New("document locked")
+
+type deleteDoc struct {
+	Meta core.Pattern `action:"doc.delete" keys:"ctrl+d"`
+	ID   int          `json:"id" validate:"min:1"`
+	Mode string       `json:"mode"`
+}
+
+func (h *deleteDoc) Handle(ctx context.Context) (any, error) {
+	switch h.Mode {
+	case "missing":
+		return nil, fmt.Errorf("doc %d: %w", h.ID, core.ErrNotFound)
+	case "locked":
+		return nil, errLocked
+	case "forbidden":
+		return nil, core.NewProblem(403, "read-only")
+	case "driver":
+		return nil, sql.ErrNoRows
+	case "internal":
+		return nil, errors.New("disk quota of /home/ada exceeded")
+	}
+	return nil, nil
+}
+
+func TestDispatchErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		action       string
+		payload      any
+		wantAction   string
+		wantCategory core.Category
+		wantIs       error  // matched through the *Error
+		wantMessage  string // Error() of the *Error
+		wantDetail   string
+	}{
+		{
+			name:         "unknown action",
+			action:       "doc.print",
+			wantAction:   "doc.print",
+			wantCategory: core.CategoryNotFound,
+			wantIs:       core.ErrNotFound,
+			wantMessage:  "action not found: doc.print: not found",
+			wantDetail:   "action not found: doc.print: not found",
+		},
+		{
+			name:         "invalid payload",
+			action:       "doc.delete",
+			payload:      map[string]any{"id": "seven"},
+			wantAction:   "doc.delete",
+			wantCategory: core.CategoryInvalid,
+			wantMessage:  `payload binding failed: field ID: strconv.ParseInt: parsing "seven": invalid syntax`,
+			wantDetail:   `payload binding failed: field ID: strconv.ParseInt: parsing "seven": invalid syntax`,
+		},
+		{
+			name:         "validation",
+			action:       "doc.delete",
+			payload:      map[string]any{"id": 0},
+			wantAction:   "doc.delete",
+			wantCategory: core.CategoryInvalid,
+			wantMessage:  "validation failed: id must be at least 1",
+			wantDetail:   "validation failed",
+		},
+		{
+			name:         "handler sentinel",
+			action:       "doc.delete",
+			payload:      map[string]any{"id": 7, "mode": "missing"},
+			wantAction:   "doc.delete",
+			wantCategory: core.CategoryNotFound,
+			wantIs:       core.ErrNotFound,
+			wantMessage:  "doc 7: not found",
+			wantDetail:   "doc 7: not found",
+		},
+		{
+			name:         "mapped domain error",
+			action:       "doc.delete",
+			payload:      map[string]any{"id": 7, "mode": "locked"},
+			wantAction:   "doc.delete",
+			wantCategory: core.CategoryConflict,
+			wantIs:       errLocked,
+			wantMessage:  "document locked",
+			wantDetail:   "document locked",
+		},
+		{
+			name:         "problem",
+			action:       "doc.delete",
+			payload:      map[string]any{"id": 7, "mode": "forbidden"},
+			wantAction:   "doc.delete",
+			wantCategory: core.CategoryForbidden,
+			wantMessage:  "read-only",
+			wantDetail:   "read-only",
+		},
+		{
+			name:         "error mapper",
+			action:       "doc.delete",
+			payload:      map[string]any{"id": 7, "mode": "driver"},
+			wantAction:   "doc.delete",
+			wantCategory: core.CategoryNotFound,
+			wantIs:       sql.ErrNoRows,
+			wantMessage:  "not found: sql: no rows in result set",
+			wantDetail:   "not found: sql: no rows in result set",
+		},
+		{
+			name:         "internal detail hidden",
+			action:       "doc.delete",
+			payload:      map[string]any{"id": 7, "mode": "internal"},
+			wantAction:   "doc.delete",
+			wantCategory: core.CategoryInternal,
+			wantMessage:  "disk quota of /home/ada exceeded",
+		},
+	}
+
+	tr := New(WithBus(nil), WithErrorMapper(func(err error) error {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %w", core.ErrNotFound, err)
+		}
+		return err
+	}))
+	tr.Problems().Map(errLocked, 409)
+	tr.Register(&deleteDoc{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tr.Dispatch(context.Background(), tt.action, tt.payload)
+
+			var aerr *Error
+			if !errors.As(err, &aerr) {
+				t.Fatalf("Dispatch error %#v, want an *Error", err)
+			}
+			if aerr.Action != tt.wantAction || aerr.Category != tt.wantCategory {
+				t.Fatalf("action %q, category %q, want %q, %q", aerr.Action, aerr.Category, tt.wantAction, tt.wantCategory)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Fatalf("errors.Is(%v, %v) = false", err, tt.wantIs)
+			}
+			if err.Error() != tt.wantMessage {
+				t.Fatalf("Error() = %q, want %q", err.Error(), tt.wantMessage)
+			}
+			if aerr.Problem.Detail != tt.wantDetail {
+				t.Fatalf("problem detail %q, want %q", aerr.Problem.Detail, tt.wantDetail)
+			}
+		})
+	}
+
+	_, err := tr.DispatchKey(context.Background(), "ctrl+q")
+	var aerr *Error
+	if !errors.As(err, &aerr) || aerr.Category != core.CategoryNotFound || aerr.Action != "" {
+		t.Fatalf("DispatchKey of an unbound key: %#v, want a not found *Error", err)
+	}
+}
+
+type crashDoc struct {
+	Meta core.Pattern `action:"doc.crash"`
+}
+
+func (h *crashDoc) Handle(ctx context.Context) (any, error) { panic("renderer crashed") }
+
+func TestDispatchPanic(t *testing.T) {
+	var reported *core.PanicError
+	tr := New(WithBus(nil), WithPanicReporter(func(ctx context.Context, pe *core.PanicError) { reported = pe }))
+	tr.Register(&crashDoc{})
+
+	_, err := tr.Dispatch(context.Background(), "doc.crash")
+
+	var aerr *Error
+	var pe *core.PanicError
+	if !errors.As(err, &aerr) || !errors.As(err, &pe) {
+		t.Fatalf("Dispatch error %#v, want an *Error wrapping a *core.PanicError", err)
+	}
+	if aerr.Category != core.CategoryInternal || aerr.Problem.Detail != "" {
+		t.Fatalf("category %q, detail %q, want internal with the detail hidden", aerr.Category, aerr.Problem.Detail)
+	}
+	if reported != pe || pe.Endpoint != "doc.crash" || pe.Handler != "action.crashDoc" || pe.Value != "renderer crashed" {
+		t.Fatalf("reported %+v, want the recovered panic", reported)
+	}
+}
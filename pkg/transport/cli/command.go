@@ -0,0 +1,304 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+// command is a compiled command.
+type command struct {
+	path      string
+	short     string
+	long      string
+	prototype reflect.Value
+	plan      *core.Plan
+	flags     []*flagSpec
+	byName    map[string]*flagSpec // "--name" and "-n" -> flag
+	args      []*argSpec           // by position
+	envs      []*envSpec           // variables not shared with a flag or argument
+}
+
+type flagSpec struct {
+	name  string
+	short string
+	help  string
+	typ   string
+	def   string
+	env   string
+	bool  bool
+}
+
+type argSpec struct {
+	name     string
+	help     string
+	multi    bool
+	required bool
+}
+
+type envSpec struct {
+	name string
+	help string
+	typ  string
+	def  string
+}
+
+// errHelp is returned by parse when -h or --help is given.
+var errHelp = errors.New("cli: help requested")
+
+// compileCommand builds the flags, arguments and variables of a command
+// from its binding plan.
+func compileCommand(path string, plan *core.Plan) (*command, error) {
+	cmd := &command{path: path, plan: plan, byName: map[string]*flagSpec{}}
+	args := map[int]*argSpec{}
+
+	for _, params := range groupParams(plan.Params()) {
+		field := params[0].Field
+		var flag *flagSpec
+		var arg *argSpec
+		env := ""
+		for _, p := range params {
+			switch p.Source {
+			case "flag":
+				_, opts, _ := strings.Cut(field.Tag.Get("flag"), ",")
+				flag = &flagSpec{
+					name:  p.Key,
+					short: opts,
+					help:  field.Tag.Get("help"),
+					typ:   typeName(field.Type),
+					def:   p.Default,
+					bool:  isBool(field.Type),
+				}
+			case "arg":
+				i, err := strconv.Atoi(p.Key)
+				if err != nil || i < 0 {
+					return nil, fmt.Errorf("field %s: arg tag must be a position, got %q", field.Name, p.Key)
+				}
+				if _, dup := args[i]; dup {
+					return nil, fmt.Errorf("field %s: argument %d bound twice", field.Name, i)
+				}
+				arg = &argSpec{
+					name:     strings.ToLower(field.Name),
+					help:     field.Tag.Get("help"),
+					multi:    field.Type.Kind() == reflect.Slice,
+					required: core.HasRule(field.Tag.Get("validate"), "required"),
+				}
+				args[i] = arg
+			case "env":
+				env = p.Key
+			}
+		}
+
+		switch {
+		case flag != nil:
+			flag.env = env
+			if err := cmd.addFlag(flag); err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		case arg == nil && env != "":
+			cmd.envs = append(cmd.envs, &envSpec{name: env, help: field.Tag.Get("help"), typ: typeName(field.Type), def: params[0].Default})
+		}
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg, ok := args[i]
+		if !ok {
+			return nil, fmt.Errorf("argument %d is missing, arguments must be contiguous", i)
+		}
+		if arg.multi && i != len(args)-1 {
+			return nil, fmt.Errorf("argument %d takes the remaining arguments and must be the last", i)
+		}
+		cmd.args = append(cmd.args, arg)
+	}
+	return cmd, nil
+}
+
+// groupParams groups consecutive params of the same field. A repeated
+// source starts a new group, for same-typed fields of sibling groups.
+func groupParams(params []core.Param) [][]core.Param {
+	var groups [][]core.Param
+	for _, p := range params {
+		n := len(groups)
+		if n > 0 {
+			last := groups[n-1]
+			same := last[0].Field.Name == p.Field.Name && last[0].Field.Type == p.Field.Type && last[0].Field.Tag == p.Field.Tag
+			for _, q := range last {
+				if q.Source == p.Source {
+					same = false
+				}
+			}
+			if same {
+				groups[n-1] = append(last, p)
+				continue
+			}
+		}
+		groups = append(groups, []core.Param{p})
+	}
+	return groups
+}
+
+func (c *command) addFlag(f *flagSpec) error {
+	// A one-letter flag is its own alias, so both -n and --n work
+	if len(f.name) == 1 && f.short == "" {
+		f.short = f.name
+	}
+	if f.name == "help" || f.short == "h" {
+		return fmt.Errorf("flag --help/-h is reserved")
+	}
+	if len(f.short) > 1 {
+		return fmt.Errorf("flag alias %q must be a single character", f.short)
+	}
+	for _, name := range []string{"--" + f.name, "-" + f.short} {
+		if name == "-" {
+			continue
+		}
+		if _, dup := c.byName[name]; dup {
+			return fmt.Errorf("flag %s defined twice", name)
+		}
+		c.byName[name] = f
+	}
+	c.flags = append(c.flags, f)
+	sort.Slice(c.flags, func(i, j int) bool { return c.flags[i].name < c.flags[j].name })
+	return nil
+}
+
+// parsed is a parsed command line, exposed to the binding plan.
+type parsed struct {
+	flags  map[string][]string
+	args   []string
+	getenv func(string) string
+}
+
+func (p *parsed) Value(source, key string) string {
+	switch source {
+	case "flag":
+		if vals := p.flags[key]; len(vals) > 0 {
+			return vals[len(vals)-1]
+		}
+	case "arg":
+		if i, err := strconv.Atoi(key); err == nil && i < len(p.args) {
+			return p.args[i]
+		}
+	case "env":
+		if p.getenv != nil {
+			return p.getenv(key)
+		}
+	}
+	return ""
+}
+
+func (p *parsed) All(source, key string) []string {
+	switch source {
+	case "flag":
+		return p.flags[key]
+	case "arg":
+		// A slice argument takes the remaining arguments
+		if i, err := strconv.Atoi(key); err == nil && i < len(p.args) {
+			return p.args[i:]
+		}
+		return nil
+	}
+	if v := p.Value(source, key); v != "" {
+		return []string{v}
+	}
+	return nil
+}
+
+// parse splits args into flags and positional arguments. Flags may appear
+// anywhere, as --name value, --name=value, -n value or -n=value; boolean
+// flags need no value. Everything after "--" is positional, as are
+// negative numbers.
+func (c *command) parse(args []string) (*parsed, error) {
+	p := &parsed{flags: map[string][]string{}}
+	for i := 0; i < len(args); i++ {
+		tok := args[i]
+		if tok == "--" {
+			p.args = append(p.args, args[i+1:]...)
+			break
+		}
+		if len(tok) < 2 || tok[0] != '-' || isNumber(tok) {
+			p.args = append(p.args, tok)
+			continue
+		}
+		if tok == "-h" || tok == "--help" {
+			return nil, errHelp
+		}
+
+		name, val, hasVal := strings.Cut(tok, "=")
+		f, ok := c.byName[name]
+		if !ok {
+			return nil, &usageError{msg: fmt.Sprintf("unknown flag %s", name)}
+		}
+		if !hasVal {
+			if f.bool {
+				val = "true"
+			} else {
+				if i+1 >= len(args) {
+					return nil, &usageError{msg: fmt.Sprintf("flag %s needs a value", name)}
+				}
+				i++
+				val = args[i]
+			}
+		}
+		p.flags[f.name] = append(p.flags[f.name], val)
+	}
+
+	if n := len(c.args); len(p.args) > n && (n == 0 || !c.args[n-1].multi) {
+		return nil, &usageError{msg: fmt.Sprintf("too many arguments: %s", strings.Join(p.args[n:], " "))}
+	}
+	return p, nil
+}
+
+// expectsValue reports whether tok is a flag whose value is the next word.
+func (c *command) expectsValue(tok string) bool {
+	if strings.Contains(tok, "=") {
+		return false
+	}
+	f, ok := c.byName[tok]
+	return ok && !f.bool
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+func isBool(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Bool
+}
+
+// typeName describes the value a flag takes in help output.
+func typeName(typ reflect.Type) string {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == reflect.TypeOf(time.Duration(0)) {
+		return "duration"
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return ""
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice, reflect.Array:
+		if elem := typeName(typ.Elem()); elem != "" && elem != "value" {
+			return elem + "s"
+		}
+	}
+	return "value"
+}
@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// completeCommand is the hidden command the completion scripts call with
+// the words typed so far; it prints the candidates for the last one.
+const completeCommand = "__complete"
+
+var shells = []string{"bash", "fish", "zsh"}
+
+func isBuiltin(word string) bool {
+	return word == "help" || word == "completion" || word == completeCommand
+}
+
+// runCompletion serves `completion bash|zsh|fish`.
+func (t *Transport) runCompletion(args []string) int {
+	if len(args) != 1 {
+		return t.usageFailed(&usageError{msg: "completion needs a shell: " + strings.Join(shells, ", ")}, nil)
+	}
+	if err := t.Completion(t.stdout, args[0]); err != nil {
+		return t.usageFailed(&usageError{msg: err.Error()}, nil)
+	}
+	return ExitOK
+}
+
+// Completion writes the completion script for shell (bash, zsh or fish).
+// The scripts ask the program for candidates, so they stay valid as
+// commands and flags change:
+//
+//	source <(app completion bash)
+//	app completion zsh > "${fpath[1]}/_app"
+//	app completion fish > ~/.config/fish/completions/app.fish
+func (t *Transport) Completion(w io.Writer, shell string) error {
+	fn := strings.NewReplacer("-", "_", ".", "_").Replace(t.name)
+	var script string
+	switch shell {
+	case "bash":
+		script = fmt.Sprintf(`# bash completion for %[1]s
+_%[2]s_complete() {
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$(%[1]s %[3]s "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)" -- "${COMP_WORDS[COMP_CWORD]}"))
+}
+complete -o default -F _%[2]s_complete %[1]s
+`, t.name, fn, completeCommand)
+	case "zsh":
+		script = fmt.Sprintf(`#compdef %[1]s
+_%[2]s() {
+    local -a candidates
+    candidates=("${(@f)$(%[1]s %[3]s "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    if (( ${#candidates} )); then
+        compadd -a candidates
+    else
+        _files
+    fi
+}
+compdef _%[2]s %[1]s
+`, t.name, fn, completeCommand)
+	case "fish":
+		script = fmt.Sprintf(`# fish completion for %[1]s
+complete -c %[1]s -f -a '(%[1]s %[2]s (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)'
+`, t.name, completeCommand)
+	default:
+		return fmt.Errorf("unsupported shell %q, use one of: %s", shell, strings.Join(shells, ", "))
+	}
+	_, err := io.WriteString(w, script)
+	return err
+}
+
+// complete returns the candidates for the last of words, the words typed
+// after the program name.
+func (t *Transport) complete(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur, prev := words[len(words)-1], words[:len(words)-1]
+
+	if len(prev) > 0 {
+		switch prev[0] {
+		case "help":
+			if !strings.HasPrefix(cur, "-") {
+				return t.complete(words[1:])
+			}
+			return nil
+		case "completion":
+			if len(prev) == 1 {
+				return filter(shells, cur)
+			}
+			return nil
+		}
+	}
+
+	cmd, rest, group := t.resolve(prev)
+	if cmd != nil {
+		if n := len(rest); n > 0 && cmd.expectsValue(rest[n-1]) {
+			return nil
+		}
+		if !strings.HasPrefix(cur, "-") {
+			return nil
+		}
+		names := []string{"--help"}
+		for _, f := range cmd.flags {
+			if f.short == f.name {
+				names = append(names, "-"+f.short)
+			} else {
+				names = append(names, "--"+f.name)
+			}
+		}
+		return filter(names, cur)
+	}
+	if len(rest) > 0 {
+		return nil
+	}
+
+	// The next word of the commands under group
+	t.mu.RLock()
+	var next []string
+	for path := range t.commands {
+		words := strings.Fields(path)
+		if len(words) > len(group) && strings.Join(words[:len(group)], " ") == strings.Join(group, " ") {
+			next = append(next, words[len(group)])
+		}
+	}
+	t.mu.RUnlock()
+	if len(group) == 0 {
+		next = append(next, "completion", "help")
+	}
+	return filter(next, cur)
+}
+
+// filter returns the sorted, unique values starting with prefix.
+func filter(values []string, prefix string) []string {
+	sort.Strings(values)
+	var out []string
+	for i, v := range values {
+		if strings.HasPrefix(v, prefix) && (i == 0 || v != values[i-1]) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
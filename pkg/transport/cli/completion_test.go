@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		name  string
+		words []string
+		want  string
+	}{
+		{name: "nothing typed", words: nil, want: "completion\nhelp\nuser\n"},
+		{name: "command prefix", words: []string{"us"}, want: "user\n"},
+		{name: "group", words: []string{"user", ""}, want: "create\ndelete\n"},
+		{name: "group prefix", words: []string{"user", "d"}, want: "delete\n"},
+		{name: "flags", words: []string{"user", "create", "--t"}, want: "--tag\n--token\n"},
+		{name: "all flags", words: []string{"user", "create", "-"}, want: "--admin\n--age\n--help\n--tag\n--token\n-v\n"},
+		{name: "arguments are left to the shell", words: []string{"user", "create", ""}},
+		{name: "flag value", words: []string{"user", "create", "--age", "-"}},
+		{name: "help", words: []string{"help", "user", "c"}, want: "create\n"},
+		{name: "shells", words: []string{"completion", ""}, want: "bash\nfish\nzsh\n"},
+		{name: "unknown", words: []string{"nope", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, stdout, _ := newTestTransport(nil)
+			args := append([]string{completeCommand}, tt.words...)
+			if code := tr.Run(context.Background(), args); code != ExitOK {
+				t.Fatalf("exit code %d, want 0", code)
+			}
+			if stdout.String() != tt.want {
+				t.Fatalf("candidates %q, want %q", stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompletionScripts(t *testing.T) {
+	tests := []struct {
+		shell string
+		want  []string
+	}{
+		{shell: "bash", want: []string{"_my_app_complete()", "my-app __complete", "complete -o default -F _my_app_complete my-app"}},
+		{shell: "zsh", want: []string{"#compdef my-app", "my-app __complete", "compdef _my_app my-app"}},
+		{shell: "fish", want: []string{"complete -c my-app", "my-app __complete (commandline -opc)[2..-1]"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			tr, stdout, _ := newTestTransport(nil, WithName("my-app"))
+			if code := tr.Run(context.Background(), []string{"completion", tt.shell}); code != ExitOK {
+				t.Fatalf("exit code %d, want 0", code)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(stdout.String(), want) {
+					t.Fatalf("script %q does not contain %q", stdout, want)
+				}
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	tr, _, stderr := newTestTransport(nil)
+	if err := tr.Completion(&buf, "powershell"); err == nil {
+		t.Fatal("Completion for an unsupported shell succeeded")
+	}
+	if code := tr.Run(context.Background(), []string{"completion", "powershell"}); code != ExitUsage {
+		t.Fatalf("exit code %d for an unsupported shell, want %d", code, ExitUsage)
+	}
+	if !strings.Contains(stderr.String(), `unsupported shell "powershell"`) {
+		t.Fatalf("stderr %q, want the unsupported shell", stderr)
+	}
+}
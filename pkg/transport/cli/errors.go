@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+// Exit codes. Besides 0 and 1 they follow the BSD sysexits convention.
+const (
+	ExitOK          = 0
+	ExitFailure     = 1  // any other error
+	ExitUsage       = 64 // bad command line or invalid input
+	ExitNotFound    = 66 // the thing operated on does not exist
+	ExitUnavailable = 69 // a service is unavailable
+	ExitSoftware    = 70 // the handler panicked
+	ExitTempFail    = 75 // timeout or rate limit, try again later
+	ExitNoPerm      = 77 // not authenticated or not allowed
+)
+
+// ExitCoder is implemented by errors that choose the exit code themselves.
+type ExitCoder interface {
+	ExitCode() int
+}
+
+// defaultExitCodes maps error categories to exit codes. Errors are
+// classified with the transport's core.ProblemMapper, so the same domain
+// errors that become a 404 over HTTP exit with ExitNotFound.
+func defaultExitCodes() map[core.Category]int {
+	return map[core.Category]int{
+		core.CategoryInvalid:         ExitUsage,
+		core.CategoryUnauthenticated: ExitNoPerm,
+		core.CategoryForbidden:       ExitNoPerm,
+		core.CategoryNotFound:        ExitNotFound,
+		core.CategoryConflict:        ExitFailure,
+		core.CategoryRateLimited:     ExitTempFail,
+		core.CategoryTimeout:         ExitTempFail,
+		core.CategoryUnavailable:     ExitUnavailable,
+		core.CategoryInternal:        ExitFailure,
+	}
+}
+
+// usageError is a command line that does not match the command.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string   { return e.msg }
+func (e *usageError) StatusCode() int { return 400 }
+
+// usageFailed reports a usage error and points to the help of cmd, or of
+// the program when cmd is nil.
+func (t *Transport) usageFailed(err *usageError, cmd *command) int {
+	fmt.Fprintf(t.stderr, "%s: %s\n", t.name, err.msg)
+	if cmd != nil {
+		fmt.Fprintf(t.stderr, "Run '%s help %s' for usage.\n", t.name, cmd.path)
+	} else {
+		fmt.Fprintf(t.stderr, "Run '%s help' for usage.\n", t.name)
+	}
+	return ExitUsage
+}
+
+// failed reports a handler error and returns its exit code.
+func (t *Transport) failed(ctx context.Context, err error) int {
+	var pe *core.PanicError
+	if errors.As(err, &pe) {
+		core.ReportPanic(ctx, pe, t.PanicReporter, t.Logger, "Command", "command")
+		fmt.Fprintf(t.stderr, "%s: internal error\n", t.name)
+		return ExitSoftware
+	}
+
+	if t.mapError != nil {
+		err = t.mapError(err)
+	}
+	fmt.Fprintf(t.stderr, "%s: %v\n", t.name, err)
+
+	var ec ExitCoder
+	if errors.As(err, &ec) {
+		return ec.ExitCode()
+	}
+	category := core.CategoryFor(t.problems.Problem(err).StatusCode())
+	if code, ok := t.exitCodes[category]; ok {
+		return code
+	}
+	return ExitFailure
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// runHelp serves `help [command]`.
+func (t *Transport) runHelp(args []string) int {
+	cmd, rest, group := t.resolve(args)
+	switch {
+	case cmd != nil && len(rest) == 0:
+		cmd.printHelp(t.stdout, t.name)
+	case cmd == nil && len(rest) == 0:
+		t.printHelp(t.stdout, group)
+	default:
+		return t.usageFailed(&usageError{msg: fmt.Sprintf("unknown command %q", strings.Join(args, " "))}, nil)
+	}
+	return ExitOK
+}
+
+// printHelp lists the commands under group, or all of them.
+func (t *Transport) printHelp(w io.Writer, group []string) {
+	prefix := strings.Join(group, " ")
+	if prefix == "" && t.description != "" {
+		fmt.Fprintf(w, "%s\n\n", t.description)
+	}
+
+	usage := t.name + " <command>"
+	if prefix != "" {
+		usage = t.name + " " + prefix + " <command>"
+	}
+	fmt.Fprintf(w, "Usage:\n  %s [flags]\n\nCommands:\n", usage)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	t.mu.RLock()
+	paths := make([]string, 0, len(t.commands))
+	for path := range t.commands {
+		if prefix == "" || strings.HasPrefix(path, prefix+" ") {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		row(tw, path, t.commands[path].short)
+	}
+	t.mu.RUnlock()
+	if prefix == "" {
+		row(tw, "completion", "Generate a shell completion script")
+		row(tw, "help", "Show help for a command")
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nRun '%s help <command>' for details.\n", t.name)
+}
+
+// printHelp writes the usage of the command.
+func (c *command) printHelp(w io.Writer, name string) {
+	switch {
+	case c.long != "":
+		fmt.Fprintf(w, "%s\n\n", c.long)
+	case c.short != "":
+		fmt.Fprintf(w, "%s\n\n", c.short)
+	}
+
+	usage := name + " " + c.path
+	for _, a := range c.args {
+		placeholder := a.name
+		if a.multi {
+			placeholder += "..."
+		}
+		if a.required {
+			usage += " <" + placeholder + ">"
+		} else {
+			usage += " [" + placeholder + "]"
+		}
+	}
+	fmt.Fprintf(w, "Usage:\n  %s [flags]\n", usage)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	if len(c.args) > 0 {
+		fmt.Fprintf(tw, "\nArguments:\n")
+		for _, a := range c.args {
+			row(tw, a.name, a.help)
+		}
+	}
+
+	fmt.Fprintf(tw, "\nFlags:\n")
+	for _, f := range c.flags {
+		names := "    --" + f.name
+		switch {
+		case f.short == f.name:
+			names = "-" + f.short
+		case f.short != "":
+			names = "-" + f.short + ", --" + f.name
+		}
+		if f.typ != "" {
+			names += " " + f.typ
+		}
+		row(tw, names, describe(f.help, f.def, f.env))
+	}
+	row(tw, "-h, --help", "Show this help")
+
+	if len(c.envs) > 0 {
+		fmt.Fprintf(tw, "\nEnvironment:\n")
+		for _, e := range c.envs {
+			row(tw, e.name+" "+e.typ, describe(e.help, e.def, ""))
+		}
+	}
+	tw.Flush()
+}
+
+func describe(help, def, env string) string {
+	if def != "" {
+		help += fmt.Sprintf(" (default %q)", def)
+	}
+	if env != "" {
+		help += " [$" + env + "]"
+	}
+	return strings.TrimSpace(help)
+}
+
+// row writes an indented two-column line.
+func row(w io.Writer, name, desc string) {
+	fmt.Fprintf(w, "  %s\t%s\n", name, desc)
+}
@@ -0,0 +1,386 @@
+// Package cli runs handlers as subcommands of a command-line program.
+//
+//	type CreateUser struct {
+//		Meta  core.Pattern `command:"user create" short:"Create a user"`
+//		Name  string       `arg:"0" help:"user name" validate:"required"`
+//		Admin bool         `flag:"admin,a" help:"grant admin rights"`
+//		Token string       `flag:"token" env:"APP_TOKEN" help:"API token"`
+//	}
+//
+//	t := cli.New(cli.WithName("app"))
+//	t.Register(&CreateUser{})
+//	t.Main(ctx)
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/logger"
+)
+
+// Transport handles command-line routing.
+type Transport struct {
+	core.Provider
+	binder      *core.Binder
+	Logger      logger.Logger
+	commands    map[string]*command
+	mu          sync.RWMutex
+	name        string
+	description string
+	stdout      io.Writer
+	stderr      io.Writer
+	getenv      func(string) string
+
+	problems  *core.ProblemMapper
+	mapError  core.ErrorMapper
+	exitCodes map[core.Category]int
+
+	// PanicReporter receives panics recovered from handlers. When nil,
+	// they are logged with their stack.
+	PanicReporter core.PanicReporter
+}
+
+type Option func(*Transport)
+
+// WithName sets the program name shown in help and completion scripts.
+// It defaults to the base name of os.Args[0].
+func WithName(name string) Option {
+	return func(t *Transport) { t.name = name }
+}
+
+// WithDescription sets the text shown at the top of the program help.
+func WithDescription(desc string) Option {
+	return func(t *Transport) { t.description = desc }
+}
+
+// WithOutput sets where results and help (stdout) and errors (stderr) are
+// written.
+func WithOutput(stdout, stderr io.Writer) Option {
+	return func(t *Transport) { t.stdout, t.stderr = stdout, stderr }
+}
+
+// WithEnv sets the lookup used for env-tagged fields, os.Getenv by default.
+func WithEnv(getenv func(string) string) Option {
+	return func(t *Transport) { t.getenv = getenv }
+}
+
+// WithBinder sets the binder used for flags, arguments and environment
+// variables.
+func WithBinder(b *core.Binder) Option {
+	return func(t *Transport) { t.binder = b }
+}
+
+// WithProblemMapper sets the mapper that classifies handler errors.
+func WithProblemMapper(m *core.ProblemMapper) Option {
+	return func(t *Transport) { t.problems = m }
+}
+
+// WithErrorMapper sets a hook that translates every handler error before
+// it is classified.
+func WithErrorMapper(m core.ErrorMapper) Option {
+	return func(t *Transport) { t.mapError = m }
+}
+
+// WithPanicReporter sets the callback that receives recovered panics.
+func WithPanicReporter(r core.PanicReporter) Option {
+	return func(t *Transport) { t.PanicReporter = r }
+}
+
+// WithExitCode overrides the exit code of an error category.
+func WithExitCode(c core.Category, code int) Option {
+	return func(t *Transport) { t.exitCodes[c] = code }
+}
+
+// WithContainer sets the dependency container, e.g. to share one with
+// other transports.
+func WithContainer(c *core.Container) Option {
+	return func(t *Transport) { t.Provider = core.NewProvider(c) }
+}
+
+// New creates a new CLI transport.
+func New(opts ...Option) *Transport {
+	t := &Transport{
+		Provider:  core.NewProvider(core.NewContainer()),
+		binder:    core.NewBinder(),
+		Logger:    logger.Nop,
+		commands:  make(map[string]*command),
+		name:      filepath.Base(os.Args[0]),
+		stdout:    os.Stdout,
+		stderr:    os.Stderr,
+		getenv:    os.Getenv,
+		problems:  core.NewProblemMapper(),
+		exitCodes: defaultExitCodes(),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.binder.Declare("arg", "flag", "env")
+	return t
+}
+
+// Binder returns the binder used for flags, arguments and environment
+// variables.
+func (t *Transport) Binder() *core.Binder {
+	return t.binder
+}
+
+// Problems returns the mapper used to classify handler errors.
+func (t *Transport) Problems() *core.ProblemMapper {
+	return t.problems
+}
+
+// Register adds a command.
+// Reads `command:"user create"`, `short:"..."` and `long:"..."` tags from
+// the Pattern field. Fields are bound from `arg:"0"` (positional, a slice
+// takes the rest), `flag:"name"` or `flag:"name,n"` (with a one-letter
+// alias) and `env:"VAR"`, and described with `help:"..."`.
+func (t *Transport) Register(prototype core.Handler) {
+	val := reflect.ValueOf(prototype)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		panic("Transport.Register: prototype must be a pointer to a struct")
+	}
+
+	elemType := val.Elem().Type()
+
+	var path, short, long string
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if field.Type == reflect.TypeOf(core.Pattern{}) {
+			path = strings.Join(strings.Fields(field.Tag.Get("command")), " ")
+			short = field.Tag.Get("short")
+			long = field.Tag.Get("long")
+			break
+		}
+	}
+
+	if path == "" {
+		panic(fmt.Sprintf("Transport.Register: struct %s missing Pattern with command tag", elemType.Name()))
+	}
+	if word, _, _ := strings.Cut(path, " "); isBuiltin(word) {
+		panic(fmt.Sprintf("Transport.Register: command %q is reserved", word))
+	}
+	if err := core.CompileValidation(elemType); err != nil {
+		panic(fmt.Sprintf("Transport.Register: struct %s has invalid validate tags: %v", elemType.Name(), err))
+	}
+
+	cmd, err := compileCommand(path, t.binder.Plan(elemType))
+	if err != nil {
+		panic(fmt.Sprintf("Transport.Register: struct %s: %v", elemType.Name(), err))
+	}
+	cmd.short, cmd.long, cmd.prototype = short, long, val
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, dup := t.commands[path]; dup {
+		panic(fmt.Sprintf("Transport.Register: command %q registered twice", path))
+	}
+	t.commands[path] = cmd
+	t.Logger.Info("Registered command", "command", path)
+}
+
+// Commands returns all registered command paths, sorted.
+func (t *Transport) Commands() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	paths := make([]string, 0, len(t.commands))
+	for path := range t.commands {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Main runs the command line of the process and exits with its code.
+func (t *Transport) Main(ctx context.Context) {
+	os.Exit(t.Run(ctx, os.Args[1:]))
+}
+
+// Run runs the command selected by args, the command line without the
+// program name, and returns the exit code. Results are written to stdout:
+// strings and fmt.Stringers as they are, other values as indented JSON.
+// Errors are written to stderr.
+//
+// Besides the registered commands, `help [command]`, `-h`/`--help` and
+// `completion bash|zsh|fish` are always available.
+func (t *Transport) Run(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		t.printHelp(t.stderr, nil)
+		return ExitUsage
+	}
+	switch args[0] {
+	case "help":
+		return t.runHelp(args[1:])
+	case "completion":
+		return t.runCompletion(args[1:])
+	case completeCommand:
+		for _, c := range t.complete(args[1:]) {
+			fmt.Fprintln(t.stdout, c)
+		}
+		return ExitOK
+	}
+
+	cmd, rest, group := t.resolve(args)
+	if cmd == nil {
+		if wantsHelp(rest) {
+			t.printHelp(t.stdout, group)
+			return ExitOK
+		}
+		if len(group) > 0 && len(rest) == 0 {
+			t.printHelp(t.stderr, group)
+			return ExitUsage
+		}
+		return t.usageFailed(&usageError{msg: fmt.Sprintf("unknown command %q", strings.Join(append(group, firstWord(rest)), " "))}, nil)
+	}
+
+	// Help needs no dependencies, commands get them built up front
+	if !wantsHelp(rest) {
+		if err := t.Container().Build(); err != nil {
+			return t.failed(ctx, err)
+		}
+	}
+
+	res, err := t.execute(ctx, cmd, rest)
+	if err == errHelp {
+		cmd.printHelp(t.stdout, t.name)
+		return ExitOK
+	}
+	if err != nil {
+		var ue *usageError
+		if errors.As(err, &ue) {
+			return t.usageFailed(ue, cmd)
+		}
+		return t.failed(ctx, err)
+	}
+
+	if err := t.printResult(res); err != nil {
+		return t.failed(ctx, err)
+	}
+	return ExitOK
+}
+
+// execute parses the command line of cmd into a new handler instance and
+// runs it.
+func (t *Transport) execute(ctx context.Context, cmd *command, args []string) (any, error) {
+	parsed, err := cmd.parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create new instance
+	newVal := reflect.New(cmd.prototype.Elem().Type()).Elem()
+	newVal.Set(cmd.prototype.Elem())
+
+	// Inject dependencies, scoped ones live for this command
+	instance := newVal.Addr().Interface()
+	scope := t.Container().NewScope(ctx)
+	defer scope.Close(core.ErrScopeAborted)
+	if err := scope.Inject(instance); err != nil {
+		return nil, err
+	}
+
+	parsed.getenv = t.getenv
+	if err := cmd.plan.Bind(newVal, parsed); err != nil {
+		return nil, &usageError{msg: err.Error()}
+	}
+	if err := core.Validate(instance); err != nil {
+		return nil, err
+	}
+
+	res, err := core.SafeHandle(ctx, instance.(core.Handler), cmd.path)
+	core.CloseScope(scope, &err, t.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Transport metadata such as core.Response is HTTP only
+	return core.Unwrap(res), nil
+}
+
+// printResult writes a handler result to stdout.
+func (t *Transport) printResult(res any) error {
+	switch v := res.(type) {
+	case nil:
+		return nil
+	case string:
+		_, err := fmt.Fprintln(t.stdout, v)
+		return err
+	case []byte:
+		_, err := t.stdout.Write(v)
+		return err
+	case fmt.Stringer:
+		_, err := fmt.Fprintln(t.stdout, v)
+		return err
+	}
+
+	enc := json.NewEncoder(t.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
+
+// resolve finds the command named by the leading words of args. When no
+// command matches, group holds the leading words naming a group of
+// commands, such as "user" for "user create" and "user delete".
+func (t *Transport) resolve(args []string) (cmd *command, rest []string, group []string) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	n := 0
+	for n < len(args) && !strings.HasPrefix(args[n], "-") {
+		n++
+	}
+	for i := n; i > 0; i-- {
+		if c, ok := t.commands[strings.Join(args[:i], " ")]; ok {
+			return c, args[i:], args[:i]
+		}
+	}
+	for i := n; i > 0; i-- {
+		if t.isGroup(args[:i]) {
+			return nil, args[i:], args[:i]
+		}
+	}
+	return nil, args, nil
+}
+
+// isGroup reports whether some command path starts with words.
+// The caller holds t.mu.
+func (t *Transport) isGroup(words []string) bool {
+	prefix := strings.Join(words, " ") + " "
+	for path := range t.commands {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func wantsHelp(args []string) bool {
+	for _, a := range args {
+		if a == "--" {
+			return false
+		}
+		if a == "-h" || a == "--help" {
+			return true
+		}
+	}
+	return false
+}
+
+func firstWord(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
@@ -0,0 +1,418 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+var errLocked = errors.New("account locked")
+
+type userStore struct {
+	names map[string]bool
+}
+
+type createUser struct {
+	Meta    core.Pattern `command:"user create" short:"Create a user" long:"Create a user and grant it roles."`
+	Name    string       `arg:"0" help:"user name" validate:"required; min:3"`
+	Roles   []string     `arg:"1" help:"roles to grant"`
+	Admin   bool         `flag:"admin,a" help:"grant admin rights"`
+	Age     int8         `flag:"age" default:"18" help:"age in years"`
+	Verbose int          `flag:"v" help:"verbosity"`
+	Tags    []string     `flag:"tag" help:"labels"`
+	Token   string       `flag:"token" env:"APP_TOKEN" help:"API token"`
+	Region  string       `env:"APP_REGION" default:"eu" help:"deployment region"`
+
+	Users *userStore `inject:"Users"`
+}
+
+func (c *createUser) Handle(ctx context.Context) (any, error) {
+	if c.Users.names[c.Name] {
+		return nil, fmt.Errorf("user %s: %w", c.Name, core.ErrConflict)
+	}
+	return map[string]any{
+		"name": c.Name, "roles": c.Roles, "admin": c.Admin, "age": c.Age,
+		"verbose": c.Verbose, "tags": c.Tags, "token": c.Token, "region": c.Region,
+	}, nil
+}
+
+type deleteUser struct {
+	Meta core.Pattern `command:"user delete" short:"Delete a user"`
+	Name string       `arg:"0" validate:"required"`
+	Mode string       `flag:"mode"`
+}
+
+type exitError struct{}
+
+func (exitError) Error() string { return "custom failure" }
+func (exitError) ExitCode() int { return 3 }
+
+func (c *deleteUser) Handle(ctx context.Context) (any, error) {
+	switch c.Mode {
+	case "missing":
+		return nil, fmt.Errorf("user %s: %w", c.Name, core.ErrNotFound)
+	case "forbidden":
+		return nil, core.ErrForbidden
+	case "locked":
+		return nil, errLocked
+	case "custom":
+		return nil, exitError{}
+	case "panic":
+		panic("disk on fire")
+	case "internal":
+		return nil, errors.New("broken")
+	}
+	return "deleted " + c.Name, nil
+}
+
+// newTestTransport returns a transport writing to the returned buffers.
+func newTestTransport(env map[string]string, opts ...Option) (*Transport, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	opts = append([]Option{
+		WithName("app"),
+		WithDescription("Manage the app."),
+		WithOutput(&stdout, &stderr),
+		WithEnv(func(key string) string { return env[key] }),
+		WithPanicReporter(func(context.Context, *core.PanicError) {}),
+	}, opts...)
+	tr := New(opts...)
+	tr.Provide("Users", &userStore{names: map[string]bool{"taken": true}})
+	tr.Register(&createUser{})
+	tr.Register(&deleteUser{})
+	return tr, &stdout, &stderr
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		env        map[string]string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "arguments and defaults",
+			args:       []string{"user", "create", "bob"},
+			wantStdout: `"age": 18`,
+		},
+		{
+			name:       "remaining arguments",
+			args:       []string{"user", "create", "bob", "admin", "ops"},
+			wantStdout: "\"roles\": [\n    \"admin\",\n    \"ops\"\n  ]",
+		},
+		{
+			name:       "flags anywhere",
+			args:       []string{"user", "create", "--age", "30", "bob", "--admin"},
+			wantStdout: "\"admin\": true,\n  \"age\": 30",
+		},
+		{
+			name:       "flag alias and inline value",
+			args:       []string{"user", "create", "-a", "--age=40", "bob"},
+			wantStdout: "\"admin\": true,\n  \"age\": 40",
+		},
+		{
+			name:       "one-letter flag",
+			args:       []string{"user", "create", "-v", "2", "bob"},
+			wantStdout: `"verbose": 2`,
+		},
+		{
+			name:       "one-letter flag long form",
+			args:       []string{"user", "create", "--v=3", "bob"},
+			wantStdout: `"verbose": 3`,
+		},
+		{
+			name:       "repeated slice flag",
+			args:       []string{"user", "create", "bob", "--tag", "a", "--tag", "b,c"},
+			wantStdout: "\"tags\": [\n    \"a\",\n    \"b\",\n    \"c\"\n  ]",
+		},
+		{
+			name:       "after double dash",
+			args:       []string{"user", "create", "--", "-bob"},
+			wantStdout: `"name": "-bob"`,
+		},
+		{
+			name:       "env fallback",
+			args:       []string{"user", "create", "bob"},
+			env:        map[string]string{"APP_TOKEN": "secret", "APP_REGION": "us"},
+			wantStdout: "\"region\": \"us\",\n  \"roles\": null,\n  \"tags\": null,\n  \"token\": \"secret\"",
+		},
+		{
+			name:       "flag wins over env",
+			args:       []string{"user", "create", "bob", "--token", "flag"},
+			env:        map[string]string{"APP_TOKEN": "env"},
+			wantStdout: `"token": "flag"`,
+		},
+		{
+			name:       "env-only default",
+			args:       []string{"user", "create", "bob"},
+			wantStdout: `"region": "eu"`,
+		},
+		{
+			name:       "string result",
+			args:       []string{"user", "delete", "bob"},
+			wantStdout: "deleted bob\n",
+		},
+		{
+			name:       "unknown flag",
+			args:       []string{"user", "create", "bob", "--nope"},
+			wantCode:   ExitUsage,
+			wantStderr: "app: unknown flag --nope\nRun 'app help user create' for usage.\n",
+		},
+		{
+			name:       "missing flag value",
+			args:       []string{"user", "create", "bob", "--age"},
+			wantCode:   ExitUsage,
+			wantStderr: "flag --age needs a value",
+		},
+		{
+			name:       "bad value",
+			args:       []string{"user", "create", "bob", "--age", "300"},
+			wantCode:   ExitUsage,
+			wantStderr: "failed to bind field Age",
+		},
+		{
+			name:       "too many arguments",
+			args:       []string{"user", "delete", "bob", "alice"},
+			wantCode:   ExitUsage,
+			wantStderr: "too many arguments: alice",
+		},
+		{
+			name:       "validation uses argument names",
+			args:       []string{"user", "create", "bo"},
+			wantCode:   ExitUsage,
+			wantStderr: "app: validation failed: name length must be at least 3",
+		},
+		{
+			name:       "unknown command",
+			args:       []string{"user", "rename"},
+			wantCode:   ExitUsage,
+			wantStderr: `app: unknown command "user rename"`,
+		},
+		{
+			name:       "group lists its commands",
+			args:       []string{"user"},
+			wantCode:   ExitUsage,
+			wantStderr: "Usage:\n  app user <command> [flags]",
+		},
+		{
+			name:       "no command",
+			args:       nil,
+			wantCode:   ExitUsage,
+			wantStderr: "Manage the app.",
+		},
+		{
+			name:       "not found",
+			args:       []string{"user", "delete", "bob", "--mode", "missing"},
+			wantCode:   ExitNotFound,
+			wantStderr: "app: user bob: not found\n",
+		},
+		{
+			name:       "forbidden",
+			args:       []string{"user", "delete", "bob", "--mode", "forbidden"},
+			wantCode:   ExitNoPerm,
+			wantStderr: "app: forbidden\n",
+		},
+		{
+			name:       "conflict",
+			args:       []string{"user", "create", "taken"},
+			wantCode:   ExitFailure,
+			wantStderr: "app: user taken: conflict\n",
+		},
+		{
+			name:       "mapped error",
+			args:       []string{"user", "delete", "bob", "--mode", "locked"},
+			wantCode:   ExitNoPerm,
+			wantStderr: "app: account locked\n",
+		},
+		{
+			name:       "exit coder",
+			args:       []string{"user", "delete", "bob", "--mode", "custom"},
+			wantCode:   3,
+			wantStderr: "app: custom failure\n",
+		},
+		{
+			name:       "internal error",
+			args:       []string{"user", "delete", "bob", "--mode", "internal"},
+			wantCode:   ExitFailure,
+			wantStderr: "app: broken\n",
+		},
+		{
+			name:       "panic",
+			args:       []string{"user", "delete", "bob", "--mode", "panic"},
+			wantCode:   ExitSoftware,
+			wantStderr: "app: internal error\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, stdout, stderr := newTestTransport(tt.env)
+			tr.Problems().Map(errLocked, 403)
+
+			code := tr.Run(context.Background(), tt.args)
+			if code != tt.wantCode {
+				t.Fatalf("exit code %d, want %d (stdout %q, stderr %q)", code, tt.wantCode, stdout, stderr)
+			}
+			if !strings.Contains(stdout.String(), tt.wantStdout) {
+				t.Fatalf("stdout %q, want it to contain %q", stdout, tt.wantStdout)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Fatalf("stderr %q, want it to contain %q", stderr, tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestExitCodeOverride(t *testing.T) {
+	tr, _, _ := newTestTransport(nil, WithExitCode(core.CategoryConflict, 9))
+	if code := tr.Run(context.Background(), []string{"user", "create", "taken"}); code != 9 {
+		t.Fatalf("exit code %d, want 9", code)
+	}
+}
+
+func TestHelp(t *testing.T) {
+	commandHelp := `Create a user and grant it roles.
+
+Usage:
+  app user create <name> [roles...] [flags]
+
+Arguments:
+  name    user name
+  roles   roles to grant
+
+Flags:
+  -a, --admin          grant admin rights
+      --age int        age in years (default "18")
+      --tag strings    labels
+      --token string   API token [$APP_TOKEN]
+  -v int               verbosity
+  -h, --help           Show this help
+
+Environment:
+  APP_REGION string   deployment region (default "eu")
+`
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "program",
+			args: []string{"help"},
+			want: `Manage the app.
+
+Usage:
+  app <command> [flags]
+
+Commands:
+  user create   Create a user
+  user delete   Delete a user
+  completion    Generate a shell completion script
+  help          Show help for a command
+
+Run 'app help <command>' for details.
+`,
+		},
+		{
+			name: "group",
+			args: []string{"user", "--help"},
+			want: `Usage:
+  app user <command> [flags]
+
+Commands:
+  user create   Create a user
+  user delete   Delete a user
+
+Run 'app help <command>' for details.
+`,
+		},
+		{name: "help command", args: []string{"help", "user", "create"}, want: commandHelp},
+		{name: "long flag", args: []string{"user", "create", "--help"}, want: commandHelp},
+		{name: "short flag", args: []string{"user", "create", "bob", "-h"}, want: commandHelp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, stdout, stderr := newTestTransport(nil)
+			if code := tr.Run(context.Background(), tt.args); code != ExitOK {
+				t.Fatalf("exit code %d, want 0 (stderr %q)", code, stderr)
+			}
+			if stdout.String() != tt.want {
+				t.Fatalf("help:\n%s\nwant:\n%s", stdout, tt.want)
+			}
+		})
+	}
+}
+
+// noop makes the structs embedding it handlers.
+type noop struct{}
+
+func (noop) Handle(context.Context) (any, error) { return nil, nil }
+
+func TestRegisterPanics(t *testing.T) {
+	type noCommand struct {
+		Meta core.Pattern `short:"nothing"`
+		noop
+	}
+	type reserved struct {
+		Meta core.Pattern `command:"help me"`
+		noop
+	}
+	type helpFlag struct {
+		Meta core.Pattern `command:"x"`
+		deleteUser
+		Host string `flag:"host,h"`
+	}
+	type gap struct {
+		Meta  core.Pattern `command:"x"`
+		First string       `arg:"0"`
+		Third string       `arg:"2"`
+		noop
+	}
+	type sliceFirst struct {
+		Meta core.Pattern `command:"x"`
+		All  []string     `arg:"0"`
+		Last string       `arg:"1"`
+		noop
+	}
+	type duplicateAlias struct {
+		Meta  core.Pattern `command:"x"`
+		Force bool         `flag:"force,f"`
+		F     bool         `flag:"f"`
+		noop
+	}
+
+	tests := []struct {
+		name      string
+		prototype core.Handler
+		wantPanic string
+	}{
+		{name: "no command", prototype: &noCommand{}, wantPanic: "missing Pattern with command tag"},
+		{name: "reserved command", prototype: &reserved{}, wantPanic: `command "help" is reserved`},
+		{name: "help alias", prototype: &helpFlag{}, wantPanic: "flag --help/-h is reserved"},
+		{name: "argument gap", prototype: &gap{}, wantPanic: "argument 1 is missing"},
+		{name: "slice argument not last", prototype: &sliceFirst{}, wantPanic: "argument 0 takes the remaining arguments"},
+		{name: "duplicate alias", prototype: &duplicateAlias{}, wantPanic: "flag -f defined twice"},
+		{name: "duplicate command", prototype: &deleteUser{}, wantPanic: `command "user delete" registered twice`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, _, _ := newTestTransport(nil)
+			defer func() {
+				msg, _ := recover().(string)
+				if !strings.Contains(msg, tt.wantPanic) {
+					t.Fatalf("Register panic %q, want %q", msg, tt.wantPanic)
+				}
+			}()
+			tr.Register(tt.prototype)
+		})
+	}
+}
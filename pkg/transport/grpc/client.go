@@ -0,0 +1,330 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client calls gRPC methods. It is meant for tests and tools: it speaks
+// to a Transport in-process (see Transport.Client) or to any gRPC server
+// over cleartext HTTP/2 (see Dial).
+//
+//	c := t.Client(grpc.WithClientCodec(grpc.JSONCodec{}))
+//	var user User
+//	err := c.Invoke(ctx, "/users.v1.UserService/GetUser", &GetUserRequest{ID: 42}, &user)
+type Client struct {
+	rt    http.RoundTripper
+	base  string
+	codec Codec
+}
+
+type ClientOption func(*Client)
+
+// WithClientCodec sets the codec used for messages, ProtoCodec by default.
+func WithClientCodec(c Codec) ClientOption {
+	return func(cl *Client) { cl.codec = c }
+}
+
+// Client returns a client that calls the transport in-process, without a
+// network connection.
+func (t *Transport) Client(opts ...ClientOption) *Client {
+	return newClient(&inProcess{handler: t}, "http://in-process", opts)
+}
+
+// Dial returns a client for the gRPC server at addr ("host:port") over
+// cleartext HTTP/2. Connections are made on first use.
+func Dial(addr string, opts ...ClientOption) *Client {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	rt := &http.Transport{
+		Protocols:   &protocols,
+		DialContext: (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+	}
+	return newClient(rt, "http://"+addr, opts)
+}
+
+func newClient(rt http.RoundTripper, base string, opts []ClientOption) *Client {
+	c := &Client{rt: rt, base: base, codec: ProtoCodec{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type metadataKey struct{}
+
+// AppendMetadata returns a context whose calls send the given key/value
+// pairs as request metadata. Values of keys ending in "-bin" are
+// base64-encoded.
+func AppendMetadata(ctx context.Context, kv ...string) context.Context {
+	md, _ := ctx.Value(metadataKey{}).(http.Header)
+	md = md.Clone()
+	if md == nil {
+		md = http.Header{}
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		md.Add(kv[i], kv[i+1])
+	}
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// Invoke calls a unary method and decodes its response into resp. A
+// failed call returns a *Status.
+func (c *Client) Invoke(ctx context.Context, method string, req, resp any) error {
+	s, err := c.Stream(ctx, method, req)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.Recv(resp); err != nil {
+		if err == io.EOF {
+			return Errorf(Internal, "no response message")
+		}
+		return err
+	}
+	if err := s.Recv(nil); err != io.EOF {
+		if err == nil {
+			return Errorf(Internal, "more than one response message")
+		}
+		return err
+	}
+	return nil
+}
+
+// Stream calls a method and returns the stream of its response messages.
+// It works for unary methods too, e.g. to read the response metadata.
+func (c *Client) Stream(ctx context.Context, method string, req any) (*ClientStream, error) {
+	data, err := c.codec.Marshal(req)
+	if err != nil {
+		return nil, Errorf(Internal, "encode request message: %v", err)
+	}
+	if !strings.HasPrefix(method, "/") {
+		method = "/" + method
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+method, bytes.NewReader(frame(data)))
+	if err != nil {
+		return nil, Errorf(Internal, "%v", err)
+	}
+	if md, ok := ctx.Value(metadataKey{}).(http.Header); ok {
+		for k, vals := range md {
+			for _, v := range vals {
+				if strings.HasSuffix(strings.ToLower(k), "-bin") {
+					v = encodeBinary(v)
+				}
+				hreq.Header.Add(k, v)
+			}
+		}
+	}
+	hreq.Header.Set("Content-Type", contentType(c.codec))
+	hreq.Header.Set("Te", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		hreq.Header.Set("Grpc-Timeout", formatTimeout(time.Until(deadline)))
+	}
+
+	resp, err := c.rt.RoundTrip(hreq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, contextStatus(ctx.Err())
+		}
+		return nil, Errorf(Unavailable, "%v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, Errorf(codeForHTTP(resp.StatusCode), "unexpected HTTP status %s", resp.Status)
+	}
+
+	s := &ClientStream{resp: resp, codec: c.codec}
+	// A trailers-only response carries the status in its headers
+	if resp.Header.Get("Grpc-Status") != "" {
+		s.status = statusFrom(resp.Header)
+	}
+	return s, nil
+}
+
+// ClientStream reads the response messages of a call.
+type ClientStream struct {
+	resp   *http.Response
+	codec  Codec
+	status *Status
+}
+
+// Header returns the response metadata.
+func (s *ClientStream) Header() http.Header {
+	return s.resp.Header
+}
+
+// Recv decodes the next message into v, or skips it when v is nil. It
+// returns io.EOF once the call ended with OK, or its *Status.
+func (s *ClientStream) Recv(v any) error {
+	if s.status == nil {
+		data, err := readFrame(s.resp.Body, s.resp.Header.Get("Grpc-Encoding"), 0)
+		switch {
+		case err != nil:
+			s.status = streamStatus(s.resp, err)
+		case data == nil:
+			s.status = statusFrom(s.resp.Trailer)
+		default:
+			if v == nil || len(data) == 0 {
+				return nil
+			}
+			if err := s.codec.Unmarshal(data, v); err != nil {
+				return Errorf(Internal, "decode response message: %v", err)
+			}
+			return nil
+		}
+	}
+
+	if s.status.Code == OK {
+		return io.EOF
+	}
+	return s.status
+}
+
+// Close releases the stream. Closing before the end cancels nothing on the
+// server by itself; cancel the call's context for that.
+func (s *ClientStream) Close() error {
+	return s.resp.Body.Close()
+}
+
+// streamStatus turns a read error into a status.
+func streamStatus(resp *http.Response, err error) *Status {
+	ctx := resp.Request.Context()
+	if ctx.Err() != nil {
+		return contextStatus(ctx.Err())
+	}
+	var st *Status
+	if errors.As(err, &st) {
+		return st
+	}
+	return Errorf(Unavailable, "%v", err)
+}
+
+func contextStatus(err error) *Status {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Errorf(DeadlineExceeded, "context deadline exceeded")
+	}
+	return Errorf(Canceled, "context canceled")
+}
+
+func statusFrom(h http.Header) *Status {
+	raw := h.Get("Grpc-Status")
+	if raw == "" {
+		return Errorf(Internal, "missing grpc-status")
+	}
+	code, err := strconv.Atoi(raw)
+	if err != nil {
+		return Errorf(Internal, "invalid grpc-status %q", raw)
+	}
+	return &Status{Code: Code(code), Message: decodeMessage(h.Get("Grpc-Message"))}
+}
+
+// codeForHTTP maps the HTTP status of a non-gRPC response, as gRPC
+// clients do.
+func codeForHTTP(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return Internal
+	case http.StatusUnauthorized:
+		return Unauthenticated
+	case http.StatusForbidden:
+		return PermissionDenied
+	case http.StatusNotFound:
+		return Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return Unavailable
+	}
+	return Unknown
+}
+
+// inProcess is a round tripper that serves requests with a handler,
+// streaming the response through a pipe.
+type inProcess struct {
+	handler http.Handler
+}
+
+func (p *inProcess) RoundTrip(req *http.Request) (*http.Response, error) {
+	pr, pw := io.Pipe()
+	w := &pipeWriter{header: http.Header{}, body: pw, ready: make(chan struct{})}
+	resp := &http.Response{
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		Body:       pr,
+		Trailer:    http.Header{},
+		Request:    req,
+	}
+
+	go func() {
+		defer func() {
+			w.mu.Lock()
+			w.writeHeader(http.StatusOK)
+			// Trailers are complete before the reader sees EOF
+			for k, vals := range w.header {
+				if name, ok := strings.CutPrefix(k, http.TrailerPrefix); ok {
+					resp.Trailer[http.CanonicalHeaderKey(name)] = vals
+				}
+			}
+			w.mu.Unlock()
+			pw.Close()
+		}()
+		p.handler.ServeHTTP(w, req)
+	}()
+
+	<-w.ready
+	resp.StatusCode = w.status
+	resp.Status = strconv.Itoa(w.status) + " " + http.StatusText(w.status)
+	resp.Header = w.sent
+	return resp, nil
+}
+
+// pipeWriter is the http.ResponseWriter of an in-process call.
+type pipeWriter struct {
+	mu     sync.Mutex
+	header http.Header
+	sent   http.Header
+	status int
+	body   *io.PipeWriter
+	ready  chan struct{}
+}
+
+func (w *pipeWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *pipeWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writeHeader(status)
+}
+
+func (w *pipeWriter) writeHeader(status int) {
+	if w.sent != nil {
+		return
+	}
+	w.status = status
+	w.sent = w.header.Clone()
+	close(w.ready)
+}
+
+func (w *pipeWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (w *pipeWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+}
+
+func encodeBinary(v string) string {
+	return base64.RawStdEncoding.EncodeToString([]byte(v))
+}
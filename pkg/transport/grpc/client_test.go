@@ -0,0 +1,306 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+type userStore struct {
+	names map[int64]string
+}
+
+type user struct {
+	ID      int64  `proto:"1" json:"id"`
+	Name    string `proto:"2" json:"name"`
+	TraceID string `proto:"3" json:"traceId"`
+}
+
+type getUserRequest struct {
+	ID    int64      `proto:"1" json:"id"`
+	Users *userStore `proto:"2" json:"users"`
+}
+
+// spoofRequest carries values for fields a message must not set.
+type spoofRequest struct {
+	ID      int64          `json:"id"`
+	TraceID string         `json:"traceid"`
+	Users   map[string]any `json:"users"`
+}
+
+type getUser struct {
+	Meta    core.Pattern `service:"users.v1.UserService" rpc:"GetUser"`
+	ID      int64        `proto:"1" json:"id" validate:"required"`
+	TraceID string       `metadata:"x-trace-id"`
+	Token   string       `metadata:"token-bin"`
+	Users   *userStore   `inject:"Users"`
+}
+
+func (h *getUser) Handle(ctx context.Context) (any, error) {
+	name, ok := h.Users.names[h.ID]
+	if !ok {
+		return nil, fmt.Errorf("user %d: %w", h.ID, core.ErrNotFound)
+	}
+	u := &user{ID: h.ID, Name: name, TraceID: h.TraceID + h.Token}
+	return core.NewResponse(200, u).WithHeader("x-user", name), nil
+}
+
+type listUsersRequest struct {
+	Count int32 `proto:"1" json:"count"`
+	Fail  bool  `proto:"2" json:"fail"`
+}
+
+type listUsers struct {
+	Meta  core.Pattern `service:"users.v1.UserService" rpc:"ListUsers"`
+	Count int32        `proto:"1" json:"count"`
+	Fail  bool         `proto:"2" json:"fail"`
+}
+
+func (h *listUsers) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+func (h *listUsers) Stream(ctx context.Context, emit core.Emit) error {
+	for i := int32(1); i <= h.Count; i++ {
+		if err := emit(core.Event{Data: &user{ID: int64(i)}}); err != nil {
+			return err
+		}
+	}
+	if h.Fail {
+		return Errorf(Aborted, "stream broken")
+	}
+	return nil
+}
+
+type abort struct {
+	Meta core.Pattern `service:"test.Errors" rpc:"Abort"`
+}
+
+func (h *abort) Handle(ctx context.Context) (any, error) {
+	return nil, &Status{Code: Aborted, Message: "100% done\nnot"}
+}
+
+type internal struct {
+	Meta core.Pattern `service:"test.Errors" rpc:"Internal"`
+}
+
+func (h *internal) Handle(ctx context.Context) (any, error) {
+	return nil, errors.New("database password is hunter2")
+}
+
+type crash struct {
+	Meta core.Pattern `service:"test.Errors" rpc:"Crash"`
+}
+
+func (h *crash) Handle(ctx context.Context) (any, error) {
+	panic("boom")
+}
+
+type slow struct {
+	Meta core.Pattern `service:"test.Errors" rpc:"Slow"`
+}
+
+func (h *slow) Handle(ctx context.Context) (any, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+type empty struct {
+	Meta core.Pattern `service:"test.Errors" rpc:"Empty"`
+}
+
+func (h *empty) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+func newTestTransport() *Transport {
+	t := New(WithPanicReporter(func(context.Context, *core.PanicError) {}))
+	t.Provide("Users", &userStore{names: map[int64]string{42: "ada"}})
+	t.Register(&getUser{})
+	t.Register(&listUsers{})
+	t.Register(&abort{})
+	t.Register(&internal{})
+	t.Register(&crash{})
+	t.Register(&slow{})
+	t.Register(&empty{})
+	return t
+}
+
+func TestInvoke(t *testing.T) {
+	tr := newTestTransport()
+
+	tests := []struct {
+		name     string
+		method   string
+		codec    Codec
+		metadata []string
+		req      any
+		want     *user
+		wantCode Code
+		wantMsg  string
+	}{
+		{name: "proto", method: "/users.v1.UserService/GetUser", req: &getUserRequest{ID: 42}, want: &user{ID: 42, Name: "ada"}},
+		{name: "json", method: "users.v1.UserService/GetUser", codec: JSONCodec{}, req: &getUserRequest{ID: 42}, want: &user{ID: 42, Name: "ada"}},
+		{
+			name:     "metadata",
+			method:   "/users.v1.UserService/GetUser",
+			metadata: []string{"x-trace-id", "abc", "token-bin", "\x00\xff"},
+			req:      &getUserRequest{ID: 42},
+			want:     &user{ID: 42, Name: "ada", TraceID: "abc\x00\xff"},
+		},
+		{
+			name:   "message cannot replace injected fields",
+			method: "/users.v1.UserService/GetUser",
+			codec:  JSONCodec{},
+			req:    &getUserRequest{ID: 42, Users: &userStore{}},
+			want:   &user{ID: 42, Name: "ada"},
+		},
+		{
+			name:   "message cannot set metadata fields",
+			method: "/users.v1.UserService/GetUser",
+			codec:  JSONCodec{},
+			req:    &spoofRequest{ID: 42, TraceID: "spoofed"},
+			want:   &user{ID: 42, Name: "ada"},
+		},
+		{name: "validation", method: "/users.v1.UserService/GetUser", req: &getUserRequest{}, wantCode: InvalidArgument},
+		{name: "problem mapping", method: "/users.v1.UserService/GetUser", req: &getUserRequest{ID: 7}, wantCode: NotFound, wantMsg: "user 7: not found"},
+		{name: "unknown method", method: "/users.v1.UserService/Nope", req: &getUserRequest{}, wantCode: Unimplemented},
+		{name: "explicit status", method: "/test.Errors/Abort", req: &getUserRequest{}, wantCode: Aborted, wantMsg: "100% done\nnot"},
+		{name: "internal details hidden", method: "/test.Errors/Internal", req: &getUserRequest{}, wantCode: Internal, wantMsg: "Internal Server Error"},
+		{name: "panic", method: "/test.Errors/Crash", req: &getUserRequest{}, wantCode: Internal},
+		{name: "no response message", method: "/test.Errors/Empty", req: &getUserRequest{}, want: &user{}},
+		{name: "streaming method with one message", method: "/users.v1.UserService/ListUsers", req: &listUsersRequest{Count: 1}, want: &user{ID: 1}},
+		{name: "streaming method with two messages", method: "/users.v1.UserService/ListUsers", req: &listUsersRequest{Count: 2}, wantCode: Internal, wantMsg: "more than one response message"},
+		{name: "streaming method without messages", method: "/users.v1.UserService/ListUsers", req: &listUsersRequest{}, wantCode: Internal, wantMsg: "no response message"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []ClientOption
+			if tt.codec != nil {
+				opts = append(opts, WithClientCodec(tt.codec))
+			}
+			c := tr.Client(opts...)
+			ctx := AppendMetadata(context.Background(), tt.metadata...)
+
+			var got user
+			err := c.Invoke(ctx, tt.method, tt.req, &got)
+			if tt.wantCode != OK {
+				var st *Status
+				if !errors.As(err, &st) || st.Code != tt.wantCode {
+					t.Fatalf("Invoke error %v, want %s", err, tt.wantCode)
+				}
+				if tt.wantMsg != "" && st.Message != tt.wantMsg {
+					t.Fatalf("Invoke message %q, want %q", st.Message, tt.wantMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Invoke: %v", err)
+			}
+			if !reflect.DeepEqual(&got, tt.want) {
+				t.Fatalf("Invoke = %+v, want %+v", got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeMessage(t *testing.T) {
+	tr := newTestTransport()
+	m := tr.methods["/users.v1.UserService/GetUser"]
+
+	var h getUser
+	data := []byte(`{"id":42,"traceid":"spoofed","users":{},"meta":{}}`)
+	if err := m.decode(JSONCodec{}, data, reflect.ValueOf(&h).Elem()); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if h.ID != 42 || h.TraceID != "" || h.Users != nil {
+		t.Fatalf("decoded %+v, want only ID set", h)
+	}
+}
+
+func TestStream(t *testing.T) {
+	tr := newTestTransport()
+
+	tests := []struct {
+		name     string
+		req      *listUsersRequest
+		wantIDs  []int64
+		wantCode Code
+	}{
+		{name: "messages", req: &listUsersRequest{Count: 3}, wantIDs: []int64{1, 2, 3}},
+		{name: "no messages", req: &listUsersRequest{}},
+		{name: "error after messages", req: &listUsersRequest{Count: 2, Fail: true}, wantIDs: []int64{1, 2}, wantCode: Aborted},
+		{name: "error without messages", req: &listUsersRequest{Fail: true}, wantCode: Aborted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tr.Client().Stream(context.Background(), "/users.v1.UserService/ListUsers", tt.req)
+			if err != nil {
+				t.Fatalf("Stream: %v", err)
+			}
+			defer s.Close()
+
+			var ids []int64
+			for {
+				var u user
+				err = s.Recv(&u)
+				if err != nil {
+					break
+				}
+				ids = append(ids, u.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Fatalf("received %v, want %v", ids, tt.wantIDs)
+			}
+
+			if tt.wantCode == OK {
+				if err != io.EOF {
+					t.Fatalf("Recv error %v, want io.EOF", err)
+				}
+			} else if st, ok := err.(*Status); !ok || st.Code != tt.wantCode {
+				t.Fatalf("Recv error %v, want %s", err, tt.wantCode)
+			}
+			// The end of the stream is sticky
+			if again := s.Recv(nil); again != err {
+				t.Fatalf("second Recv error %v, want %v", again, err)
+			}
+		})
+	}
+}
+
+func TestResponseMetadata(t *testing.T) {
+	s, err := newTestTransport().Client().Stream(context.Background(), "/users.v1.UserService/GetUser", &getUserRequest{ID: 42})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	defer s.Close()
+
+	if got := s.Header().Get("X-User"); got != "ada" {
+		t.Fatalf("x-user metadata %q, want ada", got)
+	}
+	if got := s.Header().Get("Content-Type"); got != "application/grpc+proto" {
+		t.Fatalf("Content-Type %q, want application/grpc+proto", got)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	tr := newTestTransport()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := tr.Client().Invoke(ctx, "/test.Errors/Slow", &getUserRequest{}, &user{})
+	if st, ok := err.(*Status); !ok || st.Code != DeadlineExceeded {
+		t.Fatalf("Invoke error %v, want DEADLINE_EXCEEDED", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = tr.Client().Invoke(ctx, "/test.Errors/Slow", &getUserRequest{}, &user{})
+	if st, ok := err.(*Status); !ok || st.Code != Canceled {
+		t.Fatalf("Invoke error %v, want CANCELLED", err)
+	}
+}
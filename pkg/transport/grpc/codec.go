@@ -0,0 +1,64 @@
+package grpc
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// Codec encodes messages for one gRPC content-subtype, the part after
+// "application/grpc+" in the Content-Type.
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec encodes messages with encoding/json ("application/grpc+json").
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string                       { return "json" }
+func (JSONCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (JSONCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// codecs is the registry of a transport, by name.
+type codecs struct {
+	mu     sync.RWMutex
+	byName map[string]Codec
+}
+
+func newCodecs() *codecs {
+	return &codecs{byName: map[string]Codec{
+		"proto": ProtoCodec{},
+		"json":  JSONCodec{},
+	}}
+}
+
+func (c *codecs) add(codec Codec) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.byName[codec.Name()] = codec
+}
+
+// forContentType returns the codec of a gRPC content type. A plain
+// "application/grpc" means proto.
+func (c *codecs) forContentType(contentType string) (Codec, bool) {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType != "application/grpc" && !strings.HasPrefix(mediaType, "application/grpc+") {
+		return nil, false
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(mediaType, "application/grpc"), "+")
+	if name == "" {
+		name = "proto"
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	codec, ok := c.byName[name]
+	return codec, ok
+}
+
+func contentType(codec Codec) string {
+	return "application/grpc+" + codec.Name()
+}
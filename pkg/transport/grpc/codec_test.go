@@ -0,0 +1,285 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type inner struct {
+	Name string `proto:"1"`
+}
+
+type wireMessage struct {
+	ID      int64            `proto:"1"`
+	Name    string           `proto:"2"`
+	Inner   inner            `proto:"3"`
+	Packed  []int32          `proto:"4"`
+	Delta   int32            `proto:"5,zigzag"`
+	Hash    uint64           `proto:"6,fixed"`
+	Small   int32            `proto:"7,fixed"`
+	Score   float64          `proto:"8"`
+	Ratio   float32          `proto:"9"`
+	Ok      bool             `proto:"10"`
+	Data    []byte           `proto:"11"`
+	Opt     *int32           `proto:"12"`
+	Tags    []string         `proto:"13"`
+	Items   []*inner         `proto:"14"`
+	Labels  map[string]int32 `proto:"15"`
+	Ignored string
+}
+
+func TestProtoMarshal(t *testing.T) {
+	zero := int32(0)
+	tests := []struct {
+		name string
+		msg  any
+		want string // hex
+	}{
+		{name: "empty", msg: &wireMessage{}, want: ""},
+		{name: "varint", msg: &wireMessage{ID: 150}, want: "089601"},
+		{name: "negative varint", msg: &wireMessage{ID: -1}, want: "08ffffffffffffffffff01"},
+		{name: "string", msg: &wireMessage{Name: "testing"}, want: "120774657374696e67"},
+		{name: "nested message", msg: &wireMessage{Inner: inner{Name: "a"}}, want: "1a030a0161"},
+		{name: "packed", msg: &wireMessage{Packed: []int32{3, 270, 86942}}, want: "2206038e029ea705"},
+		{name: "zigzag", msg: &wireMessage{Delta: -2}, want: "2803"},
+		{name: "fixed64", msg: &wireMessage{Hash: 1}, want: "310100000000000000"},
+		{name: "fixed32", msg: &wireMessage{Small: -1}, want: "3dffffffff"},
+		{name: "double", msg: &wireMessage{Score: 1}, want: "41000000000000f03f"},
+		{name: "float", msg: &wireMessage{Ratio: 1}, want: "4d0000803f"},
+		{name: "bool", msg: &wireMessage{Ok: true}, want: "5001"},
+		{name: "bytes", msg: &wireMessage{Data: []byte{1, 2}}, want: "5a020102"},
+		{name: "optional zero is sent", msg: &wireMessage{Opt: &zero}, want: "6000"},
+		{name: "repeated strings", msg: &wireMessage{Tags: []string{"a", "b"}}, want: "6a01616a0162"},
+		{name: "repeated messages", msg: &wireMessage{Items: []*inner{{Name: "a"}, {}}}, want: "72030a01617200"},
+		{name: "map sorted by key", msg: &wireMessage{Labels: map[string]int32{"b": 2, "a": 1}}, want: "7a050a016110017a050a01621002"},
+		{name: "untagged ignored", msg: &wireMessage{Ignored: "x"}, want: ""},
+		{name: "nil pointer", msg: (*wireMessage)(nil), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ProtoCodec{}.Marshal(tt.msg)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if hex.EncodeToString(got) != tt.want {
+				t.Fatalf("Marshal = %x, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	opt := int32(7)
+	msg := &wireMessage{
+		ID:     -42,
+		Name:   "ada",
+		Inner:  inner{Name: "inner"},
+		Packed: []int32{1, -1, 300},
+		Delta:  -12345,
+		Hash:   1 << 60,
+		Small:  -5,
+		Score:  3.5,
+		Ratio:  0.25,
+		Ok:     true,
+		Data:   []byte("raw"),
+		Opt:    &opt,
+		Tags:   []string{"x", "", "y"},
+		Items:  []*inner{{Name: "a"}, {Name: "b"}},
+		Labels: map[string]int32{"one": 1, "zero": 0},
+	}
+
+	data, err := ProtoCodec{}.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got wireMessage
+	if err := (ProtoCodec{}).Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(&got, msg) {
+		t.Fatalf("round trip = %+v, want %+v", got, *msg)
+	}
+}
+
+func TestProtoUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string // hex
+		want    wireMessage
+		wantErr string
+	}{
+		{name: "unknown fields skipped", data: "a00601" + "a2060161" + "089601", want: wireMessage{ID: 150}},
+		{name: "unpacked repeated scalars", data: "20012002", want: wireMessage{Packed: []int32{1, 2}}},
+		{name: "last value wins", data: "08010802", want: wireMessage{ID: 2}},
+		{name: "truncated varint", data: "0896", wantErr: "truncated"},
+		{name: "truncated length", data: "1205616263", wantErr: "truncated"},
+		{name: "truncated fixed", data: "3101", wantErr: "truncated"},
+		{name: "wrong wire type", data: "1001", wantErr: "field Name: wire type 0 for a string"},
+		{name: "overflow", data: "20ffffffff1f", wantErr: "overflows int32"},
+		{name: "unsupported wire type", data: "0b", wantErr: "unsupported wire type 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got wireMessage
+			err = ProtoCodec{}.Unmarshal(data, &got)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Unmarshal error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Unmarshal = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+type badNumber struct {
+	A int `proto:"x"`
+}
+
+type duplicateNumber struct {
+	A int `proto:"1"`
+	B int `proto:"1"`
+}
+
+type unsupportedField struct {
+	C chan int `proto:"1"`
+}
+
+func TestProtoErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     any
+		wantErr string
+	}{
+		{name: "not a struct", msg: 42, wantErr: "need a struct"},
+		{name: "invalid field number", msg: &badNumber{A: 1}, wantErr: `invalid field number "x"`},
+		{name: "duplicate field number", msg: &duplicateNumber{}, wantErr: "used twice"},
+		{name: "unsupported type", msg: &unsupportedField{C: make(chan int)}, wantErr: "unsupported type"},
+		{name: "nil element", msg: &wireMessage{Items: []*inner{nil}}, wantErr: "nil element"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ProtoCodec{}.Marshal(tt.msg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Marshal error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	var n int
+	if err := (ProtoCodec{}).Unmarshal(nil, &n); err == nil || !strings.Contains(err.Error(), "pointer to a struct") {
+		t.Fatalf("Unmarshal into *int error %v, want pointer to a struct", err)
+	}
+}
+
+func TestForContentType(t *testing.T) {
+	c := newCodecs()
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{contentType: "application/grpc", want: "proto"},
+		{contentType: "application/grpc+proto", want: "proto"},
+		{contentType: "application/grpc+json", want: "json"},
+		{contentType: "Application/GRPC+JSON; charset=utf-8", want: "json"},
+		{contentType: "application/grpc+xml"},
+		{contentType: "application/json"},
+		{contentType: "application/grpcweb"},
+		{contentType: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			codec, ok := c.forContentType(tt.contentType)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("forContentType = %s, want none", codec.Name())
+				}
+				return
+			}
+			if !ok || codec.Name() != tt.want {
+				t.Fatalf("forContentType = %v, %v, want %s", codec, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrame(t *testing.T) {
+	msg := []byte("hello")
+	got, err := readFrame(bytes.NewReader(frame(msg)), "", 0)
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("readFrame = %q, %v, want hello", got, err)
+	}
+
+	if got, err := readFrame(bytes.NewReader(nil), "", 0); got != nil || err != nil {
+		t.Fatalf("readFrame of empty body = %q, %v, want nil", got, err)
+	}
+
+	_, err = readFrame(bytes.NewReader(frame(msg)), "", 4)
+	if st, ok := err.(*Status); !ok || st.Code != ResourceExhausted {
+		t.Fatalf("readFrame over limit error %v, want RESOURCE_EXHAUSTED", err)
+	}
+
+	_, err = readFrame(bytes.NewReader(frame(msg)[:7]), "", 0)
+	if st, ok := err.(*Status); !ok || st.Code != InvalidArgument {
+		t.Fatalf("readFrame of short frame error %v, want INVALID_ARGUMENT", err)
+	}
+
+	compressed := frame(msg)
+	compressed[0] = 1
+	_, err = readFrame(bytes.NewReader(compressed), "deflate", 0)
+	if st, ok := err.(*Status); !ok || st.Code != Unimplemented {
+		t.Fatalf("readFrame with unknown encoding error %v, want UNIMPLEMENTED", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "100m", want: "100ms"},
+		{value: "5S", want: "5s"},
+		{value: "2H", want: "2h0m0s"},
+		{value: "1n", want: "1ns"},
+		{value: "1", wantErr: true},
+		{value: "10x", wantErr: true},
+		{value: "-1S", wantErr: true},
+		{value: "123456789S", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			d, err := parseTimeout(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTimeout = %s, want error", d)
+				}
+				return
+			}
+			if err != nil || d.String() != tt.want {
+				t.Fatalf("parseTimeout = %s, %v, want %s", d, err, tt.want)
+			}
+			if back, err := parseTimeout(formatTimeout(d)); err != nil || back != d {
+				t.Fatalf("formatTimeout(%s) = %q, parses as %s, %v", d, formatTimeout(d), back, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,531 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ProtoCodec encodes structs in the protobuf wire format without generated
+// code. Field numbers come from `proto` tags; untagged fields are ignored:
+//
+//	type GetUserRequest struct {
+//		ID     int64    `proto:"1"`
+//		Fields []string `proto:"2"`
+//		Delta  int32    `proto:"3,zigzag"` // sint32
+//		Hash   uint64   `proto:"4,fixed"`  // fixed64
+//	}
+//
+// Supported field types are bool, integers, floats, strings, []byte, nested
+// structs (messages), pointers to these, slices (repeated; scalars are
+// packed) and maps with scalar or string keys. Zero scalars are omitted as
+// in proto3; a pointer marks an optional field. Unknown fields are skipped
+// when decoding.
+type ProtoCodec struct{}
+
+func (ProtoCodec) Name() string { return "proto" }
+
+func (ProtoCodec) Marshal(v any) ([]byte, error) {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil, nil
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("proto: cannot marshal %T, need a struct", v)
+	}
+	return appendMessage(nil, val)
+}
+
+func (ProtoCodec) Unmarshal(data []byte, v any) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("proto: cannot unmarshal into %T, need a pointer to a struct", v)
+	}
+	return unmarshalMessage(data, val.Elem())
+}
+
+// Wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("proto: truncated message")
+
+type protoField struct {
+	num    int
+	index  []int
+	name   string
+	zigzag bool
+	fixed  bool
+}
+
+type protoMessage struct {
+	fields []protoField
+	byNum  map[int]*protoField
+}
+
+var protoMessages sync.Map // reflect.Type -> *protoMessage
+
+func messageOf(typ reflect.Type) (*protoMessage, error) {
+	if m, ok := protoMessages.Load(typ); ok {
+		return m.(*protoMessage), nil
+	}
+
+	m := &protoMessage{byNum: map[int]*protoField{}}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, ok := field.Tag.Lookup("proto")
+		if !ok || !field.IsExported() {
+			continue
+		}
+		numStr, opts, _ := strings.Cut(tag, ",")
+		num, err := strconv.Atoi(numStr)
+		if err != nil || num < 1 || num > 1<<29-1 {
+			return nil, fmt.Errorf("proto: %s.%s: invalid field number %q", typ.Name(), field.Name, numStr)
+		}
+		if _, dup := m.byNum[num]; dup {
+			return nil, fmt.Errorf("proto: %s.%s: field number %d used twice", typ.Name(), field.Name, num)
+		}
+		m.byNum[num] = nil
+		f := protoField{num: num, index: field.Index, name: field.Name}
+		for opt := range strings.SplitSeq(opts, ",") {
+			switch strings.TrimSpace(opt) {
+			case "zigzag":
+				f.zigzag = true
+			case "fixed":
+				f.fixed = true
+			}
+		}
+		m.fields = append(m.fields, f)
+	}
+	sort.Slice(m.fields, func(i, j int) bool { return m.fields[i].num < m.fields[j].num })
+	for i := range m.fields {
+		m.byNum[m.fields[i].num] = &m.fields[i]
+	}
+
+	actual, _ := protoMessages.LoadOrStore(typ, m)
+	return actual.(*protoMessage), nil
+}
+
+func appendMessage(b []byte, val reflect.Value) ([]byte, error) {
+	m, err := messageOf(val.Type())
+	if err != nil {
+		return nil, err
+	}
+	for i := range m.fields {
+		f := &m.fields[i]
+		if b, err = appendField(b, f, val.FieldByIndex(f.index)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func appendField(b []byte, f *protoField, v reflect.Value) ([]byte, error) {
+	switch {
+	case v.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			return b, nil
+		}
+		// An optional field is sent even when zero
+		return appendValue(b, f, v.Elem())
+	case isBytes(v.Type()):
+		if v.Len() == 0 {
+			return b, nil
+		}
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		return appendRepeated(b, f, v)
+	case v.Kind() == reflect.Map:
+		return appendMap(b, f, v)
+	case v.IsZero():
+		return b, nil
+	}
+	return appendValue(b, f, v)
+}
+
+func appendRepeated(b []byte, f *protoField, v reflect.Value) ([]byte, error) {
+	if v.Len() == 0 {
+		return b, nil
+	}
+	elem := v.Type().Elem()
+	if isScalar(elem) {
+		var packed []byte
+		for i := 0; i < v.Len(); i++ {
+			var err error
+			if packed, err = appendScalar(packed, f, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		b = appendTag(b, f.num, wireBytes)
+		b = binary.AppendUvarint(b, uint64(len(packed)))
+		return append(b, packed...), nil
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		e := v.Index(i)
+		if e.Kind() == reflect.Ptr {
+			if e.IsNil() {
+				return nil, fmt.Errorf("proto: field %s: nil element", f.name)
+			}
+			e = e.Elem()
+		}
+		var err error
+		if b, err = appendValue(b, f, e); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// appendMap encodes each entry as a message with the key as field 1 and
+// the value as field 2. Entries are sorted so the output is stable.
+func appendMap(b []byte, f *protoField, v reflect.Value) ([]byte, error) {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+
+	keyField, valField := &protoField{num: 1, name: f.name}, &protoField{num: 2, name: f.name}
+	for _, k := range keys {
+		entry, err := appendValue(nil, keyField, k)
+		if err != nil {
+			return nil, err
+		}
+		val := v.MapIndex(k)
+		if val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				return nil, fmt.Errorf("proto: field %s: nil map value", f.name)
+			}
+			val = val.Elem()
+		}
+		if entry, err = appendValue(entry, valField, val); err != nil {
+			return nil, err
+		}
+		b = appendTag(b, f.num, wireBytes)
+		b = binary.AppendUvarint(b, uint64(len(entry)))
+		b = append(b, entry...)
+	}
+	return b, nil
+}
+
+// appendValue encodes a single non-repeated value with its tag.
+func appendValue(b []byte, f *protoField, v reflect.Value) ([]byte, error) {
+	switch {
+	case v.Kind() == reflect.String:
+		b = appendTag(b, f.num, wireBytes)
+		b = binary.AppendUvarint(b, uint64(v.Len()))
+		return append(b, v.String()...), nil
+	case isBytes(v.Type()):
+		b = appendTag(b, f.num, wireBytes)
+		b = binary.AppendUvarint(b, uint64(v.Len()))
+		return append(b, v.Bytes()...), nil
+	case v.Kind() == reflect.Struct:
+		msg, err := appendMessage(nil, v)
+		if err != nil {
+			return nil, err
+		}
+		b = appendTag(b, f.num, wireBytes)
+		b = binary.AppendUvarint(b, uint64(len(msg)))
+		return append(b, msg...), nil
+	case isScalar(v.Type()):
+		b = appendTag(b, f.num, scalarWireType(f, v.Type()))
+		return appendScalar(b, f, v)
+	}
+	return nil, fmt.Errorf("proto: field %s: unsupported type %s", f.name, v.Type())
+}
+
+// appendScalar encodes a numeric or bool value without tag.
+func appendScalar(b []byte, f *protoField, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 1), nil
+		}
+		return append(b, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := v.Int()
+		switch {
+		case f.fixed && is32(v.Type()):
+			return binary.LittleEndian.AppendUint32(b, uint32(n)), nil
+		case f.fixed:
+			return binary.LittleEndian.AppendUint64(b, uint64(n)), nil
+		case f.zigzag:
+			return binary.AppendUvarint(b, uint64(n<<1)^uint64(n>>63)), nil
+		}
+		return binary.AppendUvarint(b, uint64(n)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := v.Uint()
+		switch {
+		case f.fixed && is32(v.Type()):
+			return binary.LittleEndian.AppendUint32(b, uint32(n)), nil
+		case f.fixed:
+			return binary.LittleEndian.AppendUint64(b, n), nil
+		}
+		return binary.AppendUvarint(b, n), nil
+	case reflect.Float32:
+		return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(v.Float())), nil
+	}
+	return nil, fmt.Errorf("proto: field %s: unsupported type %s", f.name, v.Type())
+}
+
+func appendTag(b []byte, num, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(wire))
+}
+
+func scalarWireType(f *protoField, typ reflect.Type) int {
+	switch typ.Kind() {
+	case reflect.Float32:
+		return wireFixed32
+	case reflect.Float64:
+		return wireFixed64
+	}
+	if f.fixed {
+		if is32(typ) {
+			return wireFixed32
+		}
+		return wireFixed64
+	}
+	return wireVarint
+}
+
+func unmarshalMessage(data []byte, val reflect.Value) error {
+	m, err := messageOf(val.Type())
+	if err != nil {
+		return err
+	}
+
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errTruncated
+		}
+		data = data[n:]
+		num, wire := int(key>>3), int(key&7)
+
+		raw, rest, err := readValue(data, wire)
+		if err != nil {
+			return err
+		}
+		data = rest
+
+		f, ok := m.byNum[num]
+		if !ok {
+			continue
+		}
+		if err := decodeField(f, val.FieldByIndex(f.index), wire, raw); err != nil {
+			return fmt.Errorf("proto: field %s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// readValue splits the value of the given wire type off data. Varints are
+// returned with their encoding, length-delimited values without the length.
+func readValue(data []byte, wire int) (raw, rest []byte, err error) {
+	switch wire {
+	case wireVarint:
+		_, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, nil, errTruncated
+		}
+		return data[:n], data[n:], nil
+	case wireFixed64:
+		if len(data) < 8 {
+			return nil, nil, errTruncated
+		}
+		return data[:8], data[8:], nil
+	case wireFixed32:
+		if len(data) < 4 {
+			return nil, nil, errTruncated
+		}
+		return data[:4], data[4:], nil
+	case wireBytes:
+		l, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < l {
+			return nil, nil, errTruncated
+		}
+		return data[n : n+int(l)], data[n+int(l):], nil
+	}
+	return nil, nil, fmt.Errorf("proto: unsupported wire type %d", wire)
+}
+
+func decodeField(f *protoField, v reflect.Value, wire int, raw []byte) error {
+	switch {
+	case v.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeValue(f, v.Elem(), wire, raw)
+	case isBytes(v.Type()):
+		return decodeValue(f, v, wire, raw)
+	case v.Kind() == reflect.Slice:
+		elem := v.Type().Elem()
+		if wire == wireBytes && isScalar(elem) {
+			// Packed
+			wt := scalarWireType(f, elem)
+			for len(raw) > 0 {
+				item, rest, err := readValue(raw, wt)
+				if err != nil {
+					return err
+				}
+				raw = rest
+				e := reflect.New(elem).Elem()
+				if err := decodeValue(f, e, wt, item); err != nil {
+					return err
+				}
+				v.Set(reflect.Append(v, e))
+			}
+			return nil
+		}
+		e := reflect.New(elem).Elem()
+		if err := decodeField(f, e, wire, raw); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, e))
+		return nil
+	case v.Kind() == reflect.Map:
+		return decodeMapEntry(f, v, wire, raw)
+	}
+	return decodeValue(f, v, wire, raw)
+}
+
+func decodeMapEntry(f *protoField, v reflect.Value, wire int, raw []byte) error {
+	if wire != wireBytes {
+		return fmt.Errorf("wire type %d for a map entry", wire)
+	}
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+
+	key := reflect.New(v.Type().Key()).Elem()
+	val := reflect.New(v.Type().Elem()).Elem()
+	entry := &protoField{name: f.name}
+	for len(raw) > 0 {
+		k, n := binary.Uvarint(raw)
+		if n <= 0 {
+			return errTruncated
+		}
+		raw = raw[n:]
+		item, rest, err := readValue(raw, int(k&7))
+		if err != nil {
+			return err
+		}
+		raw = rest
+		switch k >> 3 {
+		case 1:
+			err = decodeField(entry, key, int(k&7), item)
+		case 2:
+			err = decodeField(entry, val, int(k&7), item)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	v.SetMapIndex(key, val)
+	return nil
+}
+
+// decodeValue decodes a single value into v, a non-repeated field.
+func decodeValue(f *protoField, v reflect.Value, wire int, raw []byte) error {
+	switch {
+	case v.Kind() == reflect.String:
+		if wire != wireBytes {
+			return fmt.Errorf("wire type %d for a string", wire)
+		}
+		v.SetString(string(raw))
+		return nil
+	case isBytes(v.Type()):
+		if wire != wireBytes {
+			return fmt.Errorf("wire type %d for bytes", wire)
+		}
+		v.SetBytes(append([]byte(nil), raw...))
+		return nil
+	case v.Kind() == reflect.Struct:
+		if wire != wireBytes {
+			return fmt.Errorf("wire type %d for a message", wire)
+		}
+		return unmarshalMessage(raw, v)
+	}
+
+	var bits uint64
+	switch wire {
+	case wireVarint:
+		bits, _ = binary.Uvarint(raw)
+	case wireFixed32:
+		bits = uint64(binary.LittleEndian.Uint32(raw))
+	case wireFixed64:
+		bits = binary.LittleEndian.Uint64(raw)
+	default:
+		return fmt.Errorf("wire type %d for %s", wire, v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(bits != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := int64(bits)
+		switch {
+		case f.zigzag && wire == wireVarint:
+			n = int64(bits>>1) ^ -int64(bits&1)
+		case wire == wireFixed32:
+			n = int64(int32(bits))
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("value %d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.OverflowUint(bits) {
+			return fmt.Errorf("value %d overflows %s", bits, v.Type())
+		}
+		v.SetUint(bits)
+	case reflect.Float32:
+		if wire != wireFixed32 {
+			return fmt.Errorf("wire type %d for float", wire)
+		}
+		v.SetFloat(float64(math.Float32frombits(uint32(bits))))
+	case reflect.Float64:
+		if wire != wireFixed64 {
+			return fmt.Errorf("wire type %d for double", wire)
+		}
+		v.SetFloat(math.Float64frombits(bits))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func isBytes(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8
+}
+
+func isScalar(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func is32(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package grpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+// ServeHTTP serves a gRPC call. The transport can be mounted on any
+// http.Server that speaks HTTP/2.
+func (t *Transport) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	codec, ok := t.codecs.forContentType(req.Header.Get("Content-Type"))
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	s := &serverStream{w: w, codec: codec}
+	w.Header().Set("Content-Type", contentType(codec))
+
+	t.mu.RLock()
+	m, ok := t.methods[req.URL.Path]
+	t.mu.RUnlock()
+	if !ok {
+		s.finish(Errorf(Unimplemented, "unknown method %s", req.URL.Path))
+		return
+	}
+
+	ctx := req.Context()
+	if timeout := req.Header.Get("Grpc-Timeout"); timeout != "" {
+		d, err := parseTimeout(timeout)
+		if err != nil {
+			s.finish(Errorf(InvalidArgument, "invalid grpc-timeout %q", timeout))
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	ctx = context.WithValue(ctx, "http_request", req)
+
+	s.finish(t.call(ctx, s, m, req))
+}
+
+// call runs a method and returns its final status, nil for OK.
+func (t *Transport) call(ctx context.Context, s *serverStream, m *method, req *http.Request) error {
+	data, err := readFrame(req.Body, req.Header.Get("Grpc-Encoding"), t.maxMessageSize)
+	if err != nil {
+		return err
+	}
+
+	// Create new instance
+	newVal := reflect.New(m.prototype.Elem().Type()).Elem()
+	newVal.Set(m.prototype.Elem())
+	instance := newVal.Addr().Interface()
+
+	if len(data) > 0 {
+		if err := m.decode(s.codec, data, newVal); err != nil {
+			return Errorf(InvalidArgument, "invalid request message: %v", err)
+		}
+	}
+	if err := m.plan.Bind(newVal, metadataValues{header: req.Header}); err != nil {
+		return Errorf(InvalidArgument, "invalid metadata: %v", err)
+	}
+
+	// Inject dependencies after decoding, so messages cannot replace them.
+	// Scoped ones live for this call.
+	scope := t.Container().NewScope(ctx)
+	defer scope.Close(core.ErrScopeAborted)
+	if err := scope.Inject(instance); err != nil {
+		return t.toStatus(err)
+	}
+
+	if err := core.Validate(instance); err != nil {
+		return t.toStatus(err)
+	}
+
+	if m.stream {
+		err = t.runStream(ctx, s, m, scope, instance.(core.Streamer))
+	} else {
+		err = t.runUnary(ctx, s, m, scope, instance.(core.Handler))
+	}
+	if err == nil {
+		return nil
+	}
+	var pe *core.PanicError
+	if errors.As(err, &pe) {
+		core.ReportPanic(ctx, pe, t.PanicReporter, t.Logger, "Method", "method")
+	}
+	return t.toStatus(err)
+}
+
+// decode unmarshals a request message into the body field of elem or,
+// without one, into a copy of elem whose message fields are then copied
+// back, so a message cannot set dependencies, metadata or the Pattern.
+func (m *method) decode(codec Codec, data []byte, elem reflect.Value) error {
+	if body := m.plan.Body(elem); body != nil {
+		return codec.Unmarshal(data, body)
+	}
+
+	msg := reflect.New(elem.Type())
+	msg.Elem().Set(elem)
+	if err := codec.Unmarshal(data, msg.Interface()); err != nil {
+		return err
+	}
+	for _, index := range m.fields {
+		elem.FieldByIndex(index).Set(msg.Elem().FieldByIndex(index))
+	}
+	return nil
+}
+
+// messageFields lists the fields of typ a request message may set: those
+// a payload may set (see core.PayloadField) that are not bound from
+// metadata. Embedded structs are searched too.
+func messageFields(typ reflect.Type, parent []int) [][]int {
+	var fields [][]int
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		index := append(slices.Clone(parent), i)
+		switch {
+		case !field.IsExported() && !field.Anonymous:
+		case !core.PayloadField(field):
+		case field.Tag.Get("metadata") != "":
+		case field.Anonymous && field.Type.Kind() == reflect.Struct:
+			fields = append(fields, messageFields(field.Type, index)...)
+		case field.IsExported():
+			fields = append(fields, index)
+		}
+	}
+	return fields
+}
+
+// runUnary runs h and sends its result. Scoped dependencies are cleaned
+// up before, so that e.g. a failed commit is reported.
+func (t *Transport) runUnary(ctx context.Context, s *serverStream, m *method, scope *core.Container, h core.Handler) error {
+	res, err := core.SafeHandle(ctx, h, m.name)
+	core.CloseScope(scope, &err, t.Logger)
+	if err != nil {
+		return err
+	}
+
+	// Headers of the result become response metadata
+	for v := res; v != nil; {
+		if hp, ok := v.(core.HeaderProvider); ok {
+			for k, vals := range hp.Headers() {
+				for _, val := range vals {
+					s.w.Header().Add(k, val)
+				}
+			}
+		}
+		env, ok := v.(core.Envelope)
+		if !ok {
+			break
+		}
+		v = env.Unwrap()
+	}
+	return s.send(core.Unwrap(res))
+}
+
+func (t *Transport) runStream(ctx context.Context, s *serverStream, m *method, scope *core.Container, st core.Streamer) (err error) {
+	defer core.CloseScope(scope, &err, t.Logger)
+	defer core.RecoverPanic(m.name, st, &err)
+	return st.Stream(ctx, func(ev core.Event) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return s.send(ev.Data)
+	})
+}
+
+// serverStream writes the response of a call.
+type serverStream struct {
+	w     http.ResponseWriter
+	codec Codec
+
+	mu   sync.Mutex
+	sent bool
+}
+
+// send writes one response message.
+func (s *serverStream) send(v any) error {
+	var data []byte
+	if v != nil {
+		var err error
+		if data, err = s.codec.Marshal(v); err != nil {
+			return fmt.Errorf("encode response message: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = true
+	if _, err := s.w.Write(frame(data)); err != nil {
+		return err
+	}
+	if err := http.NewResponseController(s.w).Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// finish ends the call with the status of err. Without messages the
+// status is sent in the headers (a trailers-only response), otherwise in
+// the trailers.
+func (s *serverStream) finish(err error) {
+	st := &Status{Code: OK}
+	if err != nil && !errors.As(err, &st) {
+		st = &Status{Code: Internal, Message: err.Error()}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := http.TrailerPrefix
+	if !s.sent {
+		prefix = ""
+	}
+	s.w.Header().Set(prefix+"Grpc-Status", strconv.Itoa(int(st.Code)))
+	if st.Message != "" {
+		s.w.Header().Set(prefix+"Grpc-Message", encodeMessage(st.Message))
+	}
+	if !s.sent {
+		s.w.WriteHeader(http.StatusOK)
+	}
+}
+
+// frame prefixes a message with its uncompressed flag and length.
+func frame(data []byte) []byte {
+	b := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(data)))
+	return append(b, data...)
+}
+
+// readFrame reads one length-prefixed message. A body without message
+// reads as an empty one.
+func readFrame(r io.Reader, encoding string, limit int) ([]byte, error) {
+	var head [5]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, Errorf(InvalidArgument, "read message: %v", err)
+	}
+
+	n := binary.BigEndian.Uint32(head[1:])
+	if limit > 0 && int64(n) > int64(limit) {
+		return nil, Errorf(ResourceExhausted, "message of %d bytes exceeds limit of %d", n, limit)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, Errorf(InvalidArgument, "read message: %v", err)
+	}
+	if head[0] == 0 {
+		return data, nil
+	}
+
+	if encoding != "gzip" {
+		return nil, Errorf(Unimplemented, "unsupported grpc-encoding %q", encoding)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, Errorf(InvalidArgument, "decompress message: %v", err)
+	}
+	lr := io.Reader(zr)
+	if limit > 0 {
+		lr = io.LimitReader(zr, int64(limit)+1)
+	}
+	if data, err = io.ReadAll(lr); err != nil {
+		return nil, Errorf(InvalidArgument, "decompress message: %v", err)
+	}
+	if limit > 0 && len(data) > limit {
+		return nil, Errorf(ResourceExhausted, "message exceeds limit of %d bytes", limit)
+	}
+	return data, nil
+}
+
+// parseTimeout parses a grpc-timeout value such as "100m" or "5S".
+func parseTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, fmt.Errorf("invalid timeout")
+	}
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid timeout")
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+		'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond,
+	}
+	unit, ok := units[s[len(s)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid timeout unit")
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// formatTimeout formats d as a grpc-timeout value.
+func formatTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "1n"
+	}
+	for _, u := range []struct {
+		unit time.Duration
+		name string
+	}{{time.Nanosecond, "n"}, {time.Microsecond, "u"}, {time.Millisecond, "m"}, {time.Second, "S"}} {
+		// Values have at most 8 digits
+		if d/u.unit < 1e8 {
+			return strconv.FormatInt(int64(d/u.unit), 10) + u.name
+		}
+	}
+	return strconv.FormatInt(int64(d/time.Minute)+1, 10) + "M"
+}
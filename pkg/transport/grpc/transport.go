@@ -0,0 +1,288 @@
+// Package grpc serves handlers as gRPC methods without code generation.
+//
+// Methods are declared with `service` and `rpc` tags and messages are
+// encoded with ProtoCodec (fields numbered with `proto` tags) or JSONCodec,
+// chosen by the request's content type. The transport speaks the gRPC
+// protocol over HTTP/2, including cleartext HTTP/2 (h2c), so standard gRPC
+// clients can call it.
+package grpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/logger"
+)
+
+// DefaultMaxMessageSize is the largest request message accepted unless
+// changed with WithMaxMessageSize; it matches the gRPC default.
+const DefaultMaxMessageSize = 4 << 20
+
+// Transport handles gRPC routing.
+type Transport struct {
+	core.Provider
+	binder  *core.Binder
+	Logger  logger.Logger
+	methods map[string]*method // "/package.Service/Method" -> method
+	mu      sync.RWMutex
+	codecs  *codecs
+
+	problems       *core.ProblemMapper
+	mapError       core.ErrorMapper
+	maxMessageSize int
+
+	srvMu sync.Mutex
+	srv   *http.Server
+
+	// PanicReporter receives panics recovered from handlers. When nil,
+	// they are logged with their stack.
+	PanicReporter core.PanicReporter
+}
+
+// method is a registered handler.
+type method struct {
+	name      string
+	prototype reflect.Value
+	plan      *core.Plan
+	stream    bool
+	fields    [][]int // fields a message may set, without a body field
+}
+
+type Option func(*Transport)
+
+// WithBinder sets the binder used for metadata.
+func WithBinder(b *core.Binder) Option {
+	return func(t *Transport) { t.binder = b }
+}
+
+// WithCodec registers a codec, replacing any codec with the same name.
+// ProtoCodec and JSONCodec are registered by default.
+func WithCodec(c Codec) Option {
+	return func(t *Transport) { t.codecs.add(c) }
+}
+
+// WithProblemMapper sets the mapper that classifies handler errors.
+func WithProblemMapper(m *core.ProblemMapper) Option {
+	return func(t *Transport) { t.problems = m }
+}
+
+// WithErrorMapper sets a hook that translates every handler error before
+// it is classified.
+func WithErrorMapper(m core.ErrorMapper) Option {
+	return func(t *Transport) { t.mapError = m }
+}
+
+// WithPanicReporter sets the callback that receives recovered panics.
+func WithPanicReporter(r core.PanicReporter) Option {
+	return func(t *Transport) { t.PanicReporter = r }
+}
+
+// WithMaxMessageSize limits request messages to n bytes.
+func WithMaxMessageSize(n int) Option {
+	return func(t *Transport) { t.maxMessageSize = n }
+}
+
+// WithContainer sets the dependency container, e.g. to share one with
+// other transports.
+func WithContainer(c *core.Container) Option {
+	return func(t *Transport) { t.Provider = core.NewProvider(c) }
+}
+
+// New creates a new gRPC transport.
+func New(opts ...Option) *Transport {
+	t := &Transport{
+		Provider:       core.NewProvider(core.NewContainer()),
+		binder:         core.NewBinder(),
+		Logger:         logger.Nop,
+		methods:        make(map[string]*method),
+		codecs:         newCodecs(),
+		problems:       core.NewProblemMapper(),
+		maxMessageSize: DefaultMaxMessageSize,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.binder.Declare("metadata")
+	return t
+}
+
+// Binder returns the binder used for metadata.
+func (t *Transport) Binder() *core.Binder {
+	return t.binder
+}
+
+// Problems returns the mapper used to classify handler errors.
+func (t *Transport) Problems() *core.ProblemMapper {
+	return t.problems
+}
+
+// Register adds a method.
+// Reads `service:"users.v1.UserService"` and `rpc:"GetUser"` tags from the
+// Pattern field. The request message is decoded into the body:"json" field
+// if there is one, otherwise into the handler itself; `metadata:"key"`
+// fields are bound from request metadata. Handlers implementing
+// core.Streamer are server-streaming methods: each event's Data is a
+// response message.
+func (t *Transport) Register(prototype core.Handler) {
+	val := reflect.ValueOf(prototype)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		panic("Transport.Register: prototype must be a pointer to a struct")
+	}
+
+	elemType := val.Elem().Type()
+
+	var service, rpc string
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if field.Type == reflect.TypeOf(core.Pattern{}) {
+			service = field.Tag.Get("service")
+			rpc = field.Tag.Get("rpc")
+			break
+		}
+	}
+
+	if service == "" || rpc == "" {
+		panic(fmt.Sprintf("Transport.Register: struct %s missing Pattern with service and rpc tags", elemType.Name()))
+	}
+	if err := core.CompileValidation(elemType); err != nil {
+		panic(fmt.Sprintf("Transport.Register: struct %s has invalid validate tags: %v", elemType.Name(), err))
+	}
+
+	_, stream := prototype.(core.Streamer)
+	m := &method{
+		name:      "/" + service + "/" + rpc,
+		prototype: val,
+		plan:      t.binder.Plan(elemType),
+		stream:    stream,
+	}
+	if !m.plan.HasBody() {
+		m.fields = messageFields(elemType, nil)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, dup := t.methods[m.name]; dup {
+		panic(fmt.Sprintf("Transport.Register: method %s registered twice", m.name))
+	}
+	t.methods[m.name] = m
+	t.Logger.Info("Registered method", "method", m.name, "stream", stream)
+}
+
+// Methods returns all registered full method names, such as
+// "/users.v1.UserService/GetUser", sorted.
+func (t *Transport) Methods() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	names := make([]string, 0, len(t.methods))
+	for name := range t.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Listen serves gRPC on addr over cleartext HTTP/2. To serve over TLS, use
+// the transport as the handler of an http.Server with HTTP/2 enabled.
+func (t *Transport) Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return t.Serve(l)
+}
+
+// Serve serves gRPC on l over cleartext HTTP/2. Factory dependencies are
+// built first; if any fails, Serve returns the errors without serving.
+func (t *Transport) Serve(l net.Listener) error {
+	if err := t.Container().Build(); err != nil {
+		return err
+	}
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{Handler: t, Protocols: &protocols}
+
+	t.srvMu.Lock()
+	if t.srv != nil {
+		t.srvMu.Unlock()
+		return fmt.Errorf("grpc transport already listening")
+	}
+	t.srv = srv
+	t.srvMu.Unlock()
+
+	t.Logger.Info("gRPC transport listening", "addr", l.Addr().String())
+	err := srv.Serve(l)
+
+	t.srvMu.Lock()
+	if t.srv == srv {
+		t.srv = nil
+	}
+	t.srvMu.Unlock()
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown gracefully shuts down the server started by Listen or Serve.
+func (t *Transport) Shutdown(ctx context.Context) error {
+	t.srvMu.Lock()
+	srv := t.srv
+	t.srvMu.Unlock()
+	if srv == nil {
+		return nil
+	}
+
+	if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// metadataValues exposes request metadata to a binding plan. Values of
+// keys ending in "-bin" are base64-decoded, as gRPC requires.
+type metadataValues struct {
+	header http.Header
+}
+
+func (v metadataValues) Value(source, key string) string {
+	if vals := v.All(source, key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func (v metadataValues) All(source, key string) []string {
+	if source != "metadata" {
+		return nil
+	}
+	vals := v.header.Values(key)
+	if !strings.HasSuffix(strings.ToLower(key), "-bin") {
+		return vals
+	}
+
+	decoded := make([]string, 0, len(vals))
+	for _, val := range vals {
+		for part := range strings.SplitSeq(val, ",") {
+			part = strings.TrimSpace(part)
+			b, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(part, "="))
+			if err != nil {
+				continue
+			}
+			decoded = append(decoded, string(b))
+		}
+	}
+	return decoded
+}
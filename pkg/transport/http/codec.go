@@ -0,0 +1,185 @@
+package http
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Codec encodes response bodies and decodes request bodies for one media
+// type, such as "application/json".
+type Codec interface {
+	MediaType() string
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+// JSONCodec is the default codec. Request bodies it handles are decoded
+// with position-aware errors (see core.BodyError).
+type JSONCodec struct{}
+
+func (JSONCodec) MediaType() string { return "application/json" }
+
+func (JSONCodec) Encode(w io.Writer, v any) error { return json.NewEncoder(w).Encode(v) }
+
+func (JSONCodec) Decode(r io.Reader, v any) error { return json.NewDecoder(r).Decode(v) }
+
+// XMLCodec encodes and decodes application/xml with encoding/xml.
+type XMLCodec struct{}
+
+func (XMLCodec) MediaType() string { return "application/xml" }
+
+func (XMLCodec) Encode(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func (XMLCodec) Decode(r io.Reader, v any) error { return xml.NewDecoder(r).Decode(v) }
+
+// codecs is the registry shared by a transport and its groups. The first
+// codec is the fallback used when the client expresses no preference.
+type codecs struct {
+	mu   sync.RWMutex
+	list []Codec
+}
+
+func newCodecs() *codecs {
+	return &codecs{list: []Codec{JSONCodec{}}}
+}
+
+// add registers c, replacing a codec with the same media type.
+func (r *codecs) add(c Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.list {
+		if strings.EqualFold(existing.MediaType(), c.MediaType()) {
+			r.list[i] = c
+			return
+		}
+	}
+	r.list = append(r.list, c)
+}
+
+// forContentType returns the codec for a Content-Type header value.
+// An empty header selects the fallback codec.
+func (r *codecs) forContentType(header string) (Codec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if header == "" {
+		return r.list[0], true
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil, false
+	}
+	for _, c := range r.list {
+		if strings.EqualFold(c.MediaType(), mediaType) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// negotiate picks the codec for an Accept header value. Each codec gets
+// the quality of the most specific media range matching it, so q=0 ranges
+// exclude their types; the best quality wins, then the more specific
+// range, then registration order. An empty header selects the fallback,
+// which is also returned, with false, when nothing is acceptable.
+func (r *codecs) negotiate(header string) (Codec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if strings.TrimSpace(header) == "" {
+		return r.list[0], true
+	}
+	ranges := parseAccept(header)
+	var best Codec
+	bestQ, bestSpec := 0.0, -1
+	for _, c := range r.list {
+		q, spec := quality(ranges, c.MediaType())
+		if q > bestQ || (q > 0 && q == bestQ && spec > bestSpec) {
+			best, bestQ, bestSpec = c, q, spec
+		}
+	}
+	if best == nil {
+		return r.list[0], false
+	}
+	return best, true
+}
+
+// quality returns the q value of the most specific range matching
+// mediaType, and that range's specificity; zero and -1 when none does.
+func quality(ranges []mediaRange, mediaType string) (q float64, specificity int) {
+	specificity = -1
+	for _, rng := range ranges {
+		if rng.matches(mediaType) && rng.specificity() > specificity {
+			q, specificity = rng.q, rng.specificity()
+		}
+	}
+	return q, specificity
+}
+
+type mediaRange struct {
+	typ, sub string
+	q        float64
+}
+
+func (m mediaRange) specificity() int {
+	switch {
+	case m.typ == "*":
+		return 0
+	case m.sub == "*":
+		return 1
+	}
+	return 2
+}
+
+func (m mediaRange) matches(mediaType string) bool {
+	typ, sub, _ := strings.Cut(strings.ToLower(mediaType), "/")
+	return (m.typ == "*" || m.typ == typ) && (m.sub == "*" || m.sub == sub)
+}
+
+// parseAccept returns the media ranges of an Accept header, best first.
+// Ranges with q=0 are kept, they mark types as not acceptable; malformed
+// entries are dropped.
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		typ, sub, ok := strings.Cut(mediaType, "/")
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q < 0 || q > 1 {
+			continue
+		}
+		ranges = append(ranges, mediaRange{typ: typ, sub: sub, q: q})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
@@ -0,0 +1,215 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+// textCodec writes values with their JSON encoding as text/plain.
+type textCodec struct{}
+
+func (textCodec) MediaType() string { return "text/plain" }
+
+func (textCodec) Encode(w io.Writer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "text:"+string(b))
+	return err
+}
+
+func (textCodec) Decode(r io.Reader, v any) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(strings.TrimPrefix(string(b), "text:")), v)
+}
+
+// upperJSON replaces JSONCodec for its media type.
+type upperJSON struct{ JSONCodec }
+
+func (upperJSON) Encode(w io.Writer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, strings.ToUpper(string(b)))
+	return err
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   string // media type, empty when nothing is acceptable
+	}{
+		{name: "no header", accept: "", want: "application/json"},
+		{name: "any", accept: "*/*", want: "application/json"},
+		{name: "exact", accept: "application/xml", want: "application/xml"},
+		{name: "quality", accept: "application/json;q=0.5, application/xml", want: "application/xml"},
+		{name: "specificity", accept: "application/*, text/plain", want: "text/plain"},
+		{name: "registration order", accept: "application/*", want: "application/json"},
+		{name: "case insensitive", accept: "Application/XML", want: "application/xml"},
+		{name: "q=0 excludes", accept: "application/json;q=0, */*", want: "application/xml"},
+		{name: "q=0 beats a broader range", accept: "application/*, application/json;q=0", want: "application/xml"},
+		{name: "broader q=0 does not exclude", accept: "*/*;q=0, text/plain", want: "text/plain"},
+		{name: "only exclusions", accept: "application/json;q=0, application/xml;q=0, text/plain;q=0", want: ""},
+		{name: "unsupported", accept: "image/png", want: ""},
+		{name: "malformed entries ignored", accept: "nonsense, text/plain;q=x, application/xml", want: "application/xml"},
+	}
+
+	r := newCodecs()
+	r.add(XMLCodec{})
+	r.add(textCodec{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := r.negotiate(tt.accept)
+			got := ""
+			if ok {
+				got = c.MediaType()
+			}
+			if got != tt.want {
+				t.Fatalf("negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+type echoBody struct {
+	Text string `json:"text" xml:"text"`
+}
+
+type echoEndpoint struct {
+	Meta core.Pattern `method:"POST" path:"/echo"`
+	Body echoBody     `body:"json"`
+	Ran  *bool        `inject:"Ran"`
+}
+
+func (h *echoEndpoint) Handle(ctx context.Context) (any, error) {
+	*h.Ran = true
+	return h.Body, nil
+}
+
+func TestContentNegotiation(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []Option
+		contentType string
+		accept      string
+		body        string
+		wantStatus  int
+		wantType    string
+		wantBody    string
+		wantRan     bool
+	}{
+		{
+			name:       "json by default",
+			body:       `{"text":"hi"}`,
+			wantStatus: http.StatusOK,
+			wantType:   "application/json",
+			wantBody:   `{"text":"hi"}`,
+			wantRan:    true,
+		},
+		{
+			name:        "xml codec",
+			opts:        []Option{WithCodec(XMLCodec{})},
+			contentType: "application/xml; charset=utf-8",
+			accept:      "application/xml",
+			body:        `<x><text>hi</text></x>`,
+			wantStatus:  http.StatusOK,
+			wantType:    "application/xml",
+			wantBody:    `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<echoBody><text>hi</text></echoBody>`,
+			wantRan:     true,
+		},
+		{
+			name:        "registered codec",
+			opts:        []Option{WithCodec(textCodec{})},
+			contentType: "text/plain",
+			accept:      "text/plain",
+			body:        `text:{"text":"hi"}`,
+			wantStatus:  http.StatusOK,
+			wantType:    "text/plain",
+			wantBody:    `text:{"text":"hi"}`,
+			wantRan:     true,
+		},
+		{
+			name:       "codec replaced",
+			opts:       []Option{WithCodec(upperJSON{})},
+			body:       `{"text":"hi"}`,
+			wantStatus: http.StatusOK,
+			wantType:   "application/json",
+			wantBody:   `{"TEXT":"HI"}`,
+			wantRan:    true,
+		},
+		{
+			name:       "not acceptable",
+			accept:     "application/xml",
+			body:       `{"text":"hi"}`,
+			wantStatus: http.StatusNotAcceptable,
+			wantType:   core.ProblemContentType,
+		},
+		{
+			name:       "excluded",
+			accept:     "application/json;q=0, */*",
+			body:       `{"text":"hi"}`,
+			wantStatus: http.StatusNotAcceptable,
+			wantType:   core.ProblemContentType,
+		},
+		{
+			name:        "unsupported media type",
+			contentType: "application/xml",
+			body:        `<x/>`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantType:    core.ProblemContentType,
+		},
+		{
+			name:        "malformed content type",
+			contentType: "application/",
+			body:        `{"text":"hi"}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantType:    core.ProblemContentType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran := false
+			tr := New(tt.opts...)
+			tr.Provide("Ran", &ran)
+			tr.Register(&echoEndpoint{})
+
+			req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			tr.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.wantType) {
+				t.Fatalf("Content-Type %q, want %q", got, tt.wantType)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); tt.wantBody != "" && got != tt.wantBody {
+				t.Fatalf("body %s, want %s", got, tt.wantBody)
+			}
+			if ran != tt.wantRan {
+				t.Fatalf("handler ran %v, want %v", ran, tt.wantRan)
+			}
+		})
+	}
+}
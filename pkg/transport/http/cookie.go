@@ -0,0 +1,37 @@
+package http
+
+import "net/http"
+
+// CookieSetter is implemented by handler results that set response cookies.
+// The cookies are written before the result is encoded.
+type CookieSetter interface {
+	Cookies() []*http.Cookie
+}
+
+// WithCookies wraps a handler result so that the transport sets the given
+// cookies and then encodes v as usual:
+//
+//	return http.WithCookies(user, &stdhttp.Cookie{
+//	    Name:     "session_id",
+//	    Value:    token,
+//	    Expires:  time.Now().Add(24 * time.Hour),
+//	    SameSite: stdhttp.SameSiteLaxMode,
+//	    Secure:   true,
+//	    HttpOnly: true,
+//	}), nil
+func WithCookies(v any, cookies ...*http.Cookie) any {
+	return &cookieResult{value: v, cookies: cookies}
+}
+
+type cookieResult struct {
+	value   any
+	cookies []*http.Cookie
+}
+
+func (r *cookieResult) Cookies() []*http.Cookie {
+	return r.cookies
+}
+
+func (r *cookieResult) Unwrap() any {
+	return r.value
+}
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+type whoAmI struct {
+	Meta    core.Pattern `method:"GET" path:"/me"`
+	Session string       `cookie:"session_id"`
+	Prefs   []string     `cookie:"pref" sep:""`
+	Visits  *int         `cookie:"visits"`
+}
+
+func (h *whoAmI) Handle(ctx context.Context) (any, error) {
+	visits := 0
+	if h.Visits != nil {
+		visits = *h.Visits
+	}
+	return map[string]any{"session": h.Session, "prefs": h.Prefs, "visits": visits}, nil
+}
+
+// sessionResult sets its own cookie.
+type sessionResult struct {
+	User string `json:"user"`
+}
+
+func (sessionResult) Cookies() []*http.Cookie {
+	return []*http.Cookie{{Name: "theme", Value: "dark"}}
+}
+
+type login struct {
+	Meta core.Pattern `method:"POST" path:"/login/{mode}"`
+	Mode string       `path:"mode"`
+}
+
+func (h *login) Handle(ctx context.Context) (any, error) {
+	if h.Mode == "setter" {
+		return sessionResult{User: "ada"}, nil
+	}
+	return WithCookies(map[string]string{"user": "ada"}, &http.Cookie{
+		Name:     "session_id",
+		Value:    "s3cr3t",
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}), nil
+}
+
+func TestCookieBinding(t *testing.T) {
+	tests := []struct {
+		name     string
+		cookies  []*http.Cookie
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "none",
+			wantCode: http.StatusOK,
+			wantBody: `{"prefs":null,"session":"","visits":0}`,
+		},
+		{
+			name: "values",
+			cookies: []*http.Cookie{
+				{Name: "session_id", Value: "abc"},
+				{Name: "pref", Value: "a,b"},
+				{Name: "pref", Value: "c"},
+				{Name: "visits", Value: "3"},
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"prefs":["a,b","c"],"session":"abc","visits":3}`,
+		},
+		{
+			name:     "invalid value",
+			cookies:  []*http.Cookie{{Name: "visits", Value: "many"}},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	tr := New()
+	tr.Register(&whoAmI{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			for _, c := range tt.cookies {
+				req.AddCookie(c)
+			}
+			rec := httptest.NewRecorder()
+			tr.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d (body %s)", rec.Code, tt.wantCode, rec.Body)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); tt.wantBody != "" && got != tt.wantBody {
+				t.Fatalf("body %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestResponseCookies(t *testing.T) {
+	const session = "session_id=s3cr3t; Path=/; HttpOnly; SameSite=Lax"
+
+	tests := []struct {
+		mode        string
+		wantCookies []string
+	}{
+		{mode: "wrapper", wantCookies: []string{session}},
+		{mode: "setter", wantCookies: []string{"theme=dark"}},
+	}
+
+	tr := New()
+	tr.Register(&login{})
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tr.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login/"+tt.mode, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, want 200 (body %s)", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Values("Set-Cookie"); !slices.Equal(got, tt.wantCookies) {
+				t.Fatalf("Set-Cookie %q, want %q", got, tt.wantCookies)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != `{"user":"ada"}` {
+				t.Fatalf("body %s, want the wrapped value", got)
+			}
+		})
+	}
+}
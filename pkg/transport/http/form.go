@@ -0,0 +1,122 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+)
+
+// DefaultMultipartMemory is the part of a multipart body kept in memory;
+// the rest of the uploaded files spill to temporary files.
+const DefaultMultipartMemory = 32 << 20
+
+var (
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader(nil))
+	fileType        = reflect.TypeOf((*multipart.File)(nil)).Elem()
+)
+
+// fileField is a struct field tagged `file:"name"`.
+type fileField struct {
+	index int
+	name  string
+	typ   reflect.Type
+}
+
+// compileFileFields collects the upload fields of a handler type.
+// Supported types are *multipart.FileHeader, []*multipart.FileHeader and
+// multipart.File, which is opened for the handler and closed afterwards.
+func compileFileFields(typ reflect.Type) ([]fileField, error) {
+	var fields []fileField
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := field.Tag.Get("file")
+		if name == "" || !field.IsExported() {
+			continue
+		}
+
+		switch field.Type {
+		case fileHeaderType, fileHeadersType, fileType:
+		default:
+			return nil, fmt.Errorf("field %s: unsupported file type %s", field.Name, field.Type)
+		}
+		fields = append(fields, fileField{index: i, name: name, typ: field.Type})
+	}
+	return fields, nil
+}
+
+// parseForm parses url-encoded and multipart bodies so that form and file
+// fields can be bound. Other content types are left alone.
+func (t *Transport) parseForm(w http.ResponseWriter, req *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" && mediaType != "application/x-www-form-urlencoded" {
+		return nil
+	}
+
+	if t.maxBodySize > 0 && req.Body != nil {
+		req.Body = http.MaxBytesReader(w, req.Body, t.maxBodySize)
+	}
+
+	var err error
+	if mediaType == "multipart/form-data" {
+		err = req.ParseMultipartForm(t.multipartMemory)
+	} else {
+		err = req.ParseForm()
+	}
+	if err == nil {
+		return nil
+	}
+
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return &statusError{
+			code: http.StatusRequestEntityTooLarge,
+			msg:  fmt.Sprintf("request body exceeds %d bytes", maxErr.Limit),
+		}
+	}
+	return &statusError{code: http.StatusBadRequest, msg: fmt.Sprintf("invalid form body: %v", err)}
+}
+
+// bindFiles sets the upload fields of elem from a parsed multipart form.
+// Files opened for multipart.File fields are returned so the caller can
+// close them once the handler is done.
+func bindFiles(req *http.Request, fields []fileField, elem reflect.Value) ([]io.Closer, error) {
+	if req.MultipartForm == nil {
+		return nil, nil
+	}
+
+	var opened []io.Closer
+	for _, f := range fields {
+		headers := req.MultipartForm.File[f.name]
+		if len(headers) == 0 {
+			continue
+		}
+
+		field := elem.Field(f.index)
+		switch f.typ {
+		case fileHeaderType:
+			field.Set(reflect.ValueOf(headers[0]))
+		case fileHeadersType:
+			field.Set(reflect.ValueOf(headers))
+		case fileType:
+			file, err := headers[0].Open()
+			if err != nil {
+				closeAll(opened)
+				return nil, &statusError{code: http.StatusBadRequest, msg: fmt.Sprintf("failed to open upload %s", f.name)}
+			}
+			opened = append(opened, file)
+			field.Set(reflect.ValueOf(file))
+		}
+	}
+	return opened, nil
+}
+
+func closeAll(closers []io.Closer) {
+	for _, c := range closers {
+		c.Close()
+	}
+}
@@ -0,0 +1,195 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+type updateProfile struct {
+	Meta        core.Pattern            `method:"POST" path:"/profile"`
+	Name        string                  `form:"name" validate:"required"`
+	Tags        []string                `form:"tag"`
+	Age         int                     `form:"age"`
+	Avatar      *multipart.FileHeader   `file:"avatar"`
+	Attachments []*multipart.FileHeader `file:"attachment"`
+	Document    multipart.File          `file:"document"`
+}
+
+func (h *updateProfile) Handle(ctx context.Context) (any, error) {
+	res := map[string]any{"name": h.Name, "tags": h.Tags, "age": h.Age}
+	if h.Avatar != nil {
+		res["avatar"] = h.Avatar.Filename
+	}
+	var attachments []string
+	for _, a := range h.Attachments {
+		attachments = append(attachments, a.Filename)
+	}
+	res["attachments"] = attachments
+	if h.Document != nil {
+		b, err := io.ReadAll(h.Document)
+		if err != nil {
+			return nil, err
+		}
+		res["document"] = string(b)
+	}
+	return res, nil
+}
+
+// part is a field or, with a file name, a file of a multipart body.
+type part struct {
+	name, filename, content string
+}
+
+func multipartBody(t *testing.T, parts ...part) (string, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		var w io.Writer
+		var err error
+		if p.filename != "" {
+			w, err = mw.CreateFormFile(p.name, p.filename)
+		} else {
+			w, err = mw.CreateFormField(p.name)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, p.content)
+	}
+	mw.Close()
+	return buf.String(), mw.FormDataContentType()
+}
+
+func TestFormBinding(t *testing.T) {
+	upload, uploadType := multipartBody(t,
+		part{name: "name", content: "ada"},
+		part{name: "tag", content: "a,b"},
+		part{name: "avatar", filename: "me.png", content: "png"},
+		part{name: "attachment", filename: "one.txt", content: "1"},
+		part{name: "attachment", filename: "two.txt", content: "2"},
+		part{name: "document", filename: "cv.txt", content: strings.Repeat("x", 100)},
+	)
+
+	tests := []struct {
+		name        string
+		opts        []Option
+		contentType string
+		body        string
+		wantStatus  int
+		wantBody    string
+	}{
+		{
+			name:        "url-encoded",
+			contentType: "application/x-www-form-urlencoded",
+			body:        url.Values{"name": {"ada"}, "tag": {"a", "b"}, "age": {"36"}}.Encode(),
+			wantStatus:  http.StatusOK,
+			wantBody:    `{"age":36,"attachments":null,"name":"ada","tags":["a","b"]}`,
+		},
+		{
+			name:        "multipart with files",
+			contentType: uploadType,
+			body:        upload,
+			wantStatus:  http.StatusOK,
+			wantBody:    `{"age":0,"attachments":["one.txt","two.txt"],"avatar":"me.png","document":"` + strings.Repeat("x", 100) + `","name":"ada","tags":["a","b"]}`,
+		},
+		{
+			name:        "files spilled to disk",
+			opts:        []Option{WithMultipartMemory(1)},
+			contentType: uploadType,
+			body:        upload,
+			wantStatus:  http.StatusOK,
+			wantBody:    `{"age":0,"attachments":["one.txt","two.txt"],"avatar":"me.png","document":"` + strings.Repeat("x", 100) + `","name":"ada","tags":["a","b"]}`,
+		},
+		{
+			name:        "validated",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "tag=a",
+			wantStatus:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "invalid value",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "name=ada&age=old",
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "other content types are not parsed",
+			contentType: "text/plain",
+			body:        "name=ada",
+			wantStatus:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "malformed multipart",
+			contentType: "multipart/form-data",
+			body:        upload,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "url-encoded body too large",
+			opts:        []Option{WithMaxBodySize(8)},
+			contentType: "application/x-www-form-urlencoded",
+			body:        "name=ada&tag=a",
+			wantStatus:  http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "multipart body too large",
+			opts:        []Option{WithMaxBodySize(64)},
+			contentType: uploadType,
+			body:        upload,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Spilled uploads must be gone once the request is done
+			tmp := t.TempDir()
+			t.Setenv("TMPDIR", tmp)
+
+			tr := New(tt.opts...)
+			tr.Register(&updateProfile{})
+
+			req := httptest.NewRequest(http.MethodPost, "/profile", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			tr.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); tt.wantBody != "" && got != tt.wantBody {
+				t.Fatalf("body %s, want %s", got, tt.wantBody)
+			}
+			if left, _ := os.ReadDir(tmp); len(left) > 0 {
+				t.Fatalf("temporary files left: %v", left)
+			}
+		})
+	}
+}
+
+func TestRegisterFileFieldPanics(t *testing.T) {
+	type badUpload struct {
+		Meta   core.Pattern `method:"POST" path:"/upload"`
+		Avatar []byte       `file:"avatar"`
+		updateProfile
+	}
+
+	defer func() {
+		msg, _ := recover().(string)
+		if !strings.Contains(msg, "field Avatar: unsupported file type []uint8") {
+			t.Fatalf("Register panic %q, want the unsupported file type", msg)
+		}
+	}()
+	New().Register(&badUpload{})
+}
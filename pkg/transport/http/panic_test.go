@@ -0,0 +1,89 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+type panicking struct {
+	Meta core.Pattern `method:"GET" path:"/panic"`
+}
+
+func (h *panicking) Handle(ctx context.Context) (any, error) { panic("disk on fire") }
+
+func TestPanicReporter(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup registers the route and returns the request path.
+		setup    func(tr *Transport, root, own core.PanicReporter) string
+		wantRoot bool
+		wantOwn  bool
+	}{
+		{
+			name: "root",
+			setup: func(tr *Transport, root, own core.PanicReporter) string {
+				tr.PanicReporter = root
+				tr.Register(&panicking{})
+				return "/panic"
+			},
+			wantRoot: true,
+		},
+		{
+			name: "group created before the reporter",
+			setup: func(tr *Transport, root, own core.PanicReporter) string {
+				tr.Group("/v1").Group("/admin").Register(&panicking{})
+				tr.PanicReporter = root
+				return "/v1/admin/panic"
+			},
+			wantRoot: true,
+		},
+		{
+			name: "group with its own reporter",
+			setup: func(tr *Transport, root, own core.PanicReporter) string {
+				tr.PanicReporter = root
+				g := tr.Group("/v1")
+				g.PanicReporter = own
+				g.Register(&panicking{})
+				return "/v1/panic"
+			},
+			wantOwn: true,
+		},
+		{
+			name: "no reporter",
+			setup: func(tr *Transport, root, own core.PanicReporter) string {
+				tr.Group("/v1").Register(&panicking{})
+				return "/v1/panic"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var root, own *core.PanicError
+			tr := New()
+			path := tt.setup(tr,
+				func(ctx context.Context, pe *core.PanicError) { root = pe },
+				func(ctx context.Context, pe *core.PanicError) { own = pe },
+			)
+
+			rec := httptest.NewRecorder()
+			tr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("status %d, want 500", rec.Code)
+			}
+			if (root != nil) != tt.wantRoot || (own != nil) != tt.wantOwn {
+				t.Fatalf("reported to root %v and group %v, want %v and %v", root != nil, own != nil, tt.wantRoot, tt.wantOwn)
+			}
+			for _, pe := range []*core.PanicError{root, own} {
+				if pe != nil && (pe.Value != "disk on fire" || pe.Handler != "http.panicking") {
+					t.Fatalf("reported %v from %s, want the handler's panic", pe.Value, pe.Handler)
+				}
+			}
+		})
+	}
+}
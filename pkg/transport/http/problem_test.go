@@ -0,0 +1,161 @@
+package http
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+var errQuota = errors.New("quota exceeded")
+
+// legacyError keeps the payload older clients expect.
+type legacyError struct{}
+
+func (legacyError) Error() string   { return "legacy" }
+func (legacyError) StatusCode() int { return 409 }
+func (legacyError) Payload() any    { return map[string]string{"code": "LEGACY"} }
+
+type failingEndpoint struct {
+	Meta core.Pattern `method:"POST" path:"/fail/{mode}"`
+	Mode string       `path:"mode"`
+	Body struct {
+		Name string `json:"name" validate:"required"`
+	} `body:"json"`
+}
+
+func (h *failingEndpoint) Handle(ctx context.Context) (any, error) {
+	switch h.Mode {
+	case "problem":
+		return nil, core.NewProblem(403, "no credit").With("balance", 30)
+	case "sentinel":
+		return nil, fmt.Errorf("user 7: %w", core.ErrNotFound)
+	case "mapped":
+		return nil, errQuota
+	case "internal":
+		return nil, errors.New("password is hunter2")
+	case "payload":
+		return nil, fmt.Errorf("save: %w", legacyError{})
+	case "norows":
+		return nil, sql.ErrNoRows
+	}
+	return "ok", nil
+}
+
+func TestErrorResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		wantCode int
+		wantType string
+		wantBody string
+	}{
+		{
+			name:     "problem",
+			path:     "/fail/problem",
+			wantCode: 403,
+			wantType: core.ProblemContentType,
+			wantBody: `{"balance":30,"detail":"no credit","status":403,"title":"Forbidden"}`,
+		},
+		{
+			name:     "sentinel",
+			path:     "/fail/sentinel",
+			wantCode: 404,
+			wantType: core.ProblemContentType,
+			wantBody: `{"detail":"user 7: not found","status":404,"title":"Not Found"}`,
+		},
+		{
+			name:     "mapper rule",
+			path:     "/fail/mapped",
+			wantCode: 429,
+			wantType: core.ProblemContentType,
+			wantBody: `{"detail":"quota exceeded","status":429,"title":"Too Many Requests"}`,
+		},
+		{
+			name:     "internal detail hidden",
+			path:     "/fail/internal",
+			wantCode: 500,
+			wantType: core.ProblemContentType,
+			wantBody: `{"status":500,"title":"Internal Server Error"}`,
+		},
+		{
+			name:     "payload",
+			path:     "/fail/payload",
+			wantCode: 409,
+			wantType: "application/json",
+			wantBody: `{"code":"LEGACY"}`,
+		},
+		{
+			name:     "error mapper",
+			path:     "/fail/norows",
+			wantCode: 404,
+			wantType: core.ProblemContentType,
+			wantBody: `{"detail":"not found: sql: no rows in result set","status":404,"title":"Not Found"}`,
+		},
+		{
+			name:     "error mapper in a group",
+			path:     "/v1/fail/norows",
+			wantCode: 404,
+			wantType: core.ProblemContentType,
+			wantBody: `{"detail":"not found: sql: no rows in result set","status":404,"title":"Not Found"}`,
+		},
+		{
+			name:     "validation",
+			path:     "/fail/none",
+			body:     `{}`,
+			wantCode: 422,
+			wantType: core.ProblemContentType,
+			wantBody: `{"detail":"validation failed","errors":[{"field":"body.name","rule":"required","message":"is required"}],"status":422,"title":"Unprocessable Entity"}`,
+		},
+		{
+			name:     "invalid body",
+			path:     "/fail/none",
+			body:     `{"name":`,
+			wantCode: 400,
+			wantType: core.ProblemContentType,
+		},
+	}
+
+	tr := New()
+	// The mapper is set after the group exists, which reads it from tr.
+	group := tr.Group("/v1")
+	WithErrorMapper(func(err error) error {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %w", core.ErrNotFound, err)
+		}
+		return err
+	})(tr)
+	tr.Problems().Map(errQuota, http.StatusTooManyRequests)
+	tr.Register(&failingEndpoint{})
+	group.Register(&failingEndpoint{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := tt.body
+			if body == "" {
+				body = `{"name":"ada"}`
+			}
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			tr.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d (body %s)", rec.Code, tt.wantCode, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.wantType) {
+				t.Fatalf("Content-Type %q, want %q", got, tt.wantType)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); tt.wantBody != "" && got != tt.wantBody {
+				t.Fatalf("body %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+// writeResponse writes a handler result. Each layer of the result may set
+// cookies (CookieSetter), headers (core.HeaderProvider), the status code
+// (core.StatusCoder) and the content type (core.ContentTyper); the outermost
+// layer wins. The innermost value is the body: []byte, string and io.Reader
+// bodies are written as-is, anything else is encoded with the codec for the
+// chosen content type, or with the negotiated codec.
+func (t *Transport) writeResponse(w http.ResponseWriter, codec Codec, resp any) {
+	status, contentType := 0, ""
+
+	for {
+		if cs, ok := resp.(CookieSetter); ok {
+			for _, c := range cs.Cookies() {
+				http.SetCookie(w, c)
+			}
+		}
+		if hp, ok := resp.(core.HeaderProvider); ok {
+			for key, values := range hp.Headers() {
+				for _, v := range values {
+					w.Header().Add(key, v)
+				}
+			}
+		}
+		if sc, ok := resp.(core.StatusCoder); ok && status == 0 {
+			status = sc.StatusCode()
+		}
+		if ct, ok := resp.(core.ContentTyper); ok && contentType == "" {
+			contentType = ct.ContentType()
+		}
+
+		env, ok := resp.(core.Envelope)
+		if !ok {
+			break
+		}
+		resp = env.Unwrap()
+	}
+
+	if resp == nil {
+		if status == 0 {
+			status = http.StatusNoContent
+		}
+		w.WriteHeader(status)
+		return
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	switch body := resp.(type) {
+	case []byte:
+		writeHead(w, status, contentType, "application/octet-stream")
+		w.Write(body)
+	case string:
+		writeHead(w, status, contentType, "text/plain; charset=utf-8")
+		io.WriteString(w, body)
+	case io.Reader:
+		writeHead(w, status, contentType, "application/octet-stream")
+		io.Copy(w, body)
+		if c, ok := body.(io.Closer); ok {
+			c.Close()
+		}
+	default:
+		if contentType != "" {
+			if c, ok := t.codecs.forContentType(contentType); ok {
+				codec = c
+			}
+		}
+		if err := t.encode(w, codec, status, contentType, body); err != nil {
+			t.Logger.Error("Failed to encode response", "error", err)
+			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
+
+// encode writes v with codec. The body is buffered so that an encoding
+// failure can still be reported with a proper status; in that case nothing
+// is written and the error is returned.
+func (t *Transport) encode(w http.ResponseWriter, codec Codec, status int, contentType string, v any) error {
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, v); err != nil {
+		return err
+	}
+	writeHead(w, status, contentType, codec.MediaType())
+	buf.WriteTo(w)
+	return nil
+}
+
+func writeHead(w http.ResponseWriter, status int, contentType, fallback string) {
+	if contentType == "" {
+		contentType = fallback
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+}
@@ -0,0 +1,121 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+// redirect implements the result interfaces itself.
+type redirect struct{ to string }
+
+func (r redirect) StatusCode() int              { return http.StatusSeeOther }
+func (r redirect) Headers() map[string][]string { return map[string][]string{"Location": {r.to}} }
+
+type respond struct {
+	Meta core.Pattern `method:"GET" path:"/respond/{mode}"`
+	Mode string       `path:"mode"`
+}
+
+func (h *respond) Handle(ctx context.Context) (any, error) {
+	user := map[string]string{"id": "7"}
+	switch h.Mode {
+	case "nil":
+		return nil, nil
+	case "created":
+		return core.Created("/users/7", user).WithHeader("ETag", `"v1"`), nil
+	case "accepted":
+		return core.Accepted(nil), nil
+	case "csv":
+		return core.NewResponse(http.StatusOK, "id\n7\n").WithType("text/csv"), nil
+	case "bytes":
+		return []byte{1, 2}, nil
+	case "reader":
+		return strings.NewReader("streamed"), nil
+	case "custom":
+		return redirect{to: "/login"}, nil
+	case "nested":
+		// The outer status wins, headers of every layer are set
+		inner := core.NewResponse(http.StatusAccepted, user).WithHeader("X-Inner", "1")
+		return core.NewResponse(http.StatusCreated, inner).WithHeader("X-Outer", "1"), nil
+	case "cookies":
+		// Cookies of every layer are set
+		return WithCookies(core.Created("/users/7", sessionResult{User: "ada"}), &http.Cookie{Name: "session_id", Value: "s3cr3t"}), nil
+	}
+	return user, nil
+}
+
+func TestWriteResponse(t *testing.T) {
+	tests := []struct {
+		mode        string
+		wantStatus  int
+		wantType    string
+		wantHeaders map[string][]string
+		wantBody    string
+	}{
+		{mode: "plain", wantStatus: http.StatusOK, wantType: "application/json", wantBody: `{"id":"7"}`},
+		{mode: "nil", wantStatus: http.StatusNoContent},
+		{
+			mode:        "created",
+			wantStatus:  http.StatusCreated,
+			wantType:    "application/json",
+			wantHeaders: map[string][]string{"Location": {"/users/7"}, "Etag": {`"v1"`}},
+			wantBody:    `{"id":"7"}`,
+		},
+		{mode: "accepted", wantStatus: http.StatusAccepted},
+		{mode: "csv", wantStatus: http.StatusOK, wantType: "text/csv", wantBody: "id\n7"},
+		{mode: "bytes", wantStatus: http.StatusOK, wantType: "application/octet-stream", wantBody: "\x01\x02"},
+		{mode: "reader", wantStatus: http.StatusOK, wantType: "application/octet-stream", wantBody: "streamed"},
+		{
+			mode:        "custom",
+			wantStatus:  http.StatusSeeOther,
+			wantType:    "application/json",
+			wantHeaders: map[string][]string{"Location": {"/login"}},
+			wantBody:    `{}`,
+		},
+		{
+			mode:        "nested",
+			wantStatus:  http.StatusCreated,
+			wantType:    "application/json",
+			wantHeaders: map[string][]string{"X-Inner": {"1"}, "X-Outer": {"1"}},
+			wantBody:    `{"id":"7"}`,
+		},
+		{
+			mode:        "cookies",
+			wantStatus:  http.StatusCreated,
+			wantType:    "application/json",
+			wantHeaders: map[string][]string{"Location": {"/users/7"}, "Set-Cookie": {"session_id=s3cr3t", "theme=dark"}},
+			wantBody:    `{"user":"ada"}`,
+		},
+	}
+
+	tr := New()
+	tr.Register(&respond{})
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/respond/"+tt.mode, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.wantType) || (tt.wantType == "" && got != "") {
+				t.Fatalf("Content-Type %q, want %q", got, tt.wantType)
+			}
+			for key, want := range tt.wantHeaders {
+				if got := rec.Header().Values(key); !slices.Equal(got, want) {
+					t.Fatalf("%s %q, want %q", key, got, want)
+				}
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.wantBody {
+				t.Fatalf("body %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
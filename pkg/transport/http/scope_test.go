@@ -0,0 +1,120 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+// tx records how the scope it was built in ended.
+type tx struct {
+	committed, rolledBack bool
+	err                   error
+}
+
+type streamEndpoint struct {
+	Meta core.Pattern `method:"GET" path:"/stream/{mode}"`
+	Mode string       `path:"mode"`
+	Tx   *tx          `inject:"Tx"`
+}
+
+func (h *streamEndpoint) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+func (h *streamEndpoint) Stream(ctx context.Context, emit core.Emit) error {
+	if err := emit(core.Event{Data: "first"}); err != nil {
+		return err
+	}
+	switch h.Mode {
+	case "panic":
+		panic("stream broke")
+	case "error":
+		return errors.New("stream failed")
+	}
+	return nil
+}
+
+type unaryEndpoint struct {
+	Meta core.Pattern `method:"GET" path:"/unary/{mode}"`
+	Mode string       `path:"mode"`
+	Tx   *tx          `inject:"Tx"`
+}
+
+func (h *unaryEndpoint) Handle(ctx context.Context) (any, error) {
+	switch h.Mode {
+	case "panic":
+		panic("handler broke")
+	case "error":
+		return nil, errors.New("handler failed")
+	}
+	return "ok", nil
+}
+
+func TestScopeCleanupSeesHandlerOutcome(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		wantCommit   bool
+		wantPanicErr bool
+	}{
+		{name: "stream ok", path: "/stream/ok", wantCommit: true},
+		{name: "stream error", path: "/stream/error"},
+		{name: "stream panic", path: "/stream/panic", wantPanicErr: true},
+		{name: "unary ok", path: "/unary/ok", wantCommit: true},
+		{name: "unary error", path: "/unary/error"},
+		{name: "unary panic", path: "/unary/panic", wantPanicErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var last *tx
+			tr := New(WithPanicReporter(func(context.Context, *core.PanicError) {}))
+			tr.ProvideScoped("Tx", func(c *core.Container) *tx {
+				last = &tx{}
+				c.OnClose(func(err error) error {
+					last.err = err
+					if err != nil {
+						last.rolledBack = true
+					} else {
+						last.committed = true
+					}
+					return nil
+				})
+				return last
+			})
+			tr.Register(&streamEndpoint{})
+			tr.Register(&unaryEndpoint{})
+
+			rec := httptest.NewRecorder()
+			tr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if last == nil {
+				t.Fatal("scoped dependency was not built")
+			}
+			if last.committed != tt.wantCommit || last.rolledBack == tt.wantCommit {
+				t.Fatalf("committed=%v rolledBack=%v, want committed=%v", last.committed, last.rolledBack, tt.wantCommit)
+			}
+			var pe *core.PanicError
+			if got := errors.As(last.err, &pe); got != tt.wantPanicErr {
+				t.Fatalf("cleanup error %v, want a *core.PanicError: %v", last.err, tt.wantPanicErr)
+			}
+		})
+	}
+}
+
+func TestScopedFactoryFailureFailsRequest(t *testing.T) {
+	tr := New()
+	tr.ProvideScoped("Tx", func(c *core.Container) (*tx, error) {
+		return nil, errors.New("db down")
+	})
+	tr.Register(&unaryEndpoint{})
+
+	rec := httptest.NewRecorder()
+	tr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/unary/ok", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", rec.Code)
+	}
+}
@@ -0,0 +1,252 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+// DefaultHeartbeat is how often an idle event stream sends a comment to
+// keep proxies from closing the connection.
+const DefaultHeartbeat = 15 * time.Second
+
+// WithHeartbeat sets the heartbeat interval of event streams. Zero
+// disables heartbeats.
+func WithHeartbeat(d time.Duration) Option {
+	return func(t *Transport) { t.heartbeat = d }
+}
+
+// acceptsEventStream reports whether an Accept header lists
+// text/event-stream explicitly, with a non-zero quality.
+func acceptsEventStream(header string) bool {
+	for _, rng := range parseAccept(header) {
+		if rng.typ == "text" && rng.sub == "event-stream" && rng.q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// serveStream runs a stream as server-sent events. The response starts
+// with the first event or heartbeat, so a stream failing before that gets
+// a regular error response; later failures are sent as an "error" event
+// carrying the problem. The stream's context is cancelled when the client
+// disconnects or a write fails.
+func (t *Transport) serveStream(ctx context.Context, w http.ResponseWriter, run func(context.Context, core.Emit) error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sw := &eventWriter{w: w, rc: http.NewResponseController(w)}
+	emit := func(ev core.Event) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := sw.send(ev); err != nil {
+			cancel()
+			return err
+		}
+		return nil
+	}
+
+	// Heartbeats must stop before the handler returns: the response
+	// writer cannot be used afterwards.
+	var wg sync.WaitGroup
+	if t.heartbeat > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(t.heartbeat)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := sw.comment("heartbeat"); err != nil {
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	err := run(ctx, emit)
+	cancel()
+	wg.Wait()
+
+	// Nobody is listening once the client is gone
+	if err == nil || parent.Err() != nil || sw.isBroken() {
+		return
+	}
+	t.handlerFailed(ctx, err)
+	if !sw.isStarted() {
+		t.writeError(w, err)
+		return
+	}
+
+	if mapError := t.errorMapper(); mapError != nil {
+		err = mapError(err)
+	}
+	sw.send(core.Event{Name: "error", Data: t.problems.Problem(err)})
+}
+
+// streamChannel emits every value received from ch until it is closed.
+// core.Event values are sent as they are; an error value ends the stream
+// with that error. When the stream ends first, e.g. because the client is
+// gone, the rest of ch is drained in the background, so a producer that
+// does not watch its context is not blocked forever on its next send; it
+// should still stop and close ch.
+func streamChannel(ctx context.Context, ch reflect.Value, emit core.Emit) (err error) {
+	closed := false
+	defer func() {
+		if !closed {
+			go drain(ch)
+		}
+	}()
+
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		{Dir: reflect.SelectRecv, Chan: ch},
+	}
+	for {
+		chosen, v, ok := reflect.Select(cases)
+		if chosen == 0 {
+			return nil
+		}
+		if !ok {
+			closed = true
+			return nil
+		}
+
+		var ev core.Event
+		switch val := v.Interface().(type) {
+		case core.Event:
+			ev = val
+		case *core.Event:
+			ev = *val
+		case error:
+			return val
+		default:
+			ev = core.Event{Data: val}
+		}
+		if err := emit(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// drain discards the values of ch until it is closed.
+func drain(ch reflect.Value) {
+	for {
+		if _, ok := ch.Recv(); !ok {
+			return
+		}
+	}
+}
+
+var errStreamClosed = errors.New("event stream closed")
+
+// eventWriter writes the text/event-stream format. It is safe for
+// concurrent use by the stream and the heartbeat.
+type eventWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	mu      sync.Mutex
+	started bool
+	broken  bool
+}
+
+func (s *eventWriter) isStarted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+func (s *eventWriter) isBroken() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.broken
+}
+
+func (s *eventWriter) send(ev core.Event) error {
+	data, err := eventData(ev.Data)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	if ev.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", singleLine(ev.ID))
+	}
+	if ev.Name != "" {
+		fmt.Fprintf(&b, "event: %s\n", singleLine(ev.Name))
+	}
+	if ev.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", ev.Retry.Milliseconds())
+	}
+	// Any line ending splits data lines, as clients parse them
+	data = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(data)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+func (s *eventWriter) comment(text string) error {
+	return s.write(": " + text + "\n\n")
+}
+
+func (s *eventWriter) write(chunk string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started {
+		h := s.w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("X-Accel-Buffering", "no")
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+	if s.broken {
+		return errStreamClosed
+	}
+	if _, err := s.w.Write([]byte(chunk)); err != nil {
+		s.broken = true
+		return err
+	}
+	// Without flushing support events are delivered when the handler ends
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		s.broken = true
+		return err
+	}
+	return nil
+}
+
+func eventData(v any) (string, error) {
+	switch data := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return data, nil
+	case []byte:
+		return string(data), nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
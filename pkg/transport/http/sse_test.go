@@ -0,0 +1,218 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+type countdown struct {
+	Meta   core.Pattern `method:"GET" path:"/countdown"`
+	LastID int          `header:"Last-Event-ID"`
+}
+
+func (h *countdown) Handle(ctx context.Context) (any, error) { return "use an event stream", nil }
+
+func (h *countdown) Stream(ctx context.Context, emit core.Emit) error {
+	for i := h.LastID + 1; i <= 3; i++ {
+		if err := emit(core.Event{ID: strconv.Itoa(i), Name: "tick", Data: map[string]int{"n": i}}); err != nil {
+			return err
+		}
+	}
+	return emit(core.Event{Data: "line 1\r\nline 2\rline 3\nline 4", Retry: 2 * time.Second})
+}
+
+type feed struct {
+	Meta core.Pattern `method:"GET" path:"/feed/{mode}"`
+	Mode string       `path:"mode"`
+}
+
+func (h *feed) Handle(ctx context.Context) (any, error) {
+	ch := make(chan any, 4)
+	switch h.Mode {
+	case "events":
+		ch <- "plain"
+		ch <- core.Event{Name: "named", Data: []byte("raw")}
+		ch <- &core.Event{ID: "7", Data: 42}
+	case "fail":
+		ch <- "first"
+		ch <- core.NewProblem(http.StatusConflict, "feed broken")
+	case "fail-first":
+		ch <- core.NewProblem(http.StatusConflict, "feed broken")
+	}
+	close(ch)
+	return (<-chan any)(ch), nil
+}
+
+func TestEventStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		lastID     string
+		wantStatus int
+		wantType   string
+		wantBody   string
+	}{
+		{
+			name:       "streamer",
+			path:       "/countdown",
+			wantStatus: http.StatusOK,
+			wantType:   "text/event-stream",
+			wantBody: "id: 1\nevent: tick\ndata: {\"n\":1}\n\n" +
+				"id: 2\nevent: tick\ndata: {\"n\":2}\n\n" +
+				"id: 3\nevent: tick\ndata: {\"n\":3}\n\n" +
+				"retry: 2000\ndata: line 1\ndata: line 2\ndata: line 3\ndata: line 4\n\n",
+		},
+		{
+			name:       "resumed with Last-Event-ID",
+			path:       "/countdown",
+			lastID:     "2",
+			wantStatus: http.StatusOK,
+			wantType:   "text/event-stream",
+			wantBody: "id: 3\nevent: tick\ndata: {\"n\":3}\n\n" +
+				"retry: 2000\ndata: line 1\ndata: line 2\ndata: line 3\ndata: line 4\n\n",
+		},
+		{
+			name:       "channel",
+			path:       "/feed/events",
+			wantStatus: http.StatusOK,
+			wantType:   "text/event-stream",
+			wantBody:   "data: plain\n\nevent: named\ndata: raw\n\nid: 7\ndata: 42\n\n",
+		},
+		{
+			name:       "channel error after the first event",
+			path:       "/feed/fail",
+			wantStatus: http.StatusOK,
+			wantType:   "text/event-stream",
+			wantBody:   "data: first\n\nevent: error\ndata: {\"detail\":\"feed broken\",\"status\":409,\"title\":\"Conflict\"}\n\n",
+		},
+		{
+			name:       "channel error before any event",
+			path:       "/feed/fail-first",
+			wantStatus: http.StatusConflict,
+			wantType:   core.ProblemContentType,
+		},
+	}
+
+	tr := New(WithHeartbeat(0))
+	tr.Register(&countdown{})
+	tr.Register(&feed{})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept", "text/event-stream")
+			if tt.lastID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastID)
+			}
+			rec := httptest.NewRecorder()
+			tr.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.wantType) {
+				t.Fatalf("Content-Type %q, want %q", got, tt.wantType)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Fatalf("body:\n%q\nwant:\n%q", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+type idle struct {
+	Meta core.Pattern `method:"GET" path:"/idle"`
+}
+
+func (h *idle) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+func (h *idle) Stream(ctx context.Context, emit core.Emit) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestEventStreamHeartbeat(t *testing.T) {
+	tr := New(WithHeartbeat(5 * time.Millisecond))
+	tr.Register(&idle{})
+	srv := httptest.NewServer(tr)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/idle", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type %q, want text/event-stream", got)
+	}
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != ": heartbeat\n" {
+		t.Fatalf("first line %q, %v, want a heartbeat comment", line, err)
+	}
+}
+
+// brokenWriter fails every write after the first, like a client that
+// disconnected.
+type brokenWriter struct {
+	*httptest.ResponseRecorder
+	writes int
+}
+
+func (w *brokenWriter) Write(b []byte) (int, error) {
+	if w.writes++; w.writes > 1 {
+		return 0, errors.New("connection reset")
+	}
+	return w.ResponseRecorder.Write(b)
+}
+
+type chatty struct {
+	Meta core.Pattern `method:"GET" path:"/chatty"`
+	Done chan struct{}
+}
+
+// Handle returns a channel whose producer does not watch ctx.
+func (h *chatty) Handle(ctx context.Context) (any, error) {
+	ch := make(chan string)
+	go func() {
+		defer close(h.Done)
+		defer close(ch)
+		for i := 0; i < 5; i++ {
+			ch <- strconv.Itoa(i)
+		}
+	}()
+	return ch, nil
+}
+
+func TestEventStreamDrainsChannel(t *testing.T) {
+	done := make(chan struct{})
+	tr := New(WithHeartbeat(0))
+	tr.Register(&chatty{Done: done})
+
+	req := httptest.NewRequest(http.MethodGet, "/chatty", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	w := &brokenWriter{ResponseRecorder: httptest.NewRecorder()}
+	tr.ServeHTTP(w, req)
+
+	if got := w.Body.String(); got != "data: 0\n\n" {
+		t.Fatalf("body %q, want the first event only", got)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("producer still blocked after the client left")
+	}
+}
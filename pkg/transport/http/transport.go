@@ -1,15 +1,16 @@
 package http
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"reflect"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
 	"github.com/mirkobrombin/go-module-router/v2/pkg/logger"
@@ -17,13 +18,29 @@ import (
 
 // Transport handles HTTP-based routing.
 type Transport struct {
-	mux        *http.ServeMux
-	container  *core.Container
+	mux *http.ServeMux
+	core.Provider
+	binder     *core.Binder
 	Logger     logger.Logger
 	middleware []func(http.Handler) http.Handler
 	prefix     string
 	handlers   []core.Handler
 	lifecycle  *lifecycleState
+	codecs     *codecs
+	problems   *core.ProblemMapper
+	mapError   core.ErrorMapper
+	parent     *Transport // the transport a group was created from
+
+	maxBodySize     int64
+	multipartMemory int64
+	strictJSON      bool
+	heartbeat       time.Duration
+	origins         []string
+
+	// PanicReporter receives panics recovered from handlers. When nil,
+	// groups use the reporter of their parent, and the others log panics
+	// with their stack.
+	PanicReporter core.PanicReporter
 }
 
 type lifecycleState struct {
@@ -31,19 +48,104 @@ type lifecycleState struct {
 	srv *http.Server
 }
 
+// Option configures a Transport.
+type Option func(*Transport)
+
+// WithBinder sets the binder used for request binding, so converters can be
+// shared with other transports. The transport declares its sources on it.
+func WithBinder(b *core.Binder) Option {
+	return func(t *Transport) { t.binder = b }
+}
+
+// WithMaxBodySize limits request bodies to n bytes; larger bodies are
+// rejected with 413 Request Entity Too Large.
+func WithMaxBodySize(n int64) Option {
+	return func(t *Transport) { t.maxBodySize = n }
+}
+
+// WithMultipartMemory sets how much of a multipart body is kept in memory.
+// Uploaded files beyond it are stored in temporary files (os.TempDir) that
+// are removed once the request is done. It defaults to DefaultMultipartMemory.
+func WithMultipartMemory(n int64) Option {
+	return func(t *Transport) { t.multipartMemory = n }
+}
+
+// WithDisallowUnknownFields rejects JSON bodies with fields the body struct
+// does not declare, or with data after the JSON value.
+func WithDisallowUnknownFields() Option {
+	return func(t *Transport) { t.strictJSON = true }
+}
+
+// WithCodec registers a codec for request and response bodies.
+// See RegisterCodec.
+func WithCodec(c Codec) Option {
+	return func(t *Transport) { t.codecs.add(c) }
+}
+
+// WithProblemMapper sets the mapper that turns handler errors into
+// problem responses, e.g. to share one with other transports.
+func WithProblemMapper(m *core.ProblemMapper) Option {
+	return func(t *Transport) { t.problems = m }
+}
+
+// WithErrorMapper sets a hook that translates every error before it is
+// turned into a response.
+func WithErrorMapper(m core.ErrorMapper) Option {
+	return func(t *Transport) { t.mapError = m }
+}
+
+// WithPanicReporter sets the callback that receives recovered panics.
+func WithPanicReporter(r core.PanicReporter) Option {
+	return func(t *Transport) { t.PanicReporter = r }
+}
+
+// WithContainer sets the dependency container, e.g. to share one with
+// other transports.
+func WithContainer(c *core.Container) Option {
+	return func(t *Transport) { t.Provider = core.NewProvider(c) }
+}
+
 // New creates a new HTTP transport.
-func New() *Transport {
-	return &Transport{
+func New(opts ...Option) *Transport {
+	t := &Transport{
 		mux:       http.NewServeMux(),
-		container: core.NewContainer(),
+		Provider:  core.NewProvider(core.NewContainer()),
+		binder:    core.NewBinder(),
 		Logger:    logger.Nop,
 		lifecycle: &lifecycleState{},
+		codecs:    newCodecs(),
+		problems:  core.NewProblemMapper(),
+
+		multipartMemory: DefaultMultipartMemory,
+		heartbeat:       DefaultHeartbeat,
+	}
+	for _, opt := range opts {
+		opt(t)
 	}
+	t.binder.Declare("path", "query", "header", "cookie", "form")
+	return t
+}
+
+// RegisterCodec adds a codec for its media type, replacing any codec
+// already registered for it. Responses are encoded with the codec that
+// best matches the request's Accept header and bodies are decoded with the
+// codec for their Content-Type. JSONCodec is registered by default and is
+// used when the client states no preference.
+func (t *Transport) RegisterCodec(c Codec) {
+	t.codecs.add(c)
 }
 
-// Provide registers a dependency.
-func (t *Transport) Provide(name string, instance any) {
-	t.container.Provide(name, instance)
+// Problems returns the error mapper shared by the transport and its groups.
+// Register domain errors on it:
+//
+//	t.Problems().Map(ErrQuotaExceeded, http.StatusTooManyRequests)
+func (t *Transport) Problems() *core.ProblemMapper {
+	return t.problems
+}
+
+// Binder returns the binder shared by the transport and its groups.
+func (t *Transport) Binder() *core.Binder {
+	return t.binder
 }
 
 // Use adds middleware.
@@ -55,16 +157,48 @@ func (t *Transport) Use(mw func(http.Handler) http.Handler) {
 func (t *Transport) Group(prefix string) *Transport {
 	return &Transport{
 		mux:        t.mux,
-		container:  t.container,
+		Provider:   t.Provider,
+		binder:     t.binder,
 		Logger:     t.Logger,
 		middleware: append([]func(http.Handler) http.Handler(nil), t.middleware...),
 		prefix:     t.prefix + prefix,
 		lifecycle:  t.lifecycle,
+		codecs:     t.codecs,
+		problems:   t.problems,
+		parent:     t,
+
+		maxBodySize:     t.maxBodySize,
+		multipartMemory: t.multipartMemory,
+		strictJSON:      t.strictJSON,
+		heartbeat:       t.heartbeat,
+		origins:         t.origins,
+	}
+}
+
+// panicReporter returns the PanicReporter of t or, when unset, of the
+// closest parent that has one. It is read per panic, so reporters set
+// after a group was created apply to it too.
+func (t *Transport) panicReporter() core.PanicReporter {
+	for g := t; g != nil; g = g.parent {
+		if g.PanicReporter != nil {
+			return g.PanicReporter
+		}
+	}
+	return nil
+}
+
+// errorMapper returns the error mapper of the transport groups were
+// created from.
+func (t *Transport) errorMapper() core.ErrorMapper {
+	for t.parent != nil {
+		t = t.parent
 	}
+	return t.mapError
 }
 
 // Register adds an HTTP endpoint.
 // Reads `method:"GET"` and `path:"/users/{id}"` tags from Pattern field.
+// Endpoints with `method:"WS"` accept WebSocket connections.
 func (t *Transport) Register(prototype core.Handler) {
 	t.handlers = append(t.handlers, prototype)
 	val := reflect.ValueOf(prototype)
@@ -93,79 +227,129 @@ func (t *Transport) Register(prototype core.Handler) {
 
 	t.Logger.Info("Registering route", "route", pattern, "handler", elemType.Name())
 
+	// Compile the binding plan once, not per request
+	plan := t.binder.Plan(elemType)
+	if err := core.CompileValidation(elemType); err != nil {
+		panic(fmt.Sprintf("Transport.Register: struct %s has invalid validate tags: %v", elemType.Name(), err))
+	}
+	if method == "WS" {
+		t.registerWebSocket(val, plan, fullPath)
+		return
+	}
+	files, err := compileFileFields(elemType)
+	if err != nil {
+		panic(fmt.Sprintf("Transport.Register: struct %s: %v", elemType.Name(), err))
+	}
+	usesForm := plan.Uses("form") || len(files) > 0
+
 	var finalHandler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Pick the response codec before doing any work
+		// (event streams are always acceptable, their errors are problems)
+		codec, ok := t.codecs.negotiate(req.Header.Get("Accept"))
+		if !ok && !acceptsEventStream(req.Header.Get("Accept")) {
+			t.writeError(w, &statusError{
+				code: http.StatusNotAcceptable,
+				msg:  "none of the accepted media types is supported",
+			})
+			return
+		}
+
 		// Create new instance
 		newVal := reflect.New(elemType).Elem()
 		newVal.Set(val.Elem())
 
 		instance := newVal.Addr().Interface()
 
-		// Inject dependencies
-		t.container.Inject(instance)
-
-		// Bind request data
-		binder := core.NewBinder()
-		binder.AddSource("path", func(key string) string { return req.PathValue(key) })
-		binder.AddSource("query", func(key string) string { return req.URL.Query().Get(key) })
-		binder.AddSource("header", func(key string) string { return req.Header.Get(key) })
+		// Inject HTTP context
+		ctx := req.Context()
+		ctx = context.WithValue(ctx, "http_request", req)
+		ctx = context.WithValue(ctx, "http_response_writer", w)
 
-		if err := binder.Bind(instance); err != nil {
-			http.Error(w, fmt.Sprintf("Bad Request: %v", err), http.StatusBadRequest)
+		// Inject dependencies, scoped ones live for this request
+		scope := t.Container().NewScope(ctx)
+		defer scope.Close(core.ErrScopeAborted)
+		if err := scope.Inject(instance); err != nil {
+			t.handlerFailed(ctx, err)
+			t.writeError(w, err)
 			return
 		}
 
-		// Bind JSON body if present
-		contentType := req.Header.Get("Content-Type")
-		if req.Body != nil && strings.HasPrefix(contentType, "application/json") {
-			body, _ := io.ReadAll(req.Body)
-			if len(body) > 0 {
-				binder.BindJSON(instance, body)
+		// Parse form bodies for form and file fields
+		if usesForm {
+			if err := t.parseForm(w, req); err != nil {
+				t.writeError(w, err)
+				return
 			}
+			if req.MultipartForm != nil {
+				defer req.MultipartForm.RemoveAll()
+			}
+
+			opened, err := bindFiles(req, files, newVal)
+			if err != nil {
+				t.writeError(w, err)
+				return
+			}
+			defer closeAll(opened)
 		}
 
-		// Execute
-		handler := instance.(core.Handler)
+		// Bind request data
+		if err := plan.Bind(newVal, &requestValues{req: req}); err != nil {
+			t.writeError(w, &statusError{code: http.StatusBadRequest, msg: err.Error()})
+			return
+		}
 
-		// Inject HTTP context
-		ctx := req.Context()
-		ctx = context.WithValue(ctx, "http_request", req)
-		ctx = context.WithValue(ctx, "http_response_writer", w)
+		// Decode the request body if present
+		if plan.HasBody() {
+			if err := t.bindBody(w, req, plan, newVal); err != nil {
+				t.writeError(w, err)
+				return
+			}
+		}
 
-		resp, err := handler.Handle(ctx)
-		if err != nil {
-			t.Logger.Error("Handler failed", "error", err)
+		// Validate bound fields and body
+		if err := core.Validate(instance); err != nil {
+			t.writeError(w, err)
+			return
+		}
 
-			code := http.StatusInternalServerError
-			var resp any = map[string]string{"error": err.Error()}
+		// Execute
+		handler := instance.(core.Handler)
 
-			// Check for optional interfaces
-			type StatusCoder interface {
-				StatusCode() int
-			}
-			type Payloader interface {
-				Payload() any
-			}
+		// Streaming handlers are served as server-sent events
+		if streamer, ok := instance.(core.Streamer); ok {
+			t.serveStream(ctx, w, func(ctx context.Context, emit core.Emit) (err error) {
+				// Deferred first so it sees the error of a recovered panic
+				defer core.CloseScope(scope, &err, t.Logger)
+				defer core.RecoverPanic(pattern, instance, &err)
+				return streamer.Stream(ctx, emit)
+			})
+			return
+		}
 
-			if sc, ok := err.(StatusCoder); ok {
-				code = sc.StatusCode()
-			}
-			if pl, ok := err.(Payloader); ok {
-				resp = pl.Payload()
-			}
+		// Panics become 500 responses, except deliberate aborts.
+		// Scoped dependencies are cleaned up before the response is
+		// written, so that e.g. a failed commit is reported.
+		resp, err := core.SafeHandle(ctx, handler, pattern)
+
+		// Channel results are streamed too, scoped dependencies live
+		// until the channel is drained
+		if ch := reflect.ValueOf(resp); err == nil && ch.Kind() == reflect.Chan && ch.Type().ChanDir()&reflect.RecvDir != 0 {
+			t.serveStream(ctx, w, func(ctx context.Context, emit core.Emit) (err error) {
+				defer core.CloseScope(scope, &err, t.Logger)
+				return streamChannel(ctx, ch, emit)
+			})
+			return
+		}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(code)
-			json.NewEncoder(w).Encode(resp)
+		core.CloseScope(scope, &err, t.Logger)
+		if err != nil {
+			t.handlerFailed(ctx, err)
+			t.writeError(w, err)
 			return
 		}
 
 		// Write response
-		if resp != nil {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(resp)
-		} else {
-			w.WriteHeader(http.StatusNoContent)
-		}
+		t.writeResponse(w, codec, resp)
 	})
 
 	// Apply middleware
@@ -176,8 +360,161 @@ func (t *Transport) Register(prototype core.Handler) {
 	t.mux.Handle(pattern, finalHandler)
 }
 
-// Listen starts the HTTP server.
+// handlerFailed reports a recovered panic, or logs a handler error.
+// Deliberate aborts (http.ErrAbortHandler) are re-raised.
+func (t *Transport) handlerFailed(ctx context.Context, err error) {
+	pe, ok := err.(*core.PanicError)
+	if !ok {
+		t.Logger.Error("Handler failed", "error", err)
+		return
+	}
+	if pe.Value == http.ErrAbortHandler {
+		panic(pe.Value)
+	}
+	core.ReportPanic(ctx, pe, t.panicReporter(), t.Logger, "Handler", "route")
+}
+
+// bindBody decodes the request body into the plan's body field with the
+// codec registered for its Content-Type; a body without one is read as JSON.
+func (t *Transport) bindBody(w http.ResponseWriter, req *http.Request, plan *core.Plan, elem reflect.Value) error {
+	var body []byte
+	if req.Body != nil {
+		reader := io.Reader(req.Body)
+		if t.maxBodySize > 0 {
+			reader = http.MaxBytesReader(w, req.Body, t.maxBodySize)
+		}
+
+		var err error
+		if body, err = io.ReadAll(reader); err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				return &statusError{
+					code: http.StatusRequestEntityTooLarge,
+					msg:  fmt.Sprintf("request body exceeds %d bytes", maxErr.Limit),
+				}
+			}
+			return &statusError{code: http.StatusBadRequest, msg: "failed to read request body"}
+		}
+	}
+
+	if len(body) == 0 {
+		if plan.BodyRequired() {
+			return &statusError{code: http.StatusBadRequest, msg: "request body is required"}
+		}
+		return nil
+	}
+
+	codec, ok := t.codecs.forContentType(req.Header.Get("Content-Type"))
+	if !ok {
+		return &statusError{
+			code: http.StatusUnsupportedMediaType,
+			msg:  fmt.Sprintf("unsupported content type %q", req.Header.Get("Content-Type")),
+		}
+	}
+	if _, ok := codec.(JSONCodec); ok {
+		return plan.DecodeJSON(elem, body, t.strictJSON)
+	}
+	if err := codec.Decode(bytes.NewReader(body), plan.Body(elem)); err != nil {
+		return &core.BodyError{Err: err}
+	}
+	return nil
+}
+
+// statusError is a client error detected before the handler runs.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string   { return e.msg }
+func (e *statusError) StatusCode() int { return e.code }
+
+// writeError writes err as an RFC 9457 problem (see core.ProblemMapper),
+// after passing it through the error mapper. Errors that provide their own
+// payload (core.Payloader) and no problem keep their payload.
+func (t *Transport) writeError(w http.ResponseWriter, err error) {
+	if mapError := t.errorMapper(); mapError != nil {
+		err = mapError(err)
+	}
+
+	var provider core.ProblemProvider
+	var pl core.Payloader
+	if errors.As(err, &pl) && !errors.As(err, &provider) {
+		code := http.StatusInternalServerError
+		var sc core.StatusCoder
+		if errors.As(err, &sc) {
+			code = sc.StatusCode()
+		}
+		t.encode(w, JSONCodec{}, code, "", pl.Payload())
+		return
+	}
+
+	problem := t.problems.Problem(err)
+	if err := t.encode(w, JSONCodec{}, problem.StatusCode(), core.ProblemContentType, problem); err != nil {
+		t.Logger.Error("Failed to encode error response", "error", err)
+		http.Error(w, problem.Error(), problem.StatusCode())
+	}
+}
+
+// requestValues exposes a request to a binding plan.
+// The query string is parsed at most once per request; form values come
+// from a body already parsed by parseForm.
+type requestValues struct {
+	req   *http.Request
+	query url.Values
+}
+
+func (v *requestValues) Value(source, key string) string {
+	switch source {
+	case "path":
+		return v.req.PathValue(key)
+	case "query":
+		if v.query == nil {
+			v.query = v.req.URL.Query()
+		}
+		return v.query.Get(key)
+	case "header":
+		return v.req.Header.Get(key)
+	case "cookie":
+		if c, err := v.req.Cookie(key); err == nil {
+			return c.Value
+		}
+	case "form":
+		return v.req.PostForm.Get(key)
+	}
+	return ""
+}
+
+func (v *requestValues) All(source, key string) []string {
+	switch source {
+	case "query":
+		if v.query == nil {
+			v.query = v.req.URL.Query()
+		}
+		return v.query[key]
+	case "header":
+		return v.req.Header.Values(key)
+	case "cookie":
+		var vals []string
+		for _, c := range v.req.CookiesNamed(key) {
+			vals = append(vals, c.Value)
+		}
+		return vals
+	case "form":
+		return v.req.PostForm[key]
+	}
+	if val := v.Value(source, key); val != "" {
+		return []string{val}
+	}
+	return nil
+}
+
+// Listen starts the HTTP server. Factory dependencies are built first;
+// if any fails, Listen returns the errors without serving.
 func (t *Transport) Listen(addr string) error {
+	if err := t.Container().Build(); err != nil {
+		return err
+	}
 	t.Logger.Info("HTTP transport listening", "addr", addr)
 	srv := &http.Server{Addr: addr, Handler: t.mux}
 
@@ -0,0 +1,293 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/transport/websocket"
+)
+
+var sessionType = reflect.TypeOf((*websocket.Session)(nil))
+
+// WithAllowedOrigins sets the origins, e.g. "https://app.example.com",
+// allowed to open WebSocket connections besides the server's own host.
+// Connections from other origins are rejected with 403 Forbidden.
+func WithAllowedOrigins(origins ...string) Option {
+	return func(t *Transport) { t.origins = origins }
+}
+
+// messageRoute is a compiled message handler of a WS endpoint.
+type messageRoute struct {
+	name      string
+	prototype reflect.Value
+	plan      *core.Plan
+	session   []int // index of the ws:"session" field, if any
+	endpoint  []int // index of the ws:"endpoint" field, if any
+}
+
+// registerWebSocket serves a method:"WS" endpoint. The endpoint is bound,
+// validated and its Handle called before the upgrade, so it can reject the
+// connection with a regular error response. Messages are then routed to
+// the handlers listed by its Messages method, one at a time.
+func (t *Transport) registerWebSocket(prototype reflect.Value, plan *core.Plan, path string) {
+	elemType := prototype.Elem().Type()
+	routes := map[string]*messageRoute{}
+	if ep, ok := prototype.Interface().(websocket.Endpoint); ok {
+		for _, h := range ep.Messages() {
+			r := t.compileMessage(h, prototype.Type())
+			if _, dup := routes[r.name]; dup {
+				panic(fmt.Sprintf("Transport.Register: %s handles message %q twice", elemType.Name(), r.name))
+			}
+			routes[r.name] = r
+		}
+	}
+	pattern := "WS " + path
+
+	var finalHandler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Plain requests are refused before the endpoint does any work
+		if err := websocket.CheckRequest(req); err != nil {
+			re := err.(*websocket.RequestError)
+			for k, v := range re.Header {
+				w.Header()[k] = v
+			}
+			t.writeError(w, &statusError{code: re.Status, msg: re.Reason})
+			return
+		}
+		// Browsers let any site open connections with the user's cookies,
+		// so refuse other origins before Handle runs
+		if !websocket.OriginAllowed(req, t.origins) {
+			t.writeError(w, &statusError{code: http.StatusForbidden, msg: "origin not allowed"})
+			return
+		}
+
+		newVal := reflect.New(elemType).Elem()
+		newVal.Set(prototype.Elem())
+		instance := newVal.Addr().Interface()
+
+		ctx := req.Context()
+		ctx = context.WithValue(ctx, "http_request", req)
+
+		// Scoped dependencies of the endpoint live as long as the
+		// connection, message handlers get a scope of their own within it
+		scope := t.Container().NewScope(ctx)
+		defer scope.Close(core.ErrScopeAborted)
+		if err := scope.Inject(instance); err != nil {
+			t.handlerFailed(ctx, err)
+			t.writeError(w, err)
+			return
+		}
+
+		if err := plan.Bind(newVal, &requestValues{req: req}); err != nil {
+			t.writeError(w, &statusError{code: http.StatusBadRequest, msg: err.Error()})
+			return
+		}
+		if err := core.Validate(instance); err != nil {
+			t.writeError(w, err)
+			return
+		}
+
+		// Handle decides whether the connection is accepted
+		res, err := core.SafeHandle(ctx, instance.(core.Handler), pattern)
+		if err != nil {
+			core.CloseScope(scope, &err, t.Logger)
+			t.handlerFailed(ctx, err)
+			t.writeError(w, err)
+			return
+		}
+
+		conn, err := websocket.Upgrade(w, req, t.origins...)
+		if err != nil {
+			return
+		}
+		if t.maxBodySize > 0 {
+			conn.SetReadLimit(t.maxBodySize)
+		}
+
+		session := websocket.NewSession(conn, instance)
+		ctx = websocket.WithSession(ctx, session)
+		err = t.serveSession(ctx, session, scope, instance, routes, pattern, core.Unwrap(res))
+
+		if err := scope.Close(err); err != nil {
+			t.Logger.Error("Scope cleanup failed", "route", pattern, "error", err)
+		}
+	})
+
+	for i := len(t.middleware) - 1; i >= 0; i-- {
+		finalHandler = t.middleware[i](finalHandler)
+	}
+	t.mux.Handle("GET "+path, finalHandler)
+}
+
+// compileMessage checks a message handler and locates its ws fields.
+func (t *Transport) compileMessage(h core.Handler, endpointType reflect.Type) *messageRoute {
+	val := reflect.ValueOf(h)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		panic("Transport.Register: message handler must be a pointer to a struct")
+	}
+	typ := val.Elem().Type()
+
+	r := &messageRoute{prototype: val, plan: t.binder.Plan(typ)}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Type == reflect.TypeOf(core.Pattern{}) {
+			r.name = field.Tag.Get("message")
+		}
+		switch field.Tag.Get("ws") {
+		case "":
+		case "session":
+			if field.Type != sessionType {
+				panic(fmt.Sprintf("Transport.Register: %s.%s: ws:\"session\" needs type %s", typ.Name(), field.Name, sessionType))
+			}
+			r.session = field.Index
+		case "endpoint":
+			if field.Type != endpointType {
+				panic(fmt.Sprintf("Transport.Register: %s.%s: ws:\"endpoint\" needs type %s", typ.Name(), field.Name, endpointType))
+			}
+			r.endpoint = field.Index
+		default:
+			panic(fmt.Sprintf("Transport.Register: %s.%s: unknown ws tag %q", typ.Name(), field.Name, field.Tag.Get("ws")))
+		}
+	}
+
+	if r.name == "" {
+		panic(fmt.Sprintf("Transport.Register: message handler %s missing Pattern with message tag", typ.Name()))
+	}
+	if err := core.CompileValidation(typ); err != nil {
+		panic(fmt.Sprintf("Transport.Register: struct %s has invalid validate tags: %v", typ.Name(), err))
+	}
+	return r
+}
+
+// serveSession runs the message loop of an upgraded connection. It returns
+// the error of OnOpen, if any, for the connection scope to see.
+func (t *Transport) serveSession(ctx context.Context, s *websocket.Session, scope *core.Container, endpoint any, routes map[string]*messageRoute, pattern string, open any) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if open != nil {
+		s.Send(websocket.TypeOpen, open)
+	}
+	if oh, ok := endpoint.(websocket.OpenHandler); ok {
+		if err := oh.OnOpen(ctx, s); err != nil {
+			t.Logger.Error("WebSocket open failed", "route", pattern, "error", err)
+			s.Conn().CloseWith(websocket.CloseInternalError, "")
+			return err
+		}
+	}
+
+	// Pings keep idle connections alive through proxies
+	if t.heartbeat > 0 {
+		go func() {
+			ticker := time.NewTicker(t.heartbeat)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if s.Conn().Ping() != nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	var err error
+	for {
+		var op int
+		var data []byte
+		if op, data, err = s.Conn().ReadMessage(); err != nil {
+			break
+		}
+		if op != websocket.TextMessage {
+			t.replyError(s, "", &statusError{code: http.StatusUnsupportedMediaType, msg: "only text messages are supported"})
+			continue
+		}
+
+		var msg websocket.Message
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type == "" {
+			t.replyError(s, msg.ID, &statusError{code: http.StatusBadRequest, msg: "invalid message envelope"})
+			continue
+		}
+		route, ok := routes[msg.Type]
+		if !ok {
+			t.replyError(s, msg.ID, fmt.Errorf("unknown message type %q: %w", msg.Type, core.ErrNotFound))
+			continue
+		}
+
+		res, err := t.handleMessage(ctx, s, scope, endpoint, route, &msg, pattern)
+		switch {
+		case err != nil:
+			t.replyError(s, msg.ID, err)
+		case res != nil || msg.ID != "":
+			s.Reply(websocket.TypeResult, msg.ID, res)
+		}
+	}
+
+	var ce *websocket.CloseError
+	if errors.As(err, &ce) && (ce.Code == websocket.CloseNormal || ce.Code == websocket.CloseGoingAway) {
+		err = nil
+	}
+	s.Conn().Close()
+	if ch, ok := endpoint.(websocket.CloseHandler); ok {
+		ch.OnClose(ctx, s, err)
+	}
+	return nil
+}
+
+// handleMessage binds the message data to a new handler instance and runs
+// it in a scope of its own within the connection scope.
+func (t *Transport) handleMessage(ctx context.Context, s *websocket.Session, conn *core.Container, endpoint any, route *messageRoute, msg *websocket.Message, pattern string) (any, error) {
+	newVal := reflect.New(route.prototype.Elem().Type()).Elem()
+	newVal.Set(route.prototype.Elem())
+	instance := newVal.Addr().Interface()
+
+	scope := conn.NewScope(ctx)
+	defer scope.Close(core.ErrScopeAborted)
+	if err := scope.Inject(instance); err != nil {
+		return nil, err
+	}
+
+	if route.session != nil {
+		newVal.FieldByIndex(route.session).Set(reflect.ValueOf(s))
+	}
+	if route.endpoint != nil {
+		newVal.FieldByIndex(route.endpoint).Set(reflect.ValueOf(endpoint))
+	}
+
+	if route.plan.HasBody() {
+		if len(msg.Data) == 0 || string(msg.Data) == "null" {
+			if route.plan.BodyRequired() {
+				return nil, &statusError{code: http.StatusBadRequest, msg: "message data is required"}
+			}
+		} else if err := route.plan.DecodeJSON(newVal, msg.Data, t.strictJSON); err != nil {
+			return nil, err
+		}
+	}
+	if err := core.Validate(instance); err != nil {
+		return nil, err
+	}
+
+	res, err := core.SafeHandle(ctx, instance.(core.Handler), pattern+" "+route.name)
+	core.CloseScope(scope, &err, t.Logger)
+	if err != nil {
+		t.handlerFailed(ctx, err)
+		return nil, err
+	}
+	return core.Unwrap(res), nil
+}
+
+// replyError sends err as a TypeError message carrying its problem.
+func (t *Transport) replyError(s *websocket.Session, id string, err error) {
+	if mapError := t.errorMapper(); mapError != nil {
+		err = mapError(err)
+	}
+	s.Reply(websocket.TypeError, id, t.problems.Problem(err))
+}
@@ -0,0 +1,193 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/transport/websocket"
+)
+
+type echoMessage struct {
+	Meta core.Pattern `message:"echo"`
+	Body struct {
+		Text string `json:"text" validate:"required"`
+	} `body:"json,required"`
+}
+
+func (h *echoMessage) Handle(ctx context.Context) (any, error) {
+	return h.Body, nil
+}
+
+type room struct {
+	Meta   core.Pattern  `method:"WS" path:"/ws"`
+	Opened *atomic.Int32 `inject:"Opened"`
+}
+
+func (r *room) Handle(ctx context.Context) (any, error) {
+	r.Opened.Add(1)
+	return nil, nil
+}
+
+func (r *room) Messages() []core.Handler {
+	return []core.Handler{&echoMessage{}}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		origin     string
+		wantStatus int
+	}{
+		{name: "no origin"},
+		{name: "same origin", origin: "same"},
+		{name: "cross origin", origin: "https://evil.example", wantStatus: http.StatusForbidden},
+		{name: "allowed origin", opts: []Option{WithAllowedOrigins("https://app.example")}, origin: "https://app.example"},
+		{name: "not allowed origin", opts: []Option{WithAllowedOrigins("https://app.example")}, origin: "https://evil.example", wantStatus: http.StatusForbidden},
+		{name: "any origin", opts: []Option{WithAllowedOrigins("*")}, origin: "https://evil.example"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened := &atomic.Int32{}
+			tr := New(tt.opts...)
+			tr.Provide("Opened", opened)
+			tr.Register(&room{})
+			srv := httptest.NewServer(tr)
+			defer srv.Close()
+
+			header := http.Header{}
+			switch tt.origin {
+			case "":
+			case "same":
+				header.Set("Origin", srv.URL)
+			default:
+				header.Set("Origin", tt.origin)
+			}
+			c, err := websocket.DialClient(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", header)
+
+			if tt.wantStatus != 0 {
+				var he *websocket.HandshakeError
+				if !errors.As(err, &he) || he.Response.StatusCode != tt.wantStatus {
+					t.Fatalf("DialClient error %v, want status %d", err, tt.wantStatus)
+				}
+				if n := opened.Load(); n != 0 {
+					t.Fatalf("Handle ran %d times for a refused origin", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DialClient: %v", err)
+			}
+			defer c.Close()
+
+			res, err := c.Call("echo", map[string]string{"text": "hi"})
+			if err != nil || res.Type != websocket.TypeResult || string(res.Data) != `{"text":"hi"}` {
+				t.Fatalf("Call = %+v, %v", res, err)
+			}
+		})
+	}
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	valid := map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ=="}
+	with := func(k, v string) map[string]string {
+		h := maps.Clone(valid)
+		h[k] = v
+		return h
+	}
+
+	tests := []struct {
+		name       string
+		header     map[string]string
+		wantStatus int
+		wantHeader [2]string
+	}{
+		{name: "plain request", wantStatus: http.StatusUpgradeRequired, wantHeader: [2]string{"Upgrade", "websocket"}},
+		{name: "unsupported version", header: with("Sec-WebSocket-Version", "8"), wantStatus: http.StatusBadRequest, wantHeader: [2]string{"Sec-WebSocket-Version", "13"}},
+		{name: "missing key", header: with("Sec-WebSocket-Key", ""), wantStatus: http.StatusBadRequest},
+		{name: "bad origin", header: with("Origin", "https://evil.example"), wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened := &atomic.Int32{}
+			tr := New()
+			tr.Provide("Opened", opened)
+			tr.Register(&room{})
+
+			req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			tr.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != core.ProblemContentType {
+				t.Fatalf("Content-Type %q, want a problem", got)
+			}
+			if k, v := tt.wantHeader[0], tt.wantHeader[1]; k != "" && rec.Header().Get(k) != v {
+				t.Fatalf("%s = %q, want %q", k, rec.Header().Get(k), v)
+			}
+			if n := opened.Load(); n != 0 {
+				t.Fatalf("Handle ran %d times before the upgrade was refused", n)
+			}
+		})
+	}
+}
+
+type failingOpen struct {
+	Meta core.Pattern `method:"WS" path:"/ws"`
+	Tx   *tx          `inject:"Tx"`
+}
+
+func (r *failingOpen) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+func (r *failingOpen) OnOpen(ctx context.Context, s *websocket.Session) error {
+	return errors.New("room is full")
+}
+
+func TestWebSocketOpenError(t *testing.T) {
+	closed := make(chan error, 1)
+	tr := New()
+	tr.ProvideScoped("Tx", func(c *core.Container) *tx {
+		c.OnClose(func(err error) error {
+			closed <- err
+			return nil
+		})
+		return &tx{}
+	})
+	tr.Register(&failingOpen{})
+	srv := httptest.NewServer(tr)
+	defer srv.Close()
+
+	c, err := websocket.DialClient(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("DialClient: %v", err)
+	}
+	defer c.Close()
+
+	var ce *websocket.CloseError
+	if _, err := c.Receive(); !errors.As(err, &ce) || ce.Code != websocket.CloseInternalError {
+		t.Fatalf("Receive error %v, want close code %d", err, websocket.CloseInternalError)
+	}
+	select {
+	case err := <-closed:
+		if err == nil || err.Error() != "room is full" {
+			t.Fatalf("scope closed with %v, want the OnOpen error", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("scope not closed")
+	}
+}
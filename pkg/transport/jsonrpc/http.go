@@ -0,0 +1,52 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ServeHTTP serves JSON-RPC requests sent with POST. The HTTP status is 200
+// for every response, including JSON-RPC errors, and 204 when the request
+// only carried notifications.
+//
+// Factory dependencies are built on the first request; while any fails,
+// requests are answered with 500 and the errors are logged.
+func (t *Transport) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := t.Container().Build(); err != nil {
+		t.Logger.Error("Dependencies failed", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	body := io.Reader(req.Body)
+	if t.maxBodySize > 0 {
+		body = http.MaxBytesReader(w, req.Body, t.maxBodySize)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.WithValue(req.Context(), "http_request", req)
+	resp := t.HandleMessage(ctx, data)
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
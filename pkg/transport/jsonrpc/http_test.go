@@ -0,0 +1,86 @@
+package jsonrpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+func TestServeHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		broken     bool // a factory dependency fails
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "request",
+			method:     http.MethodPost,
+			body:       `{"jsonrpc":"2.0","method":"ping","id":1}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"jsonrpc":"2.0","result":"pong","id":1}`,
+		},
+		{
+			name:       "notification",
+			method:     http.MethodPost,
+			body:       `{"jsonrpc":"2.0","method":"ping"}`,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "not POST",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "too large",
+			method:     http.MethodPost,
+			body:       `{"jsonrpc":"2.0","method":"ping","params":"` + strings.Repeat("x", 64) + `","id":1}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "dependency failed",
+			method:     http.MethodPost,
+			body:       `{"jsonrpc":"2.0","method":"ping","id":1}`,
+			broken:     true,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, calls := newTestTransport()
+			tr.maxBodySize = 64
+			built := 0
+			tr.ProvideFactory("DB", func(c *core.Container) (*config, error) {
+				built++
+				if tt.broken {
+					return nil, errors.New("connection refused")
+				}
+				return &config{}, nil
+			})
+
+			req := httptest.NewRequest(tt.method, "/rpc", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			tr.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); tt.wantBody != "" && got != tt.wantBody {
+				t.Fatalf("body %s, want %s", got, tt.wantBody)
+			}
+			if tt.broken && calls.Load() != 0 {
+				t.Fatal("method ran with a failed dependency")
+			}
+			if tt.method == http.MethodPost && built != 1 {
+				t.Fatalf("factory ran %d times, want 1", built)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Standard error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// CodeServerError is used for handler errors that are neither invalid
+	// params nor internal errors, e.g. core.ErrNotFound. The problem
+	// describing the error, with its HTTP-style status, is in Data.
+	CodeServerError = -32000
+)
+
+// Error is a JSON-RPC error object. Handlers can return one to choose the
+// code themselves; other errors are classified with the transport's
+// core.ProblemMapper:
+//
+//   - 400 and 422 problems, such as validation errors, are CodeInvalidParams
+//   - 5xx problems are CodeInternalError
+//   - anything else is CodeServerError with the problem detail as message
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+
+	err error
+}
+
+func (e *Error) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("jsonrpc: %s (%d)", e.Message, e.Code)
+}
+
+// Unwrap returns the handler error the Error was derived from, if any.
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Request is a JSON-RPC request. A request without ID is a notification.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// Response is a JSON-RPC response.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+var null = json.RawMessage("null")
+
+// toError classifies a handler error.
+func (t *Transport) toError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	if t.mapError != nil {
+		err = t.mapError(err)
+	}
+
+	p := t.problems.Problem(err)
+	e := &Error{Data: p, err: err}
+	switch status := p.StatusCode(); {
+	case status == http.StatusBadRequest || status == http.StatusUnprocessableEntity:
+		e.Code, e.Message = CodeInvalidParams, "Invalid params"
+	case status >= 500:
+		e.Code, e.Message = CodeInternalError, "Internal error"
+	default:
+		e.Code, e.Message = CodeServerError, p.Detail
+		if e.Message == "" {
+			e.Message = p.Title
+		}
+	}
+	return e
+}
+
+// HandleMessage processes one encoded request or batch and returns the
+// encoded response, or nil when there is nothing to answer (notifications).
+func (t *Transport) HandleMessage(ctx context.Context, data []byte) []byte {
+	data = bytes.TrimSpace(data)
+
+	if len(data) > 0 && data[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return encode(errorResponse(null, &Error{Code: CodeParseError, Message: "Parse error"}))
+		}
+		if len(batch) == 0 {
+			return encode(errorResponse(null, &Error{Code: CodeInvalidRequest, Message: "Invalid Request"}))
+		}
+
+		var responses []*Response
+		for _, raw := range batch {
+			if resp := t.handleRequest(ctx, raw); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return encode(responses)
+	}
+
+	if !json.Valid(data) {
+		return encode(errorResponse(null, &Error{Code: CodeParseError, Message: "Parse error"}))
+	}
+	if resp := t.handleRequest(ctx, data); resp != nil {
+		return encode(resp)
+	}
+	return nil
+}
+
+// handleRequest runs a single request. It returns nil for notifications.
+func (t *Transport) handleRequest(ctx context.Context, raw json.RawMessage) *Response {
+	var req Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return errorResponse(null, &Error{Code: CodeInvalidRequest, Message: "Invalid Request"})
+	}
+	id := req.ID
+	if id == nil {
+		id = null
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(id, &Error{Code: CodeInvalidRequest, Message: "Invalid Request"})
+	}
+
+	res, err := t.call(ctx, &req)
+	if req.ID == nil {
+		if err != nil {
+			t.Logger.Error("Notification failed", "method", req.Method, "error", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return errorResponse(id, t.toError(err))
+	}
+
+	result, err := json.Marshal(res)
+	if err != nil {
+		return errorResponse(id, &Error{Code: CodeInternalError, Message: "Internal error", err: err})
+	}
+	return &Response{JSONRPC: "2.0", Result: result, ID: id}
+}
+
+// call decodes the params of req and runs its method. Params must be an
+// object (by-name); numbers keep their precision until converted.
+func (t *Transport) call(ctx context.Context, req *Request) (any, error) {
+	var params any
+	if len(req.Params) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(req.Params))
+		dec.UseNumber()
+		if err := dec.Decode(&params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: "Invalid params", Data: err.Error()}
+		}
+	}
+
+	switch p := params.(type) {
+	case nil, map[string]any:
+	case []any:
+		if len(p) > 0 {
+			return nil, &Error{Code: CodeInvalidParams, Message: "Invalid params", Data: "params must be an object"}
+		}
+		params = nil
+	default:
+		return nil, &Error{Code: CodeInvalidParams, Message: "Invalid params", Data: "params must be an object"}
+	}
+
+	return t.Call(ctx, req.Method, params)
+}
+
+func errorResponse(id json.RawMessage, err *Error) *Response {
+	return &Response{JSONRPC: "2.0", Error: err, ID: id}
+}
+
+func encode(v any) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(errorResponse(null, &Error{Code: CodeInternalError, Message: "Internal error"}))
+	}
+	return b
+}
@@ -0,0 +1,195 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+type config struct {
+	Admin bool `json:"admin"`
+}
+
+type whoami struct {
+	Meta   core.Pattern `rpc:"whoami"`
+	Name   string       `json:"name" validate:"required"`
+	Role   string       `json:"-"`
+	Config *config      `inject:"Config"`
+}
+
+func (h *whoami) Handle(ctx context.Context) (any, error) {
+	return map[string]any{"name": h.Name, "role": h.Role, "admin": h.Config.Admin}, nil
+}
+
+type fail struct {
+	Meta core.Pattern `rpc:"fail"`
+}
+
+func (h *fail) Handle(ctx context.Context) (any, error) {
+	return nil, errors.New("boom")
+}
+
+type ping struct {
+	Meta  core.Pattern  `rpc:"ping"`
+	Calls *atomic.Int32 `inject:"Calls"`
+}
+
+func (h *ping) Handle(ctx context.Context) (any, error) {
+	h.Calls.Add(1)
+	return "pong", nil
+}
+
+func newTestTransport() (*Transport, *atomic.Int32) {
+	calls := &atomic.Int32{}
+	t := New()
+	t.Provide("Config", &config{})
+	t.Provide("Calls", calls)
+	t.Register(&whoami{Role: "user"})
+	t.Register(&fail{})
+	t.Register(&ping{})
+	return t, calls
+}
+
+func TestHandleMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		request   string
+		want      string
+		wantCalls int32
+	}{
+		{
+			name:    "call",
+			request: `{"jsonrpc":"2.0","method":"whoami","params":{"name":"ada"},"id":1}`,
+			want:    `{"jsonrpc":"2.0","result":{"admin":false,"name":"ada","role":"user"},"id":1}`,
+		},
+		{
+			name:    "params cannot set injected or json dash fields",
+			request: `{"jsonrpc":"2.0","method":"whoami","params":{"name":"ada","config":{"admin":true},"role":"admin"},"id":1}`,
+			want:    `{"jsonrpc":"2.0","result":{"admin":false,"name":"ada","role":"user"},"id":1}`,
+		},
+		{
+			name:    "validation error",
+			request: `{"jsonrpc":"2.0","method":"whoami","params":{},"id":"a"}`,
+			want:    `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params"},"id":"a"}`,
+		},
+		{
+			name:    "method not found",
+			request: `{"jsonrpc":"2.0","method":"nope","id":2}`,
+			want:    `{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found","data":"nope"},"id":2}`,
+		},
+		{
+			name:    "internal error",
+			request: `{"jsonrpc":"2.0","method":"fail","id":3}`,
+			want:    `{"jsonrpc":"2.0","error":{"code":-32603,"message":"Internal error"},"id":3}`,
+		},
+		{
+			name:    "positional params",
+			request: `{"jsonrpc":"2.0","method":"whoami","params":["ada"],"id":4}`,
+			want:    `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params","data":"params must be an object"},"id":4}`,
+		},
+		{
+			name:    "parse error",
+			request: `{"jsonrpc":"2.0",`,
+			want:    `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`,
+		},
+		{
+			name:    "invalid request",
+			request: `{"jsonrpc":"1.0","method":"ping","id":5}`,
+			want:    `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":5}`,
+		},
+		{
+			name:      "notification runs without response",
+			request:   `{"jsonrpc":"2.0","method":"ping"}`,
+			wantCalls: 1,
+		},
+		{
+			name:    "failed notification has no response",
+			request: `{"jsonrpc":"2.0","method":"fail"}`,
+		},
+		{
+			name:      "batch",
+			request:   `[{"jsonrpc":"2.0","method":"ping","id":1},{"jsonrpc":"2.0","method":"nope","id":2},{"jsonrpc":"2.0","method":"ping"}]`,
+			want:      `[{"jsonrpc":"2.0","result":"pong","id":1},{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found","data":"nope"},"id":2}]`,
+			wantCalls: 2,
+		},
+		{
+			name:      "batch of notifications has no response",
+			request:   `[{"jsonrpc":"2.0","method":"ping"},{"jsonrpc":"2.0","method":"ping"}]`,
+			wantCalls: 2,
+		},
+		{
+			name:    "batch with invalid entry",
+			request: `[1]`,
+			want:    `[{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}]`,
+		},
+		{
+			name:    "empty batch",
+			request: `[]`,
+			want:    `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, calls := newTestTransport()
+			got := tr.HandleMessage(context.Background(), []byte(tt.request))
+
+			if tt.want == "" {
+				if got != nil {
+					t.Fatalf("response %s, want none", got)
+				}
+			} else if !sameJSON(t, got, tt.want) {
+				t.Fatalf("response %s, want %s", got, tt.want)
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Fatalf("ping ran %d times, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// sameJSON compares got with want ignoring error data, which
+// carries problem details when want leaves it out.
+func sameJSON(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid response %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid expectation %s: %v", want, err)
+	}
+	stripData(g, w)
+	gb, _ := json.Marshal(g)
+	wb, _ := json.Marshal(w)
+	return string(gb) == string(wb)
+}
+
+func stripData(got, want any) {
+	switch w := want.(type) {
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			return
+		}
+		for i := range min(len(g), len(w)) {
+			stripData(g[i], w[i])
+		}
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return
+		}
+		if e, ok := g["error"].(map[string]any); ok {
+			if we, ok := w["error"].(map[string]any); ok {
+				if _, keep := we["data"]; !keep {
+					delete(e, "data")
+				}
+			}
+		}
+	}
+}
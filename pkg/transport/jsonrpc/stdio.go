@@ -0,0 +1,111 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ServeStdio serves JSON-RPC on stdin and stdout until stdin is closed or
+// ctx is cancelled. See ServeStream for the framing.
+func (t *Transport) ServeStdio(ctx context.Context) error {
+	return t.ServeStream(ctx, os.Stdin, os.Stdout)
+}
+
+// ServeStream serves JSON-RPC messages read from r, writing responses to w.
+// Two framings are supported and detected from the first message:
+//
+//   - Content-Length headers followed by a blank line, as in LSP
+//   - newline-delimited JSON, one message per line
+//
+// Responses use the framing of the request. Messages are handled one at a
+// time. ServeStream returns nil when r reaches EOF.
+//
+// Factory dependencies are built first; if any fails, ServeStream returns
+// the errors without reading r.
+func (t *Transport) ServeStream(ctx context.Context, r io.Reader, w io.Writer) error {
+	if err := t.Container().Build(); err != nil {
+		return err
+	}
+	br := bufio.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		data, framed, err := readMessage(br, t.maxBodySize)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		resp := t.HandleMessage(ctx, data)
+		if resp == nil {
+			continue
+		}
+		if framed {
+			_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(resp), resp)
+		} else {
+			_, err = fmt.Fprintf(w, "%s\n", resp)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readMessage reads the next message. framed reports whether it came with
+// a Content-Length header; otherwise it is a single line. A limit of 0
+// means no limit on framed messages.
+func readMessage(br *bufio.Reader, limit int64) (data []byte, framed bool, err error) {
+	line, err := br.ReadBytes('\n')
+	if err == io.EOF && len(bytes.TrimSpace(line)) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Anything but a header line is a message on its own, possibly
+	// invalid, which HandleMessage answers with a parse error
+	trimmed := bytes.TrimSpace(line)
+	name, value, ok := strings.Cut(string(trimmed), ":")
+	if !ok || len(trimmed) == 0 || trimmed[0] == '{' || trimmed[0] == '[' {
+		return trimmed, false, nil
+	}
+
+	// Header block: the first line is already read
+	header, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, true, fmt.Errorf("jsonrpc: invalid header: %w", err)
+	}
+	if header == nil {
+		header = textproto.MIMEHeader{}
+	}
+	header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+
+	n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil || n < 0 {
+		return nil, true, fmt.Errorf("jsonrpc: invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	if limit > 0 && n > limit {
+		return nil, true, fmt.Errorf("jsonrpc: message of %d bytes exceeds limit of %d", n, limit)
+	}
+
+	data = make([]byte, n)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return nil, true, err
+	}
+	return data, true, nil
+}
@@ -0,0 +1,191 @@
+// Package jsonrpc exposes handlers as JSON-RPC 2.0 methods, over HTTP POST
+// and over byte streams such as stdin/stdout.
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/logger"
+)
+
+// DefaultMaxBodySize is the largest HTTP request body ServeHTTP accepts
+// unless changed with WithMaxBodySize.
+const DefaultMaxBodySize = 1 << 20
+
+// Transport handles JSON-RPC 2.0 routing.
+type Transport struct {
+	core.Provider
+	binder   *core.Binder
+	Logger   logger.Logger
+	handlers map[string]core.Handler
+	mu       sync.RWMutex
+
+	problems    *core.ProblemMapper
+	mapError    core.ErrorMapper
+	maxBodySize int64
+
+	// PanicReporter receives panics recovered from handlers. When nil,
+	// they are logged with their stack.
+	PanicReporter core.PanicReporter
+}
+
+type Option func(*Transport)
+
+// WithBinder sets the binder used for params conversion.
+func WithBinder(b *core.Binder) Option {
+	return func(t *Transport) { t.binder = b }
+}
+
+// WithProblemMapper sets the mapper that classifies handler errors.
+func WithProblemMapper(m *core.ProblemMapper) Option {
+	return func(t *Transport) { t.problems = m }
+}
+
+// WithErrorMapper sets a hook that translates every handler error before
+// it is classified.
+func WithErrorMapper(m core.ErrorMapper) Option {
+	return func(t *Transport) { t.mapError = m }
+}
+
+// WithPanicReporter sets the callback that receives recovered panics.
+func WithPanicReporter(r core.PanicReporter) Option {
+	return func(t *Transport) { t.PanicReporter = r }
+}
+
+// WithMaxBodySize limits HTTP request bodies to n bytes.
+func WithMaxBodySize(n int64) Option {
+	return func(t *Transport) { t.maxBodySize = n }
+}
+
+// WithContainer sets the dependency container, e.g. to share one with
+// other transports.
+func WithContainer(c *core.Container) Option {
+	return func(t *Transport) { t.Provider = core.NewProvider(c) }
+}
+
+// New creates a new JSON-RPC transport.
+func New(opts ...Option) *Transport {
+	t := &Transport{
+		Provider:    core.NewProvider(core.NewContainer()),
+		binder:      core.NewBinder(),
+		Logger:      logger.Nop,
+		handlers:    make(map[string]core.Handler),
+		problems:    core.NewProblemMapper(),
+		maxBodySize: DefaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Binder returns the binder used for params conversion.
+func (t *Transport) Binder() *core.Binder {
+	return t.binder
+}
+
+// Problems returns the mapper used to classify handler errors.
+func (t *Transport) Problems() *core.ProblemMapper {
+	return t.problems
+}
+
+// Register adds a method.
+// Reads the `rpc:"user.get"` tag from the Pattern field, falling back to
+// `action:"user.get"` so action handlers can be exposed as they are.
+func (t *Transport) Register(prototype core.Handler) {
+	val := reflect.ValueOf(prototype)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		panic("Transport.Register: prototype must be a pointer to a struct")
+	}
+
+	elemType := val.Elem().Type()
+
+	var method string
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if field.Type == reflect.TypeOf(core.Pattern{}) {
+			method = field.Tag.Get("rpc")
+			if method == "" {
+				method = field.Tag.Get("action")
+			}
+			break
+		}
+	}
+
+	if method == "" {
+		panic(fmt.Sprintf("Transport.Register: struct %s missing Pattern with rpc or action tag", elemType.Name()))
+	}
+	if err := core.CompileValidation(elemType); err != nil {
+		panic(fmt.Sprintf("Transport.Register: struct %s has invalid validate tags: %v", elemType.Name(), err))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.handlers[method] = prototype
+	t.Logger.Info("Registered method", "method", method)
+}
+
+// Methods returns all registered method names, sorted.
+func (t *Transport) Methods() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	methods := make([]string, 0, len(t.handlers))
+	for name := range t.handlers {
+		methods = append(methods, name)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Call runs a method with already decoded params (a map or a struct, see
+// core.Binder.ApplyPayload). Failures are returned as *Error.
+func (t *Transport) Call(ctx context.Context, method string, params any) (any, error) {
+	t.mu.RLock()
+	prototype, ok := t.handlers[method]
+	t.mu.RUnlock()
+
+	if !ok {
+		return nil, &Error{Code: CodeMethodNotFound, Message: "Method not found", Data: method}
+	}
+
+	// Create new instance
+	val := reflect.ValueOf(prototype)
+	newVal := reflect.New(val.Elem().Type()).Elem()
+	newVal.Set(val.Elem())
+
+	// Inject dependencies, scoped ones live for this call
+	instance := newVal.Addr().Interface()
+	scope := t.Container().NewScope(ctx)
+	defer scope.Close(core.ErrScopeAborted)
+	if err := scope.Inject(instance); err != nil {
+		return nil, t.toError(err)
+	}
+
+	if params != nil {
+		if err := t.binder.ApplyPayload(instance, params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: "Invalid params", Data: err.Error()}
+		}
+	}
+	if err := core.Validate(instance); err != nil {
+		return nil, t.toError(err)
+	}
+
+	res, err := core.SafeHandle(ctx, instance.(core.Handler), method)
+	core.CloseScope(scope, &err, t.Logger)
+	if err != nil {
+		if pe, ok := err.(*core.PanicError); ok {
+			core.ReportPanic(ctx, pe, t.PanicReporter, t.Logger, "Method", "method")
+		}
+		return nil, t.toError(err)
+	}
+
+	// Transport metadata such as core.Response is HTTP only
+	return core.Unwrap(res), nil
+}
@@ -0,0 +1,169 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/transport/jsonrpc"
+)
+
+// ProtocolVersion is the latest MCP revision the transport implements.
+const ProtocolVersion = "2025-06-18"
+
+// protocolVersions are the supported revisions, newest first.
+var protocolVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// Tool describes a tool to clients.
+type Tool struct {
+	Name        string  `json:"name"`
+	Title       string  `json:"title,omitempty"`
+	Description string  `json:"description,omitempty"`
+	InputSchema *Schema `json:"inputSchema"`
+}
+
+// Content is an item of a tool result.
+type Content struct {
+	// Type is "text", "image" or "audio".
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// Data is base64-encoded image or audio data.
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// TextContent returns a text content item.
+func TextContent(text string) Content {
+	return Content{Type: "text", Text: text}
+}
+
+// ToolResult is the result of a tool call. Handlers can return one to
+// choose the content themselves; other results are converted:
+//
+//   - nil is an empty result
+//   - strings are a single text item
+//   - anything else is encoded as JSON in a text item, and objects are
+//     also sent as structured content
+type ToolResult struct {
+	Content           []Content `json:"content"`
+	StructuredContent any       `json:"structuredContent,omitempty"`
+	IsError           bool      `json:"isError,omitempty"`
+}
+
+// toolResult converts the result of a handler.
+func toolResult(res any) (*ToolResult, error) {
+	switch r := res.(type) {
+	case nil:
+		return &ToolResult{Content: []Content{}}, nil
+	case *ToolResult:
+		return r, nil
+	case ToolResult:
+		return &r, nil
+	case Content:
+		return &ToolResult{Content: []Content{r}}, nil
+	case []Content:
+		return &ToolResult{Content: r}, nil
+	case string:
+		return &ToolResult{Content: []Content{TextContent(r)}}, nil
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil, fmt.Errorf("encode result: %w", err)
+	}
+	result := &ToolResult{Content: []Content{TextContent(string(data))}}
+	if len(data) > 0 && data[0] == '{' {
+		result.StructuredContent = json.RawMessage(data)
+	}
+	return result, nil
+}
+
+// Implementation names a client or server.
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// initialize negotiates the protocol version and reports the server.
+type initialize struct {
+	Meta            core.Pattern   `rpc:"initialize"`
+	ProtocolVersion string         `json:"protocolVersion"`
+	ClientInfo      Implementation `json:"clientInfo"`
+
+	server *Transport
+}
+
+func (h *initialize) Handle(ctx context.Context) (any, error) {
+	version := ProtocolVersion
+	if slices.Contains(protocolVersions, h.ProtocolVersion) {
+		version = h.ProtocolVersion
+	}
+	h.server.Logger.Info("MCP client connected", "client", h.ClientInfo.Name, "version", h.ClientInfo.Version, "protocol", version)
+
+	return &initializeResult{
+		ProtocolVersion: version,
+		Capabilities: map[string]any{
+			"tools": map[string]any{"listChanged": false},
+		},
+		ServerInfo:   Implementation{Name: h.server.name, Version: h.server.version},
+		Instructions: h.server.instructions,
+	}, nil
+}
+
+type initializeResult struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	Capabilities    map[string]any `json:"capabilities"`
+	ServerInfo      Implementation `json:"serverInfo"`
+	Instructions    string         `json:"instructions,omitempty"`
+}
+
+// initialized is the notification that ends the handshake.
+type initialized struct {
+	Meta core.Pattern `rpc:"notifications/initialized"`
+}
+
+func (h *initialized) Handle(ctx context.Context) (any, error) {
+	return nil, nil
+}
+
+type ping struct {
+	Meta core.Pattern `rpc:"ping"`
+}
+
+func (h *ping) Handle(ctx context.Context) (any, error) {
+	return struct{}{}, nil
+}
+
+// listTools returns every tool in one page.
+type listTools struct {
+	Meta core.Pattern `rpc:"tools/list"`
+
+	server *Transport
+}
+
+func (h *listTools) Handle(ctx context.Context) (any, error) {
+	return map[string]any{"tools": h.server.Tools()}, nil
+}
+
+type callTool struct {
+	Meta      core.Pattern   `rpc:"tools/call"`
+	Name      string         `json:"name" validate:"required"`
+	Arguments map[string]any `json:"arguments"`
+
+	server *Transport
+}
+
+func (h *callTool) Handle(ctx context.Context) (any, error) {
+	var args any
+	if h.Arguments != nil {
+		args = h.Arguments
+	}
+	res, err := h.server.Call(ctx, h.Name, args)
+	if errors.Is(err, core.ErrNotFound) {
+		return nil, &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: "Unknown tool: " + h.Name}
+	}
+	return res, err
+}
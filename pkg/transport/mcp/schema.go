@@ -0,0 +1,217 @@
+package mcp
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+// Schema is a JSON Schema.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+var (
+	patternType         = reflect.TypeOf(core.Pattern{})
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// InputSchema derives the JSON Schema of the arguments a handler accepts,
+// a struct or a pointer to one, following the payload rules of
+// core.Binder.ApplyPayload: every exported field is a property named by
+// its json tag, or its Go name, except the Pattern, fields tagged inject
+// and fields tagged json:"-". Struct fields are nested objects.
+//
+// The `help` tag becomes the description, and fields set in the handler
+// (which every call starts from) their default value. Validate rules become
+// constraints: required, min and max (minimum and maximum for numbers,
+// lengths otherwise), len, oneof (enum), regexp (pattern) and email
+// (format).
+func InputSchema(handler any) *Schema {
+	val := reflect.ValueOf(handler)
+	for val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	return objectSchema(val.Type(), val, map[reflect.Type]bool{})
+}
+
+// objectSchema describes the fields of typ. val, when valid, holds the
+// defaults.
+func objectSchema(typ reflect.Type, val reflect.Value, seen map[reflect.Type]bool) *Schema {
+	s := &Schema{Type: "object"}
+	if seen[typ] {
+		// Recursive types stop at a plain object
+		return s
+	}
+	seen[typ] = true
+	defer delete(seen, typ)
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() || field.Type == patternType {
+			continue
+		}
+		if _, ok := field.Tag.Lookup("inject"); ok {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		var fv reflect.Value
+		if val.IsValid() {
+			fv = val.Field(i)
+		}
+		prop := schemaFor(field.Type, fv, seen)
+		if help := field.Tag.Get("help"); help != "" {
+			prop.Description = help
+		}
+		if fv.IsValid() && !fv.IsZero() && prop.Type != "object" {
+			prop.Default = fv.Interface()
+		}
+		if applyRules(prop, field) {
+			s.Required = append(s.Required, name)
+		}
+
+		if s.Properties == nil {
+			s.Properties = make(map[string]*Schema)
+		}
+		s.Properties[name] = prop
+	}
+	return s
+}
+
+func schemaFor(typ reflect.Type, val reflect.Value, seen map[reflect.Type]bool) *Schema {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+		if val.IsValid() && !val.IsNil() {
+			val = val.Elem()
+		} else {
+			val = reflect.Value{}
+		}
+	}
+
+	switch {
+	case typ == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case typ == durationType:
+		return &Schema{Type: "string", Description: "duration such as 1m30s"}
+	case reflect.PointerTo(typ).Implements(textUnmarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string"}
+		}
+		return &Schema{Type: "array", Items: schemaFor(typ.Elem(), reflect.Value{}, seen)}
+	case reflect.Map:
+		s := &Schema{Type: "object"}
+		if typ.Key().Kind() == reflect.String && typ.Elem().Kind() != reflect.Interface {
+			s.AdditionalProperties = schemaFor(typ.Elem(), reflect.Value{}, seen)
+		}
+		return s
+	case reflect.Struct:
+		return objectSchema(typ, val, seen)
+	}
+	// Interfaces accept anything
+	return &Schema{}
+}
+
+// applyRules turns the validate rules of field into constraints of s and
+// reports whether the field is required.
+func applyRules(s *Schema, field reflect.StructField) (required bool) {
+	for name, param := range core.SplitRules(field.Tag.Get("validate")) {
+		switch name {
+		case "required":
+			required = true
+		case "min", "max", "len":
+			if s.Type == "integer" || s.Type == "number" {
+				f, err := strconv.ParseFloat(param, 64)
+				if err != nil {
+					continue
+				}
+				if name == "min" {
+					s.Minimum = &f
+				} else if name == "max" {
+					s.Maximum = &f
+				}
+				continue
+			}
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			lo, hi := &s.MinLength, &s.MaxLength
+			if s.Type == "array" {
+				lo, hi = &s.MinItems, &s.MaxItems
+			} else if s.Type != "string" {
+				continue
+			}
+			switch name {
+			case "min":
+				*lo = &n
+			case "max":
+				*hi = &n
+			default:
+				*lo, *hi = &n, &n
+			}
+		case "oneof":
+			for o := range strings.SplitSeq(param, ",") {
+				s.Enum = append(s.Enum, typedValue(s.Type, strings.TrimSpace(o)))
+			}
+		case "regexp":
+			s.Pattern = param
+		case "email":
+			s.Format = "email"
+		}
+	}
+	return required
+}
+
+// typedValue renders an oneof option in the schema's type.
+func typedValue(typ, v string) any {
+	if typ == "integer" || typ == "number" || typ == "boolean" {
+		var out any
+		if err := json.Unmarshal([]byte(v), &out); err == nil {
+			return out
+		}
+	}
+	return v
+}
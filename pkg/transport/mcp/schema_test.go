@@ -0,0 +1,77 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+type searchNotes struct {
+	Meta   core.Pattern `tool:"notes.search"`
+	Query  string       `json:"query" help:"Text to look for" validate:"required; min:2"`
+	Limit  int          `json:"limit" validate:"min:1; max:100"`
+	Kind   string       `json:"kind" validate:"omitempty; oneof:note,todo"`
+	Tags   []string     `json:"tags" validate:"max:3"`
+	Slug   string       `json:"slug" validate:"regexp:^[a-z]+(;[a-z]+)*$"`
+	Secret string       `json:"-"`
+	Store  *struct{}    `inject:"Store"`
+}
+
+func (h *searchNotes) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+func TestInputSchema(t *testing.T) {
+	s := InputSchema(&searchNotes{Limit: 10})
+
+	tests := []struct {
+		property string
+		want     string
+	}{
+		{property: "query", want: `{"type":"string","description":"Text to look for","minLength":2}`},
+		{property: "limit", want: `{"type":"integer","default":10,"minimum":1,"maximum":100}`},
+		{property: "kind", want: `{"type":"string","enum":["note","todo"]}`},
+		{property: "tags", want: `{"type":"array","items":{"type":"string"},"maxItems":3}`},
+		{property: "slug", want: `{"type":"string","pattern":"^[a-z]+(;[a-z]+)*$"}`},
+		{property: "Secret"},
+		{property: "Store"},
+		{property: "Meta"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.property, func(t *testing.T) {
+			prop, ok := s.Properties[tt.property]
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("property %s should be left out", tt.property)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("property %s missing", tt.property)
+			}
+			if got := mustJSON(t, prop); got != mustJSON(t, json.RawMessage(tt.want)) {
+				t.Fatalf("schema %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if len(s.Required) != 1 || s.Required[0] != "query" {
+		t.Fatalf("required %v, want [query]", s.Required)
+	}
+}
+
+// mustJSON encodes v with sorted keys, so schemas compare as text.
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generic any
+	if err := json.Unmarshal(b, &generic); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = json.Marshal(generic)
+	return string(b)
+}
@@ -0,0 +1,78 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/transport/websocket"
+)
+
+// ServeStdio serves MCP on stdin and stdout, one JSON-RPC message per line,
+// until stdin is closed or ctx is cancelled. Nothing else may be written
+// to stdout; log to stderr instead.
+func (t *Transport) ServeStdio(ctx context.Context) error {
+	return t.ServeStream(ctx, os.Stdin, os.Stdout)
+}
+
+// ServeStream serves MCP messages read from r, writing responses to w, as
+// ServeStdio does. Factory dependencies are built first; if any fails,
+// ServeStream returns the errors without reading r.
+func (t *Transport) ServeStream(ctx context.Context, r io.Reader, w io.Writer) error {
+	if err := t.Container().Build(); err != nil {
+		return err
+	}
+	return t.rpc.ServeStream(ctx, r, w)
+}
+
+// ServeHTTP serves the streamable HTTP transport on a single endpoint.
+// Clients POST JSON-RPC messages and get the response as JSON, or 202
+// Accepted when they only sent notifications. The server sends no
+// requests of its own, so it offers no event stream: GET is answered with
+// 405. Sessions are not used.
+//
+// Factory dependencies are built on the first request; while any fails,
+// requests are answered with 500 and the errors are logged.
+func (t *Transport) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !websocket.OriginAllowed(req, t.origins) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := t.Container().Build(); err != nil {
+		t.Logger.Error("Dependencies failed", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	body := io.Reader(req.Body)
+	if t.maxBodySize > 0 {
+		body = http.MaxBytesReader(w, req.Body, t.maxBodySize)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.WithValue(req.Context(), "http_request", req)
+	resp := t.rpc.HandleMessage(ctx, data)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
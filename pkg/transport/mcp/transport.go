@@ -0,0 +1,309 @@
+// Package mcp serves handlers as Model Context Protocol tools, so LLM
+// agents can call them, over stdio and over streamable HTTP.
+//
+//	type SearchNotes struct {
+//		Meta  core.Pattern `tool:"notes.search" description:"Search notes by text"`
+//		Query string       `json:"query" help:"Text to look for" validate:"required"`
+//		Notes *NoteStore   `inject:"Notes"`
+//	}
+//
+//	t := mcp.New(mcp.WithServerInfo("notes", "1.0.0"))
+//	t.Provide("Notes", store)
+//	t.Register(&SearchNotes{})
+//	t.ServeStdio(ctx)
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/logger"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/transport/jsonrpc"
+)
+
+// Transport handles MCP tool calls.
+type Transport struct {
+	core.Provider
+	binder *core.Binder
+	Logger logger.Logger
+	tools  map[string]*tool
+	mu     sync.RWMutex
+
+	rpc          *jsonrpc.Transport
+	name         string
+	version      string
+	instructions string
+	origins      []string
+	maxBodySize  int64
+
+	problems *core.ProblemMapper
+	mapError core.ErrorMapper
+
+	// PanicReporter receives panics recovered from handlers. When nil,
+	// they are logged with their stack.
+	PanicReporter core.PanicReporter
+}
+
+// tool is a registered handler.
+type tool struct {
+	info      Tool
+	prototype core.Handler
+}
+
+type Option func(*Transport)
+
+// WithServerInfo sets the name and version reported to clients. They
+// default to the program name and "0.0.0".
+func WithServerInfo(name, version string) Option {
+	return func(t *Transport) { t.name, t.version = name, version }
+}
+
+// WithInstructions sets the text that tells clients how to use the server.
+func WithInstructions(s string) Option {
+	return func(t *Transport) { t.instructions = s }
+}
+
+// WithAllowedOrigins sets the origins allowed to call the server over
+// HTTP, e.g. "https://app.example.com". By default only requests without
+// an Origin header, or from the server's own host, are accepted.
+func WithAllowedOrigins(origins ...string) Option {
+	return func(t *Transport) { t.origins = origins }
+}
+
+// WithMaxBodySize limits HTTP bodies and Content-Length framed stream
+// messages to n bytes. It defaults to jsonrpc.DefaultMaxBodySize.
+func WithMaxBodySize(n int64) Option {
+	return func(t *Transport) { t.maxBodySize = n }
+}
+
+// WithBinder sets the binder used for arguments conversion.
+func WithBinder(b *core.Binder) Option {
+	return func(t *Transport) { t.binder = b }
+}
+
+// WithProblemMapper sets the mapper that classifies handler errors.
+func WithProblemMapper(m *core.ProblemMapper) Option {
+	return func(t *Transport) { t.problems = m }
+}
+
+// WithErrorMapper sets a hook that translates every handler error before
+// it is classified.
+func WithErrorMapper(m core.ErrorMapper) Option {
+	return func(t *Transport) { t.mapError = m }
+}
+
+// WithPanicReporter sets the callback that receives recovered panics.
+func WithPanicReporter(r core.PanicReporter) Option {
+	return func(t *Transport) { t.PanicReporter = r }
+}
+
+// WithContainer sets the dependency container, e.g. to share one with
+// other transports.
+func WithContainer(c *core.Container) Option {
+	return func(t *Transport) { t.Provider = core.NewProvider(c) }
+}
+
+// New creates a new MCP transport.
+func New(opts ...Option) *Transport {
+	t := &Transport{
+		Provider: core.NewProvider(core.NewContainer()),
+		binder:   core.NewBinder(),
+		Logger:   logger.Nop,
+		tools:    make(map[string]*tool),
+		name:     filepath.Base(os.Args[0]),
+		version:  "0.0.0",
+		problems: core.NewProblemMapper(),
+
+		maxBodySize: jsonrpc.DefaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	// The protocol methods are handlers of the JSON-RPC transport, which
+	// logs and reports panics through this one
+	t.rpc = jsonrpc.New(
+		jsonrpc.WithMaxBodySize(t.maxBodySize),
+		jsonrpc.WithPanicReporter(t.reportPanic),
+	)
+	t.rpc.Logger = rpcLogger{t}
+	t.rpc.Register(&initialize{server: t})
+	t.rpc.Register(&initialized{})
+	t.rpc.Register(&ping{})
+	t.rpc.Register(&listTools{server: t})
+	t.rpc.Register(&callTool{server: t})
+	return t
+}
+
+// Binder returns the binder used for arguments conversion.
+func (t *Transport) Binder() *core.Binder {
+	return t.binder
+}
+
+// Problems returns the mapper used to classify handler errors.
+func (t *Transport) Problems() *core.ProblemMapper {
+	return t.problems
+}
+
+// Register adds a tool.
+// Reads the `tool:"notes.search"` tag from the Pattern field, falling back
+// to `action:"notes.search"` so action handlers can be exposed as they are.
+// The description comes from the `description` tag, or `short` as used by
+// the CLI transport, and an optional `title` tag sets the display name.
+// The input schema is derived from the struct fields, see InputSchema.
+func (t *Transport) Register(prototype core.Handler) {
+	val := reflect.ValueOf(prototype)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		panic("Transport.Register: prototype must be a pointer to a struct")
+	}
+
+	elemType := val.Elem().Type()
+
+	var info Tool
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if field.Type == reflect.TypeOf(core.Pattern{}) {
+			info.Name = field.Tag.Get("tool")
+			if info.Name == "" {
+				info.Name = field.Tag.Get("action")
+			}
+			info.Title = field.Tag.Get("title")
+			info.Description = field.Tag.Get("description")
+			if info.Description == "" {
+				info.Description = field.Tag.Get("short")
+			}
+			break
+		}
+	}
+
+	if info.Name == "" {
+		panic(fmt.Sprintf("Transport.Register: struct %s missing Pattern with tool or action tag", elemType.Name()))
+	}
+	if err := core.CompileValidation(elemType); err != nil {
+		panic(fmt.Sprintf("Transport.Register: struct %s has invalid validate tags: %v", elemType.Name(), err))
+	}
+	info.InputSchema = InputSchema(prototype)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tools[info.Name] = &tool{info: info, prototype: prototype}
+	t.Logger.Info("Registered tool", "tool", info.Name)
+}
+
+// Tools returns the registered tools, sorted by name.
+func (t *Transport) Tools() []Tool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	tools := make([]Tool, 0, len(t.tools))
+	for _, tl := range t.tools {
+		tools = append(tools, tl.info)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+// Call runs a tool with already decoded arguments (a map or a struct, see
+// core.Binder.ApplyPayload), the way action.Transport.Dispatch runs an
+// action. Handler failures, including invalid arguments, are reported in
+// the result with IsError set so the model can correct itself; the error
+// is only set for unknown tools.
+func (t *Transport) Call(ctx context.Context, name string, args any) (*ToolResult, error) {
+	t.mu.RLock()
+	tl, ok := t.tools[name]
+	t.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown tool: %s: %w", name, core.ErrNotFound)
+	}
+
+	// Create new instance
+	val := reflect.ValueOf(tl.prototype)
+	newVal := reflect.New(val.Elem().Type()).Elem()
+	newVal.Set(val.Elem())
+
+	// Inject dependencies, scoped ones live for this call
+	instance := newVal.Addr().Interface()
+	scope := t.Container().NewScope(ctx)
+	defer scope.Close(core.ErrScopeAborted)
+	if err := scope.Inject(instance); err != nil {
+		return t.errorResult(err), nil
+	}
+
+	if args != nil {
+		if err := t.binder.ApplyPayload(instance, args); err != nil {
+			return t.errorResult(&argumentsError{err: err}), nil
+		}
+	}
+	if err := core.Validate(instance); err != nil {
+		return t.errorResult(err), nil
+	}
+
+	res, err := core.SafeHandle(ctx, instance.(core.Handler), name)
+	core.CloseScope(scope, &err, t.Logger)
+	if err != nil {
+		var pe *core.PanicError
+		if errors.As(err, &pe) {
+			core.ReportPanic(ctx, pe, t.PanicReporter, t.Logger, "Tool", "tool")
+		}
+		return t.errorResult(err), nil
+	}
+
+	// Transport metadata such as core.Response is HTTP only
+	result, err := toolResult(core.Unwrap(res))
+	if err != nil {
+		return t.errorResult(err), nil
+	}
+	return result, nil
+}
+
+// reportPanic passes a panic recovered by the JSON-RPC transport to the
+// PanicReporter, or logs it, as Call does for tools.
+func (t *Transport) reportPanic(ctx context.Context, pe *core.PanicError) {
+	core.ReportPanic(ctx, pe, t.PanicReporter, t.Logger, "Method", "method")
+}
+
+// rpcLogger writes the JSON-RPC transport's logs to the Logger of the
+// MCP transport, including one set after New.
+type rpcLogger struct {
+	t *Transport
+}
+
+func (l rpcLogger) Debug(msg string, kv ...any) { l.t.Logger.Debug(msg, kv...) }
+func (l rpcLogger) Info(msg string, kv ...any)  { l.t.Logger.Info(msg, kv...) }
+func (l rpcLogger) Warn(msg string, kv ...any)  { l.t.Logger.Warn(msg, kv...) }
+func (l rpcLogger) Error(msg string, kv ...any) { l.t.Logger.Error(msg, kv...) }
+func (l rpcLogger) Fatal(msg string, kv ...any) { l.t.Logger.Fatal(msg, kv...) }
+
+// errorResult describes a failed call with the problem the error maps to,
+// so the model sees the same status, detail and field errors as an HTTP
+// client.
+func (t *Transport) errorResult(err error) *ToolResult {
+	if t.mapError != nil {
+		err = t.mapError(err)
+	}
+	text, jerr := json.Marshal(t.problems.Problem(err))
+	if jerr != nil {
+		text = []byte(err.Error())
+	}
+	return &ToolResult{Content: []Content{TextContent(string(text))}, IsError: true}
+}
+
+// argumentsError is a call whose arguments cannot be applied to the
+// handler.
+type argumentsError struct {
+	err error
+}
+
+func (e *argumentsError) Error() string   { return "invalid arguments: " + e.err.Error() }
+func (e *argumentsError) Unwrap() error   { return e.err }
+func (e *argumentsError) StatusCode() int { return 400 }
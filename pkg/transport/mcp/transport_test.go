@@ -0,0 +1,301 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/logger"
+)
+
+type addNote struct {
+	Meta  core.Pattern `tool:"notes.add" title:"Add note" description:"Store a note"`
+	Text  string       `json:"text" validate:"required"`
+	Count int          `json:"count"`
+	Mode  string       `json:"mode"`
+}
+
+func (h *addNote) Handle(ctx context.Context) (any, error) {
+	switch h.Mode {
+	case "text":
+		return "saved " + h.Text, nil
+	case "content":
+		return &ToolResult{Content: []Content{TextContent("custom")}}, nil
+	case "response":
+		return core.Created("/notes/1", map[string]string{"id": "1"}), nil
+	case "missing":
+		return nil, sql.ErrNoRows
+	case "panic":
+		panic("ink ran out")
+	}
+	return map[string]any{"text": h.Text, "count": h.Count}, nil
+}
+
+type legacyTool struct {
+	Meta core.Pattern `action:"notes.clear" short:"Remove every note"`
+}
+
+func (h *legacyTool) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+func newTestTransport(opts ...Option) (*Transport, *[]*core.PanicError) {
+	var reported []*core.PanicError
+	opts = append([]Option{
+		WithServerInfo("notes", "1.2.3"),
+		WithInstructions("Use notes.add to store notes."),
+		WithPanicReporter(func(ctx context.Context, pe *core.PanicError) { reported = append(reported, pe) }),
+		WithErrorMapper(func(err error) error {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: %w", core.ErrNotFound, err)
+			}
+			return err
+		}),
+	}, opts...)
+	t := New(opts...)
+	t.Register(&addNote{})
+	t.Register(&legacyTool{})
+	return t, &reported
+}
+
+func TestCall(t *testing.T) {
+	tests := []struct {
+		name        string
+		tool        string
+		args        any
+		wantErr     error
+		wantText    string
+		wantIsError bool
+		wantPanic   bool
+	}{
+		{name: "object result", tool: "notes.add", args: map[string]any{"text": "hi", "count": 2}, wantText: `{"count":2,"text":"hi"}`},
+		{name: "struct arguments", tool: "notes.add", args: struct{ Text string }{Text: "hi"}, wantText: `{"count":0,"text":"hi"}`},
+		{name: "text result", tool: "notes.add", args: map[string]any{"text": "hi", "mode": "text"}, wantText: "saved hi"},
+		{name: "tool result", tool: "notes.add", args: map[string]any{"text": "hi", "mode": "content"}, wantText: "custom"},
+		{name: "response is unwrapped", tool: "notes.add", args: map[string]any{"text": "hi", "mode": "response"}, wantText: `{"id":"1"}`},
+		{name: "no result", tool: "notes.clear", wantText: ""},
+		{name: "unknown tool", tool: "notes.burn", wantErr: core.ErrNotFound},
+		{
+			name:        "invalid arguments",
+			tool:        "notes.add",
+			args:        map[string]any{"text": "hi", "count": "many"},
+			wantIsError: true,
+			wantText:    `"status":400`,
+		},
+		{
+			name:        "validation",
+			tool:        "notes.add",
+			args:        map[string]any{},
+			wantIsError: true,
+			wantText:    `"errors":[{"field":"text","rule":"required","message":"is required"}]`,
+		},
+		{
+			name:        "mapped handler error",
+			tool:        "notes.add",
+			args:        map[string]any{"text": "hi", "mode": "missing"},
+			wantIsError: true,
+			wantText:    `{"detail":"not found: sql: no rows in result set","status":404,"title":"Not Found"}`,
+		},
+		{
+			name:        "panic",
+			tool:        "notes.add",
+			args:        map[string]any{"text": "hi", "mode": "panic"},
+			wantIsError: true,
+			wantText:    `{"status":500,"title":"Internal Server Error"}`,
+			wantPanic:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, reported := newTestTransport()
+			res, err := tr.Call(context.Background(), tt.tool, tt.args)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) || res != nil {
+					t.Fatalf("Call = %v, %v, want error %v", res, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Call: %v", err)
+			}
+
+			text := ""
+			if len(res.Content) > 0 {
+				text = res.Content[0].Text
+			}
+			if res.IsError != tt.wantIsError || !strings.Contains(text, tt.wantText) || (tt.wantText == "" && text != "") {
+				t.Fatalf("result %q, isError %v, want %q, %v", text, res.IsError, tt.wantText, tt.wantIsError)
+			}
+			if got := len(*reported) > 0; got != tt.wantPanic {
+				t.Fatalf("panic reported %v, want %v", got, tt.wantPanic)
+			}
+		})
+	}
+}
+
+func TestServeStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    string // expected response, empty for none
+	}{
+		{
+			name:    "initialize",
+			request: `{"jsonrpc":"2.0","method":"initialize","params":{"protocolVersion":"2025-03-26","clientInfo":{"name":"agent","version":"1"}},"id":1}`,
+			want:    `{"jsonrpc":"2.0","result":{"protocolVersion":"2025-03-26","capabilities":{"tools":{"listChanged":false}},"serverInfo":{"name":"notes","version":"1.2.3"},"instructions":"Use notes.add to store notes."},"id":1}`,
+		},
+		{
+			name:    "initialize with an unknown version",
+			request: `{"jsonrpc":"2.0","method":"initialize","params":{"protocolVersion":"1999-01-01"},"id":1}`,
+			want:    `{"jsonrpc":"2.0","result":{"protocolVersion":"2025-06-18","capabilities":{"tools":{"listChanged":false}},"serverInfo":{"name":"notes","version":"1.2.3"},"instructions":"Use notes.add to store notes."},"id":1}`,
+		},
+		{name: "initialized", request: `{"jsonrpc":"2.0","method":"notifications/initialized"}`},
+		{name: "ping", request: `{"jsonrpc":"2.0","id":2,"method":"ping"}`, want: `{"jsonrpc":"2.0","result":{},"id":2}`},
+		{
+			name:    "tools/list",
+			request: `{"jsonrpc":"2.0","method":"tools/list","id":3}`,
+			want: `{"jsonrpc":"2.0","result":{"tools":[` +
+				`{"name":"notes.add","title":"Add note","description":"Store a note","inputSchema":{"type":"object","properties":{"count":{"type":"integer"},"mode":{"type":"string"},"text":{"type":"string"}},"required":["text"]}},` +
+				`{"name":"notes.clear","description":"Remove every note","inputSchema":{"type":"object"}}]},"id":3}`,
+		},
+		{
+			name:    "tools/call",
+			request: `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"notes.add","arguments":{"text":"hi","mode":"text"}},"id":4}`,
+			want:    `{"jsonrpc":"2.0","result":{"content":[{"type":"text","text":"saved hi"}]},"id":4}`,
+		},
+		{
+			name:    "tools/call failure",
+			request: `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"notes.add","arguments":{"text":"hi","mode":"missing"}},"id":5}`,
+			want:    `{"jsonrpc":"2.0","result":{"content":[{"type":"text","text":"{\"detail\":\"not found: sql: no rows in result set\",\"status\":404,\"title\":\"Not Found\"}"}],"isError":true},"id":5}`,
+		},
+		{
+			name:    "tools/call unknown tool",
+			request: `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"notes.burn"},"id":6}`,
+			want:    `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Unknown tool: notes.burn"},"id":6}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, _ := newTestTransport()
+			var out bytes.Buffer
+			if err := tr.ServeStream(context.Background(), strings.NewReader(tt.request+"\n"), &out); err != nil {
+				t.Fatalf("ServeStream: %v", err)
+			}
+			if got := strings.TrimSpace(out.String()); got != tt.want {
+				t.Fatalf("response:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	const ping = `{"jsonrpc":"2.0","method":"ping","id":1}`
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		method     string
+		origin     string
+		body       string
+		broken     bool // a factory dependency fails
+		wantStatus int
+	}{
+		{name: "no origin", method: http.MethodPost, body: ping, wantStatus: http.StatusOK},
+		{name: "same host", method: http.MethodPost, origin: "http://example.com", body: ping, wantStatus: http.StatusOK},
+		{name: "same host, other case", method: http.MethodPost, origin: "http://EXAMPLE.com", body: ping, wantStatus: http.StatusOK},
+		{name: "cross origin", method: http.MethodPost, origin: "http://evil.test", body: ping, wantStatus: http.StatusForbidden},
+		{
+			name:       "allowed origin",
+			opts:       []Option{WithAllowedOrigins("http://app.test")},
+			method:     http.MethodPost,
+			origin:     "http://app.test",
+			body:       ping,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "same host with allowed origins",
+			opts:       []Option{WithAllowedOrigins("http://app.test")},
+			method:     http.MethodPost,
+			origin:     "http://example.com",
+			body:       ping,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "any origin",
+			opts:       []Option{WithAllowedOrigins("*")},
+			method:     http.MethodPost,
+			origin:     "http://evil.test",
+			body:       ping,
+			wantStatus: http.StatusOK,
+		},
+		{name: "forbidden before method check", method: http.MethodGet, origin: "http://evil.test", wantStatus: http.StatusForbidden},
+		{name: "no event stream", method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed},
+		{name: "notification", method: http.MethodPost, body: `{"jsonrpc":"2.0","method":"notifications/initialized"}`, wantStatus: http.StatusAccepted},
+		{
+			name:       "body too large",
+			opts:       []Option{WithMaxBodySize(16)},
+			method:     http.MethodPost,
+			body:       ping,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{name: "dependency failed", method: http.MethodPost, body: ping, broken: true, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, _ := newTestTransport(tt.opts...)
+			if tt.broken {
+				tr.ProvideFactory("DB", func(c *core.Container) (*sql.DB, error) {
+					return nil, errors.New("connection refused")
+				})
+			}
+			req := httptest.NewRequest(tt.method, "http://example.com/mcp", strings.NewReader(tt.body))
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			tr.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == http.StatusOK && strings.TrimSpace(rec.Body.String()) != `{"jsonrpc":"2.0","result":{},"id":1}` {
+				t.Fatalf("body %s, want the ping result", rec.Body)
+			}
+		})
+	}
+}
+
+func TestServeStreamLimitsAndLogs(t *testing.T) {
+	tr, _ := newTestTransport(WithMaxBodySize(16))
+	var logs bytes.Buffer
+	tr.Logger = logger.NewSlog(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	input := `{"jsonrpc":"2.0","method":"tools/call","params":{}}`
+	framed := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(input), input)
+	var out bytes.Buffer
+	err := tr.ServeStream(context.Background(), strings.NewReader(framed), &out)
+	if err == nil || !strings.Contains(err.Error(), "exceeds limit of 16") {
+		t.Fatalf("ServeStream error %v, want the message limit", err)
+	}
+
+	// A failed notification is logged by the JSON-RPC transport
+	input += "\n"
+	tr, _ = newTestTransport()
+	tr.Logger = logger.NewSlog(slog.New(slog.NewTextHandler(&logs, nil)))
+	out.Reset()
+	if err := tr.ServeStream(context.Background(), strings.NewReader(input), &out); err != nil {
+		t.Fatalf("ServeStream: %v", err)
+	}
+	if out.Len() > 0 || !strings.Contains(logs.String(), "Notification failed") {
+		t.Fatalf("response %q, logs %q, want the failed notification logged only", out.String(), logs.String())
+	}
+}
@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Message is a message on a topic.
+type Message struct {
+	ID      string
+	Topic   string
+	Body    []byte
+	Headers map[string]string
+	// Attempt is the delivery count, 1 for the first delivery. Brokers
+	// increase it when a message is redelivered after a Nack.
+	Attempt int
+	// Time is when the message was first published.
+	Time time.Time
+}
+
+// Delivery is a message handed to a consumer. Exactly one of Ack or Nack
+// must be called.
+type Delivery interface {
+	Message() *Message
+	// Ack removes the message from the group's queue.
+	Ack() error
+	// Nack returns the message to the group's queue, to be redelivered
+	// after delay with its Attempt increased.
+	Nack(delay time.Duration) error
+}
+
+// Broker connects the transport to a message system.
+//
+// Every consumer group of a topic receives each message published to it;
+// within a group, each message goes to one subscriber. Adapters for Kafka,
+// NATS, SQS and the like implement this interface; MemoryBroker is an
+// in-process implementation.
+type Broker interface {
+	Publish(ctx context.Context, msg *Message) error
+	// Subscribe returns the deliveries of topic for group. The channel is
+	// closed when ctx is cancelled.
+	Subscribe(ctx context.Context, topic, group string) (<-chan Delivery, error)
+}
+
+type messageKey struct{}
+
+// WithMessage returns a context carrying the message being handled.
+func WithMessage(ctx context.Context, msg *Message) context.Context {
+	return context.WithValue(ctx, messageKey{}, msg)
+}
+
+// MessageFrom returns the message a handler is consuming.
+func MessageFrom(ctx context.Context) (*Message, bool) {
+	msg, ok := ctx.Value(messageKey{}).(*Message)
+	return msg, ok
+}
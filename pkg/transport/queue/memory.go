@@ -0,0 +1,241 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryBroker is an in-process Broker for tests and local development.
+// Messages published to a topic before any group subscribed are kept and
+// handed to the first group that does. Nothing is persisted.
+type MemoryBroker struct {
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+	nextID uint64
+	timers map[*time.Timer]struct{}
+	closed bool
+}
+
+type memoryTopic struct {
+	groups  map[string]*memoryGroup
+	backlog []*Message // published while no group existed
+}
+
+// memoryGroup is the queue of one consumer group. Its subscribers take
+// messages from it in turn.
+type memoryGroup struct {
+	queue    []*Message
+	inflight int
+	notify   chan struct{} // closed and replaced when the queue grows
+}
+
+// NewMemoryBroker creates an empty in-memory broker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		topics: make(map[string]*memoryTopic),
+		timers: make(map[*time.Timer]struct{}),
+	}
+}
+
+// Publish adds msg to the queue of every group of its topic. A missing ID
+// and Time are filled in.
+func (b *MemoryBroker) Publish(ctx context.Context, msg *Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return fmt.Errorf("queue: broker closed")
+	}
+	if msg.ID == "" {
+		b.nextID++
+		msg.ID = strconv.FormatUint(b.nextID, 10)
+	}
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+
+	t := b.topic(msg.Topic)
+	if len(t.groups) == 0 {
+		t.backlog = append(t.backlog, copyMessage(msg, 1))
+		return nil
+	}
+	for _, g := range t.groups {
+		g.push(copyMessage(msg, 1))
+	}
+	return nil
+}
+
+// Subscribe returns the deliveries of topic for group.
+func (b *MemoryBroker) Subscribe(ctx context.Context, topic, group string) (<-chan Delivery, error) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil, fmt.Errorf("queue: broker closed")
+	}
+	t := b.topic(topic)
+	g, ok := t.groups[group]
+	if !ok {
+		g = &memoryGroup{notify: make(chan struct{})}
+		t.groups[group] = g
+		for _, msg := range t.backlog {
+			g.push(msg)
+		}
+		t.backlog = nil
+	}
+	b.mu.Unlock()
+
+	out := make(chan Delivery)
+	go func() {
+		defer close(out)
+		for {
+			b.mu.Lock()
+			if len(g.queue) == 0 {
+				notify := g.notify
+				b.mu.Unlock()
+				select {
+				case <-ctx.Done():
+					return
+				case <-notify:
+					continue
+				}
+			}
+			msg := g.queue[0]
+			g.queue = g.queue[1:]
+			g.inflight++
+			b.mu.Unlock()
+
+			select {
+			case out <- &memoryDelivery{broker: b, group: g, msg: msg}:
+			case <-ctx.Done():
+				// Not handed out: put it back for other subscribers
+				b.mu.Lock()
+				g.inflight--
+				g.queue = append([]*Message{msg}, g.queue...)
+				g.wake()
+				b.mu.Unlock()
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Pending returns the number of messages of a group that are queued,
+// waiting for redelivery or not yet acknowledged.
+func (b *MemoryBroker) Pending(topic, group string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[topic]
+	if !ok {
+		return 0
+	}
+	g, ok := t.groups[group]
+	if !ok {
+		return len(t.backlog)
+	}
+	return len(g.queue) + g.inflight
+}
+
+// Close stops pending redeliveries and makes Publish and Subscribe fail.
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for timer := range b.timers {
+		timer.Stop()
+	}
+	clear(b.timers)
+	return nil
+}
+
+// topic returns the named topic, creating it. The caller holds b.mu.
+func (b *MemoryBroker) topic(name string) *memoryTopic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &memoryTopic{groups: make(map[string]*memoryGroup)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// push appends msg and wakes up the subscribers. The caller holds b.mu.
+func (g *memoryGroup) push(msg *Message) {
+	g.queue = append(g.queue, msg)
+	g.wake()
+}
+
+// wake tells the subscribers the queue grew. The caller holds b.mu.
+func (g *memoryGroup) wake() {
+	close(g.notify)
+	g.notify = make(chan struct{})
+}
+
+type memoryDelivery struct {
+	broker *MemoryBroker
+	group  *memoryGroup
+	msg    *Message
+	once   sync.Once
+}
+
+func (d *memoryDelivery) Message() *Message {
+	return d.msg
+}
+
+func (d *memoryDelivery) Ack() error {
+	return d.settle(func() {
+		d.group.inflight--
+	})
+}
+
+func (d *memoryDelivery) Nack(delay time.Duration) error {
+	return d.settle(func() {
+		b := d.broker
+		msg := copyMessage(d.msg, d.msg.Attempt+1)
+		if delay <= 0 {
+			d.group.inflight--
+			d.group.push(msg)
+			return
+		}
+
+		// Still pending until it is queued again
+		var timer *time.Timer
+		timer = time.AfterFunc(delay, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.timers[timer]; !ok {
+				return
+			}
+			delete(b.timers, timer)
+			d.group.inflight--
+			d.group.push(msg)
+		})
+		b.timers[timer] = struct{}{}
+	})
+}
+
+func (d *memoryDelivery) settle(fn func()) error {
+	settled := false
+	d.once.Do(func() {
+		settled = true
+		d.broker.mu.Lock()
+		defer d.broker.mu.Unlock()
+		fn()
+	})
+	if !settled {
+		return fmt.Errorf("queue: message %s already acknowledged", d.msg.ID)
+	}
+	return nil
+}
+
+func copyMessage(msg *Message, attempt int) *Message {
+	c := *msg
+	c.Headers = maps.Clone(msg.Headers)
+	c.Attempt = attempt
+	return &c
+}
@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// receive returns the next delivery, failing the test after a second.
+func receive(t *testing.T, deliveries <-chan Delivery) Delivery {
+	t.Helper()
+	select {
+	case d, ok := <-deliveries:
+		if !ok {
+			t.Fatal("deliveries closed")
+		}
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("no delivery")
+	}
+	return nil
+}
+
+func TestMemoryBroker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewMemoryBroker()
+
+	// Kept for the first group
+	if err := b.Publish(ctx, &Message{Topic: "orders", Body: []byte("early")}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got := b.Pending("orders", "billing"); got != 1 {
+		t.Fatalf("Pending before subscribing = %d, want 1", got)
+	}
+
+	billing, err := b.Subscribe(ctx, "orders", "billing")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	d := receive(t, billing)
+	if msg := d.Message(); string(msg.Body) != "early" || msg.Attempt != 1 || msg.ID == "" || msg.Time.IsZero() {
+		t.Fatalf("first delivery %+v, want the early message, attempt 1, with ID and time", msg)
+	}
+	if err := d.Ack(); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if err := d.Nack(0); err == nil || !strings.Contains(err.Error(), "already acknowledged") {
+		t.Fatalf("Nack after Ack error %v, want already acknowledged", err)
+	}
+
+	// Every group receives each message
+	shipping, err := b.Subscribe(ctx, "orders", "shipping")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if err := b.Publish(ctx, &Message{Topic: "orders", Body: []byte("a"), Headers: map[string]string{"k": "v"}}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	for _, deliveries := range []<-chan Delivery{billing, shipping} {
+		d := receive(t, deliveries)
+		if string(d.Message().Body) != "a" || d.Message().Headers["k"] != "v" {
+			t.Fatalf("delivery %+v, want message a", d.Message())
+		}
+		// Copies per group
+		d.Message().Headers["k"] = "changed"
+		if err := d.Ack(); err != nil {
+			t.Fatalf("Ack: %v", err)
+		}
+	}
+	if got := b.Pending("orders", "billing") + b.Pending("orders", "shipping"); got != 0 {
+		t.Fatalf("Pending after Ack = %d, want 0", got)
+	}
+}
+
+func TestMemoryBrokerNack(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewMemoryBroker()
+	deliveries, err := b.Subscribe(ctx, "orders", "billing")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	b.Publish(ctx, &Message{Topic: "orders", Body: []byte("a")})
+
+	d := receive(t, deliveries)
+	if err := d.Nack(0); err != nil {
+		t.Fatalf("Nack: %v", err)
+	}
+	d = receive(t, deliveries)
+	if d.Message().Attempt != 2 {
+		t.Fatalf("redelivery attempt %d, want 2", d.Message().Attempt)
+	}
+
+	// Pending while waiting for the delay
+	start := time.Now()
+	d.Nack(20 * time.Millisecond)
+	if got := b.Pending("orders", "billing"); got != 1 {
+		t.Fatalf("Pending during the delay = %d, want 1", got)
+	}
+	d = receive(t, deliveries)
+	if d.Message().Attempt != 3 || time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("delayed redelivery attempt %d after %s, want attempt 3 after 20ms", d.Message().Attempt, time.Since(start))
+	}
+
+	// Close drops pending redeliveries
+	d.Nack(10 * time.Millisecond)
+	b.Close()
+	select {
+	case d := <-deliveries:
+		t.Fatalf("redelivered %+v after Close", d.Message())
+	case <-time.After(30 * time.Millisecond):
+	}
+	if err := b.Publish(ctx, &Message{Topic: "orders"}); err == nil {
+		t.Fatal("Publish after Close succeeded")
+	}
+	if _, err := b.Subscribe(ctx, "orders", "other"); err == nil {
+		t.Fatal("Subscribe after Close succeeded")
+	}
+}
+
+func TestMemoryBrokerCancel(t *testing.T) {
+	b := NewMemoryBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := b.Subscribe(ctx, "orders", "billing"); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	b.Publish(context.Background(), &Message{Topic: "orders", Body: []byte("a")})
+	// The subscriber takes the message and waits for a reader
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	// The message it did not hand out goes to the next subscriber
+	again, err := b.Subscribe(context.Background(), "orders", "billing")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if d := receive(t, again); string(d.Message().Body) != "a" {
+		t.Fatalf("delivery %q, want a", d.Message().Body)
+	}
+}
@@ -0,0 +1,49 @@
+package queue
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy decides how failed messages are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of deliveries before a message is
+	// dead-lettered, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the delay before the second delivery.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay.
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after each attempt.
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction, e.g. 0.2 for
+	// ±20%, so failing consumers do not retry in lockstep.
+	Jitter float64
+}
+
+// DefaultRetryPolicy makes 5 attempts, waiting 1s, 2s, 4s and 8s (±20%)
+// in between.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// Backoff returns the delay before the delivery following attempt.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+	d := float64(p.InitialBackoff) * math.Pow(mult, float64(max(attempt-1, 0)))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
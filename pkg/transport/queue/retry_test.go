@@ -0,0 +1,60 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		want   []time.Duration // for attempts 1, 2, ...
+	}{
+		{
+			name:   "exponential",
+			policy: RetryPolicy{InitialBackoff: time.Second, Multiplier: 2},
+			want:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second},
+		},
+		{
+			name:   "capped",
+			policy: RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second, Multiplier: 2},
+			want:   []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second},
+		},
+		{
+			name:   "constant below a multiplier of 1",
+			policy: RetryPolicy{InitialBackoff: time.Second, Multiplier: 0.5},
+			want:   []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			name:   "no backoff",
+			policy: RetryPolicy{MaxAttempts: 3},
+			want:   []time.Duration{0, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				if got := tt.policy.Backoff(i + 1); got != want {
+					t.Fatalf("Backoff(%d) = %s, want %s", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, Multiplier: 2, Jitter: 0.2}
+	seen := make(map[time.Duration]bool)
+	for range 100 {
+		d := p.Backoff(2)
+		if d < 1600*time.Millisecond || d > 2400*time.Millisecond {
+			t.Fatalf("Backoff(2) = %s, want 2s ±20%%", d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 {
+		t.Fatal("Backoff with jitter returned the same delay every time")
+	}
+}
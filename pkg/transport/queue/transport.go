@@ -0,0 +1,386 @@
+// Package queue runs handlers as message-queue consumers.
+//
+//	type ChargeOrder struct {
+//		Meta    core.Pattern `topic:"orders.created" group:"billing"`
+//		OrderID string       `json:"order_id" validate:"required"`
+//	}
+//
+//	t := queue.New(queue.WithBroker(broker))
+//	t.Register(&ChargeOrder{})
+//	t.Run(ctx)
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/logger"
+)
+
+// DeadLetterSuffix is appended to a topic to name its dead-letter topic
+// unless the handler sets one with a dlq tag.
+const DeadLetterSuffix = ".dlq"
+
+// Headers added to dead-lettered messages.
+const (
+	HeaderError         = "x-dead-letter-error"
+	HeaderOriginalTopic = "x-dead-letter-topic"
+	HeaderAttempts      = "x-dead-letter-attempts"
+)
+
+// Transport handles message consumption.
+type Transport struct {
+	core.Provider
+	binder    *core.Binder
+	Logger    logger.Logger
+	broker    Broker
+	consumers []*consumer
+	mu        sync.RWMutex
+
+	problems    *core.ProblemMapper
+	mapError    core.ErrorMapper
+	retry       RetryPolicy
+	concurrency int
+
+	// PanicReporter receives panics recovered from handlers. When nil,
+	// they are logged with their stack.
+	PanicReporter core.PanicReporter
+}
+
+// consumer is a registered handler.
+type consumer struct {
+	topic       string
+	group       string
+	deadLetter  string
+	concurrency int
+	prototype   reflect.Value
+	plan        *core.Plan
+}
+
+type Option func(*Transport)
+
+// WithBroker sets the broker messages are consumed from. The default is a
+// new MemoryBroker.
+func WithBroker(b Broker) Option {
+	return func(t *Transport) { t.broker = b }
+}
+
+// WithBinder sets the binder used for payloads and headers.
+func WithBinder(b *core.Binder) Option {
+	return func(t *Transport) { t.binder = b }
+}
+
+// WithProblemMapper sets the mapper that classifies handler errors.
+func WithProblemMapper(m *core.ProblemMapper) Option {
+	return func(t *Transport) { t.problems = m }
+}
+
+// WithErrorMapper sets a hook that translates every handler error before
+// it is classified.
+func WithErrorMapper(m core.ErrorMapper) Option {
+	return func(t *Transport) { t.mapError = m }
+}
+
+// WithPanicReporter sets the callback that receives recovered panics.
+func WithPanicReporter(r core.PanicReporter) Option {
+	return func(t *Transport) { t.PanicReporter = r }
+}
+
+// WithRetry sets the retry policy, DefaultRetryPolicy by default.
+func WithRetry(p RetryPolicy) Option {
+	return func(t *Transport) { t.retry = p }
+}
+
+// WithConcurrency sets how many messages each consumer handles at once,
+// 1 by default. Handlers can override it with a concurrency tag.
+func WithConcurrency(n int) Option {
+	return func(t *Transport) { t.concurrency = n }
+}
+
+// WithContainer sets the dependency container, e.g. to share one with
+// other transports.
+func WithContainer(c *core.Container) Option {
+	return func(t *Transport) { t.Provider = core.NewProvider(c) }
+}
+
+// New creates a new queue transport.
+func New(opts ...Option) *Transport {
+	t := &Transport{
+		Provider:    core.NewProvider(core.NewContainer()),
+		binder:      core.NewBinder(),
+		Logger:      logger.Nop,
+		problems:    core.NewProblemMapper(),
+		retry:       DefaultRetryPolicy,
+		concurrency: 1,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.broker == nil {
+		t.broker = NewMemoryBroker()
+	}
+	t.binder.Declare("header")
+	return t
+}
+
+// Binder returns the binder used for payloads and headers.
+func (t *Transport) Binder() *core.Binder {
+	return t.binder
+}
+
+// Problems returns the mapper used to classify handler errors.
+func (t *Transport) Problems() *core.ProblemMapper {
+	return t.problems
+}
+
+// Broker returns the broker messages are consumed from.
+func (t *Transport) Broker() Broker {
+	return t.broker
+}
+
+// Register adds a consumer.
+// Reads `topic:"orders.created"` and `group:"billing"` tags from the
+// Pattern field, and optionally `dlq:"orders.failed"` and
+// `concurrency:"4"`. The group defaults to the topic name. The JSON body
+// of each message is applied to the handler like an action payload and
+// `header:"key"` fields are bound from the message headers.
+func (t *Transport) Register(prototype core.Handler) {
+	val := reflect.ValueOf(prototype)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		panic("Transport.Register: prototype must be a pointer to a struct")
+	}
+
+	elemType := val.Elem().Type()
+
+	c := &consumer{prototype: val, plan: t.binder.Plan(elemType), concurrency: t.concurrency}
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if field.Type == reflect.TypeOf(core.Pattern{}) {
+			c.topic = field.Tag.Get("topic")
+			c.group = field.Tag.Get("group")
+			c.deadLetter = field.Tag.Get("dlq")
+			if n := field.Tag.Get("concurrency"); n != "" {
+				var err error
+				if c.concurrency, err = strconv.Atoi(n); err != nil || c.concurrency < 1 {
+					panic(fmt.Sprintf("Transport.Register: struct %s has invalid concurrency %q", elemType.Name(), n))
+				}
+			}
+			break
+		}
+	}
+
+	if c.topic == "" {
+		panic(fmt.Sprintf("Transport.Register: struct %s missing Pattern with topic tag", elemType.Name()))
+	}
+	if err := core.CompileValidation(elemType); err != nil {
+		panic(fmt.Sprintf("Transport.Register: struct %s has invalid validate tags: %v", elemType.Name(), err))
+	}
+	if c.group == "" {
+		c.group = c.topic
+	}
+	if c.deadLetter == "" {
+		c.deadLetter = c.topic + DeadLetterSuffix
+	}
+	c.concurrency = max(c.concurrency, 1)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, other := range t.consumers {
+		if other.topic == c.topic && other.group == c.group {
+			panic(fmt.Sprintf("Transport.Register: topic %q already has a consumer in group %q", c.topic, c.group))
+		}
+	}
+	t.consumers = append(t.consumers, c)
+	t.Logger.Info("Registered consumer", "topic", c.topic, "group", c.group)
+}
+
+// Publish encodes payload as JSON, unless it is a []byte, and publishes
+// it to topic.
+func (t *Transport) Publish(ctx context.Context, topic string, payload any) error {
+	body, ok := payload.([]byte)
+	if !ok {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return fmt.Errorf("queue: encode payload: %w", err)
+		}
+	}
+	return t.broker.Publish(ctx, &Message{Topic: topic, Body: body})
+}
+
+// Run subscribes every consumer and handles messages until ctx is
+// cancelled. It then waits for the messages being handled, whose context
+// is not cancelled, and returns nil. Factory dependencies are built
+// first; if any fails, Run returns the errors without subscribing.
+func (t *Transport) Run(ctx context.Context) error {
+	if err := t.Container().Build(); err != nil {
+		return err
+	}
+
+	t.mu.RLock()
+	consumers := append([]*consumer(nil), t.consumers...)
+	t.mu.RUnlock()
+
+	subs := make([]<-chan Delivery, len(consumers))
+	for i, c := range consumers {
+		deliveries, err := t.broker.Subscribe(ctx, c.topic, c.group)
+		if err != nil {
+			return fmt.Errorf("queue: subscribe to %s as %s: %w", c.topic, c.group, err)
+		}
+		subs[i] = deliveries
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.consume(ctx, c, subs[i])
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// consume handles the deliveries of one consumer, at most c.concurrency
+// at a time.
+func (t *Transport) consume(ctx context.Context, c *consumer, deliveries <-chan Delivery) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// In-flight messages finish even when ctx is cancelled
+	handleCtx := context.WithoutCancel(ctx)
+	sem := make(chan struct{}, c.concurrency)
+	for d := range deliveries {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			t.process(handleCtx, c, d)
+		}()
+	}
+}
+
+// process handles one delivery and settles it: Ack on success, Nack with
+// backoff on failure, and dead-lettering once the attempts are exhausted
+// or when the message itself is invalid.
+func (t *Transport) process(ctx context.Context, c *consumer, d Delivery) {
+	msg := d.Message()
+	err := t.handle(ctx, c, msg)
+	if err == nil {
+		if err := d.Ack(); err != nil {
+			t.Logger.Error("Ack failed", "topic", c.topic, "group", c.group, "id", msg.ID, "error", err)
+		}
+		return
+	}
+
+	if t.mapError != nil {
+		err = t.mapError(err)
+	}
+	category := core.CategoryFor(t.problems.Problem(err).StatusCode())
+	t.Logger.Error("Message failed", "topic", c.topic, "group", c.group, "id", msg.ID, "attempt", msg.Attempt, "category", category, "error", err)
+
+	if retryable(category) && msg.Attempt < t.retry.MaxAttempts {
+		if err := d.Nack(t.retry.Backoff(msg.Attempt)); err != nil {
+			t.Logger.Error("Nack failed", "topic", c.topic, "group", c.group, "id", msg.ID, "error", err)
+		}
+		return
+	}
+
+	dead := copyMessage(msg, 0)
+	dead.ID = ""
+	dead.Topic = c.deadLetter
+	if dead.Headers == nil {
+		dead.Headers = map[string]string{}
+	}
+	dead.Headers[HeaderError] = err.Error()
+	dead.Headers[HeaderOriginalTopic] = c.topic
+	dead.Headers[HeaderAttempts] = strconv.Itoa(msg.Attempt)
+	if err := t.broker.Publish(ctx, dead); err != nil {
+		t.Logger.Error("Dead-lettering failed", "topic", c.topic, "dlq", c.deadLetter, "id", msg.ID, "error", err)
+		d.Nack(t.retry.Backoff(msg.Attempt))
+		return
+	}
+	d.Ack()
+}
+
+// retryable reports whether a failure of this category can go away on a
+// later attempt: client errors never do, except rate limits and timeouts.
+func retryable(c core.Category) bool {
+	switch c {
+	case core.CategoryInvalid, core.CategoryUnauthenticated, core.CategoryForbidden,
+		core.CategoryNotFound, core.CategoryConflict:
+		return false
+	}
+	return true
+}
+
+// handle binds a message to a new handler instance and runs it.
+func (t *Transport) handle(ctx context.Context, c *consumer, msg *Message) error {
+	// Create new instance
+	newVal := reflect.New(c.prototype.Elem().Type()).Elem()
+	newVal.Set(c.prototype.Elem())
+
+	// Inject dependencies, scoped ones live for this delivery
+	instance := newVal.Addr().Interface()
+	ctx = WithMessage(ctx, msg)
+	scope := t.Container().NewScope(ctx)
+	defer scope.Close(core.ErrScopeAborted)
+	if err := scope.Inject(instance); err != nil {
+		return err
+	}
+
+	if len(bytes.TrimSpace(msg.Body)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(msg.Body))
+		dec.UseNumber()
+		var payload any
+		if err := dec.Decode(&payload); err != nil {
+			return &payloadError{err: err}
+		}
+		if err := t.binder.ApplyPayload(instance, payload); err != nil {
+			return &payloadError{err: err}
+		}
+	}
+	if err := c.plan.Bind(newVal, headerValues(msg.Headers)); err != nil {
+		return &payloadError{err: err}
+	}
+	if err := core.Validate(instance); err != nil {
+		return err
+	}
+
+	_, err := core.SafeHandle(ctx, instance.(core.Handler), c.topic)
+	core.CloseScope(scope, &err, t.Logger)
+	var pe *core.PanicError
+	if errors.As(err, &pe) {
+		core.ReportPanic(ctx, pe, t.PanicReporter, t.Logger, "Consumer", "topic")
+	}
+	return err
+}
+
+// headerValues exposes message headers to a binding plan.
+type headerValues map[string]string
+
+func (h headerValues) Value(source, key string) string {
+	if source != "header" {
+		return ""
+	}
+	return h[key]
+}
+
+// payloadError is a message that could not be applied to the handler. It
+// is never retried.
+type payloadError struct {
+	err error
+}
+
+func (e *payloadError) Error() string   { return "payload binding failed: " + e.err.Error() }
+func (e *payloadError) Unwrap() error   { return e.err }
+func (e *payloadError) StatusCode() int { return 400 }
@@ -0,0 +1,278 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+// attempts records the deliveries handlers see.
+type attempts struct {
+	mu   sync.Mutex
+	seen []int
+}
+
+func (a *attempts) add(ctx context.Context) {
+	msg, _ := MessageFrom(ctx)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.seen = append(a.seen, msg.Attempt)
+}
+
+func (a *attempts) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.seen)
+}
+
+type chargeOrder struct {
+	Meta     core.Pattern `topic:"orders" group:"billing"`
+	OrderID  string       `json:"order_id" validate:"required"`
+	FailFor  int          `json:"fail_for"`
+	Mode     string       `json:"mode"`
+	Tenant   string       `header:"x-tenant"`
+	Attempts *attempts    `inject:"Attempts"`
+}
+
+func (h *chargeOrder) Handle(ctx context.Context) (any, error) {
+	h.Attempts.add(ctx)
+	msg, _ := MessageFrom(ctx)
+	switch {
+	case h.Mode == "panic":
+		panic("card reader on fire")
+	case h.Mode == "invalid":
+		return nil, core.NewProblem(409, "order already charged")
+	case h.Mode == "busy":
+		return nil, core.NewProblem(429, "slow down")
+	case h.Tenant != "acme":
+		return nil, errors.New("unknown tenant " + h.Tenant)
+	case msg.Attempt <= h.FailFor:
+		return nil, errors.New("payment gateway down")
+	}
+	return nil, nil
+}
+
+type shipOrder struct {
+	Meta     core.Pattern `topic:"shipments" dlq:"shipments.failed"`
+	Attempts *attempts    `inject:"Attempts"`
+}
+
+func (h *shipOrder) Handle(ctx context.Context) (any, error) {
+	h.Attempts.add(ctx)
+	return nil, errors.New("no courier")
+}
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	tests := []struct {
+		name         string
+		topic        string
+		body         string
+		headers      map[string]string
+		wantAttempts []int
+		wantDLQ      string // topic, empty when acknowledged
+		wantError    string
+	}{
+		{
+			name:         "success",
+			topic:        "orders",
+			body:         `{"order_id":"A-1"}`,
+			headers:      map[string]string{"x-tenant": "acme"},
+			wantAttempts: []int{1},
+		},
+		{
+			name:         "retried until success",
+			topic:        "orders",
+			body:         `{"order_id":"A-1","fail_for":2}`,
+			headers:      map[string]string{"x-tenant": "acme"},
+			wantAttempts: []int{1, 2, 3},
+		},
+		{
+			name:         "attempts exhausted",
+			topic:        "orders",
+			body:         `{"order_id":"A-1","fail_for":5}`,
+			headers:      map[string]string{"x-tenant": "acme"},
+			wantAttempts: []int{1, 2, 3},
+			wantDLQ:      "orders.dlq",
+			wantError:    "payment gateway down",
+		},
+		{
+			name:         "panics are retried",
+			topic:        "orders",
+			body:         `{"order_id":"A-1","mode":"panic"}`,
+			wantAttempts: []int{1, 2, 3},
+			wantDLQ:      "orders.dlq",
+			wantError:    "card reader on fire",
+		},
+		{
+			name:         "client errors are not retried",
+			topic:        "orders",
+			body:         `{"order_id":"A-1","mode":"invalid"}`,
+			headers:      map[string]string{"x-tenant": "acme"},
+			wantAttempts: []int{1},
+			wantDLQ:      "orders.dlq",
+			wantError:    "order already charged",
+		},
+		{
+			name:         "rate limits are retried",
+			topic:        "orders",
+			body:         `{"order_id":"A-1","mode":"busy"}`,
+			wantAttempts: []int{1, 2, 3},
+			wantDLQ:      "orders.dlq",
+			wantError:    "slow down",
+		},
+		{
+			name:      "validation errors are not retried",
+			topic:     "orders",
+			body:      `{}`,
+			wantDLQ:   "orders.dlq",
+			wantError: "validation failed",
+		},
+		{
+			name:      "invalid payloads are not retried",
+			topic:     "orders",
+			body:      `{"order_id":`,
+			wantDLQ:   "orders.dlq",
+			wantError: "payload binding failed",
+		},
+		{
+			name:         "dlq tag",
+			topic:        "shipments",
+			body:         `{}`,
+			wantAttempts: []int{1, 2, 3},
+			wantDLQ:      "shipments.failed",
+			wantError:    "no courier",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			b := NewMemoryBroker()
+			seen := &attempts{}
+			tr := New(
+				WithBroker(b),
+				WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}),
+				WithPanicReporter(func(context.Context, *core.PanicError) {}),
+			)
+			tr.Provide("Attempts", seen)
+			tr.Register(&chargeOrder{})
+			tr.Register(&shipOrder{})
+
+			dlqs := make(map[string]<-chan Delivery)
+			for _, topic := range []string{"orders.dlq", "shipments.failed"} {
+				deliveries, err := b.Subscribe(ctx, topic, "test")
+				if err != nil {
+					t.Fatalf("Subscribe: %v", err)
+				}
+				dlqs[topic] = deliveries
+			}
+
+			done := make(chan error)
+			go func() { done <- tr.Run(ctx) }()
+
+			msg := &Message{Topic: tt.topic, Body: []byte(tt.body), Headers: tt.headers}
+			if err := b.Publish(ctx, msg); err != nil {
+				t.Fatalf("Publish: %v", err)
+			}
+
+			if tt.wantDLQ != "" {
+				d := receive(t, dlqs[tt.wantDLQ])
+				dead := d.Message()
+				if string(dead.Body) != tt.body {
+					t.Fatalf("dead letter body %q, want %q", dead.Body, tt.body)
+				}
+				if !strings.Contains(dead.Headers[HeaderError], tt.wantError) {
+					t.Fatalf("%s = %q, want %q", HeaderError, dead.Headers[HeaderError], tt.wantError)
+				}
+				if got := dead.Headers[HeaderOriginalTopic]; got != tt.topic {
+					t.Fatalf("%s = %q, want %q", HeaderOriginalTopic, got, tt.topic)
+				}
+				wantAttempts := max(len(tt.wantAttempts), 1)
+				if got := dead.Headers[HeaderAttempts]; got != strconv.Itoa(wantAttempts) {
+					t.Fatalf("%s = %q, want %d", HeaderAttempts, got, wantAttempts)
+				}
+				for k, v := range tt.headers {
+					if dead.Headers[k] != v {
+						t.Fatalf("dead letter header %s = %q, want %q", k, dead.Headers[k], v)
+					}
+				}
+				d.Ack()
+			}
+
+			// Settled: acknowledged or dead-lettered
+			deadline := time.Now().Add(time.Second)
+			for b.Pending(tt.topic, groupOf(tt.topic)) > 0 || seen.count() < len(tt.wantAttempts) {
+				if time.Now().After(deadline) {
+					t.Fatalf("message not settled: pending %d, attempts %v", b.Pending(tt.topic, groupOf(tt.topic)), seen.seen)
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			seen.mu.Lock()
+			defer seen.mu.Unlock()
+			if !slices.Equal(seen.seen, tt.wantAttempts) {
+				t.Fatalf("handled attempts %v, want %v", seen.seen, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func groupOf(topic string) string {
+	if topic == "orders" {
+		return "billing"
+	}
+	return topic
+}
+
+func TestRegisterPanics(t *testing.T) {
+	type noTopic struct {
+		Meta core.Pattern `group:"billing"`
+		chargeOrder
+	}
+	type badConcurrency struct {
+		Meta core.Pattern `topic:"orders" concurrency:"0"`
+		chargeOrder
+	}
+
+	tests := []struct {
+		name      string
+		register  func(tr *Transport)
+		wantPanic string
+	}{
+		{name: "no topic", register: func(tr *Transport) { tr.Register(&noTopic{}) }, wantPanic: "missing Pattern with topic tag"},
+		{name: "invalid concurrency", register: func(tr *Transport) { tr.Register(&badConcurrency{}) }, wantPanic: `invalid concurrency "0"`},
+		{
+			name: "same topic and group",
+			register: func(tr *Transport) {
+				tr.Register(&chargeOrder{})
+				tr.Register(&chargeOrder{})
+			},
+			wantPanic: `topic "orders" already has a consumer in group "billing"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				msg, _ := recover().(string)
+				if !strings.Contains(msg, tt.wantPanic) {
+					t.Fatalf("Register panic %q, want %q", msg, tt.wantPanic)
+				}
+			}()
+			tt.register(New())
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // DST cases need America/New_York everywhere
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr string
+	}{
+		{spec: "", wantErr: "expected 5 fields"},
+		{spec: "* * * *", wantErr: "expected 5 fields"},
+		{spec: "* * * * * *", wantErr: "expected 5 fields"},
+		{spec: "60 * * * *", wantErr: "minute"},
+		{spec: "* 24 * * *", wantErr: "hour"},
+		{spec: "* * 0 * *", wantErr: "day of month"},
+		{spec: "* * * 13 *", wantErr: "month"},
+		{spec: "* * * * 8", wantErr: "day of week"},
+		{spec: "*/0 * * * *", wantErr: "invalid step"},
+		{spec: "*/x * * * *", wantErr: "invalid step"},
+		{spec: "30-10 * * * *", wantErr: "out of range"},
+		{spec: "a * * * *", wantErr: "invalid value"},
+		{spec: "* * * foo *", wantErr: "invalid value"},
+		{spec: "@every", wantErr: "expected 5 fields"},
+		{spec: "@every x", wantErr: "invalid duration"},
+		{spec: "@every -1m", wantErr: "invalid duration"},
+		{spec: "@often", wantErr: "expected 5 fields"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := Parse(tt.spec)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Parse error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04:05", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	local := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04:05", s, ny)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{name: "every minute", spec: "* * * * *", from: utc("2024-01-01 00:00:30"), want: utc("2024-01-01 00:01:00")},
+		{name: "strictly after", spec: "* * * * *", from: utc("2024-01-01 00:01:00"), want: utc("2024-01-01 00:02:00")},
+		{name: "step", spec: "*/15 * * * *", from: utc("2024-01-01 10:07:00"), want: utc("2024-01-01 10:15:00")},
+		{name: "step from value", spec: "5/20 * * * *", from: utc("2024-01-01 00:06:00"), want: utc("2024-01-01 00:25:00")},
+		{name: "range with step", spec: "0-30/10 * * * *", from: utc("2024-01-01 00:31:00"), want: utc("2024-01-01 01:00:00")},
+		{name: "next day", spec: "30 2 * * *", from: utc("2024-01-01 03:00:00"), want: utc("2024-01-02 02:30:00")},
+		{name: "hour range", spec: "0 9-17 * * *", from: utc("2024-01-01 17:01:00"), want: utc("2024-01-02 09:00:00")},
+		{name: "weekday names", spec: "0 9 * * mon-fri", from: utc("2024-01-06 00:00:00"), want: utc("2024-01-08 09:00:00")},
+		{name: "sunday as 7", spec: "0 0 * * 7", from: utc("2024-01-01 00:00:00"), want: utc("2024-01-07 00:00:00")},
+		{name: "list", spec: "0 0 1,15 * *", from: utc("2024-01-02 00:00:00"), want: utc("2024-01-15 00:00:00")},
+		{name: "month name", spec: "0 0 1 JUN *", from: utc("2024-01-01 00:00:00"), want: utc("2024-06-01 00:00:00")},
+		{name: "day of month or week", spec: "0 0 13 * fri", from: utc("2024-01-01 00:00:00"), want: utc("2024-01-05 00:00:00")},
+		{name: "leap day", spec: "0 0 29 2 *", from: utc("2024-03-01 00:00:00"), want: utc("2028-02-29 00:00:00")},
+		{name: "impossible date", spec: "0 0 30 2 *", from: utc("2024-01-01 00:00:00")},
+		{name: "yearly", spec: "@yearly", from: utc("2024-03-01 00:00:00"), want: utc("2025-01-01 00:00:00")},
+		{name: "hourly", spec: "@hourly", from: utc("2024-01-01 10:00:00"), want: utc("2024-01-01 11:00:00")},
+		{name: "weekly", spec: "@weekly", from: utc("2024-01-01 00:00:00"), want: utc("2024-01-07 00:00:00")},
+		{name: "every duration", spec: "@every 90s", from: utc("2024-01-01 00:00:10"), want: utc("2024-01-01 00:01:40")},
+		{name: "location", spec: "0 9 * * *", from: local("2024-01-01 10:00:00"), want: local("2024-01-02 09:00:00")},
+		{name: "DST gap is skipped", spec: "30 2 * * *", from: local("2024-03-10 00:00:00"), want: local("2024-03-11 02:30:00")},
+		{name: "DST gap hourly", spec: "0 * * * *", from: local("2024-03-10 01:30:00"), want: local("2024-03-10 03:00:00")},
+		{
+			name: "DST repeat runs first",
+			spec: "30 1 * * *",
+			from: local("2024-11-03 00:00:00"),
+			want: time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC).In(ny), // 01:30 EDT
+		},
+		{
+			name: "DST repeat runs twice",
+			spec: "30 1 * * *",
+			from: time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC).In(ny),
+			want: time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC).In(ny), // 01:30 EST
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			got := s.Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Fatalf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+			if !got.IsZero() && got.Location() != tt.from.Location() {
+				t.Fatalf("Next returned location %s, want %s", got.Location(), tt.from.Location())
+			}
+		})
+	}
+}
@@ -0,0 +1,454 @@
+// Package schedule runs handlers as scheduled jobs.
+//
+//	type Cleanup struct {
+//		Meta  core.Pattern `cron:"*/5 * * * *" jitter:"30s"`
+//		Store *Store       `inject:"Store"`
+//	}
+//
+//	t := schedule.New()
+//	t.Provide("Store", store)
+//	t.Register(&Cleanup{})
+//	t.Run(ctx)
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+	"github.com/mirkobrombin/go-module-router/v2/pkg/logger"
+)
+
+// Overlap decides what happens when a job is due while it is still running.
+type Overlap string
+
+const (
+	// OverlapSkip drops the new run.
+	OverlapSkip Overlap = "skip"
+	// OverlapQueue starts the new run once the running one finishes.
+	OverlapQueue Overlap = "queue"
+	// OverlapAllow starts the new run right away, alongside the other.
+	OverlapAllow Overlap = "allow"
+)
+
+// Transport handles scheduled jobs.
+type Transport struct {
+	core.Provider
+	Logger   logger.Logger
+	clock    Clock
+	location *time.Location
+	overlap  Overlap
+	timeout  time.Duration
+	jobs     []*job
+	mu       sync.Mutex
+	runs     sync.WaitGroup
+	started  bool
+
+	// PanicReporter receives panics recovered from jobs. When nil, they
+	// are logged with their stack.
+	PanicReporter core.PanicReporter
+}
+
+// job is a registered handler and its state.
+type job struct {
+	name      string
+	spec      string
+	schedule  Schedule
+	jitter    time.Duration
+	overlap   Overlap
+	timeout   time.Duration
+	prototype reflect.Value
+
+	timer   Timer
+	next    time.Time
+	running int
+	queued  int
+	runs    int
+	skipped int
+	last    time.Time
+	lastDur time.Duration
+	lastErr error
+}
+
+// Job describes the state of a registered job.
+type Job struct {
+	Name string
+	// Spec is the cron expression.
+	Spec string
+	// NextRun is when the job runs next, jitter included. It is zero
+	// before Run and once the schedule has no more runs.
+	NextRun time.Time
+	// LastRun is when the last run started, and LastDuration and
+	// LastError how it ended. They are zero while the first run is in
+	// progress.
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    error
+	// Running and Queued count the runs in progress and those waiting
+	// for them under OverlapQueue.
+	Running int
+	Queued  int
+	// Runs counts the finished runs, Skipped the ones dropped under
+	// OverlapSkip.
+	Runs    int
+	Skipped int
+}
+
+type Option func(*Transport)
+
+// WithClock sets the clock jobs are scheduled with, RealClock by default.
+func WithClock(c Clock) Option {
+	return func(t *Transport) { t.clock = c }
+}
+
+// WithLocation sets the time zone cron expressions are evaluated in,
+// time.Local by default.
+func WithLocation(loc *time.Location) Option {
+	return func(t *Transport) { t.location = loc }
+}
+
+// WithOverlap sets the overlap policy of jobs without an overlap tag,
+// OverlapSkip by default.
+func WithOverlap(o Overlap) Option {
+	return func(t *Transport) { t.overlap = o }
+}
+
+// WithTimeout sets the run timeout of jobs without a timeout tag. The
+// default is no timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(t *Transport) { t.timeout = d }
+}
+
+// WithPanicReporter sets the callback that receives recovered panics.
+func WithPanicReporter(r core.PanicReporter) Option {
+	return func(t *Transport) { t.PanicReporter = r }
+}
+
+// WithContainer sets the dependency container, e.g. to share one with
+// other transports.
+func WithContainer(c *core.Container) Option {
+	return func(t *Transport) { t.Provider = core.NewProvider(c) }
+}
+
+// New creates a new schedule transport.
+func New(opts ...Option) *Transport {
+	t := &Transport{
+		Provider: core.NewProvider(core.NewContainer()),
+		Logger:   logger.Nop,
+		clock:    RealClock,
+		location: time.Local,
+		overlap:  OverlapSkip,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Register adds a job.
+// Reads the `cron:"*/5 * * * *"` tag from the Pattern field, and optionally
+// `jitter:"30s"` (a random delay added to each run), `overlap:"queue"`,
+// `timeout:"2m"` and `job:"cleanup"`. The job name defaults to the struct
+// name.
+func (t *Transport) Register(prototype core.Handler) {
+	val := reflect.ValueOf(prototype)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		panic("Transport.Register: prototype must be a pointer to a struct")
+	}
+
+	elemType := val.Elem().Type()
+
+	j := &job{
+		name:      elemType.Name(),
+		overlap:   t.overlap,
+		timeout:   t.timeout,
+		prototype: val,
+	}
+	for i := 0; i < elemType.NumField(); i++ {
+		field := elemType.Field(i)
+		if field.Type != reflect.TypeOf(core.Pattern{}) {
+			continue
+		}
+		j.spec = field.Tag.Get("cron")
+		if name := field.Tag.Get("job"); name != "" {
+			j.name = name
+		}
+		if o := field.Tag.Get("overlap"); o != "" {
+			j.overlap = Overlap(o)
+		}
+		var err error
+		if d := field.Tag.Get("jitter"); d != "" {
+			if j.jitter, err = time.ParseDuration(d); err != nil || j.jitter < 0 {
+				panic(fmt.Sprintf("Transport.Register: struct %s has invalid jitter %q", elemType.Name(), d))
+			}
+		}
+		if d := field.Tag.Get("timeout"); d != "" {
+			if j.timeout, err = time.ParseDuration(d); err != nil || j.timeout <= 0 {
+				panic(fmt.Sprintf("Transport.Register: struct %s has invalid timeout %q", elemType.Name(), d))
+			}
+		}
+		break
+	}
+
+	if j.spec == "" {
+		panic(fmt.Sprintf("Transport.Register: struct %s missing Pattern with cron tag", elemType.Name()))
+	}
+	sched, err := Parse(j.spec)
+	if err != nil {
+		panic(fmt.Sprintf("Transport.Register: struct %s: %v", elemType.Name(), err))
+	}
+	j.schedule = sched
+	switch j.overlap {
+	case OverlapSkip, OverlapQueue, OverlapAllow:
+	default:
+		panic(fmt.Sprintf("Transport.Register: struct %s has invalid overlap %q", elemType.Name(), j.overlap))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.started {
+		panic("Transport.Register: called after Run")
+	}
+	for _, other := range t.jobs {
+		if other.name == j.name {
+			panic(fmt.Sprintf("Transport.Register: job %q already registered", j.name))
+		}
+	}
+	t.jobs = append(t.jobs, j)
+	t.Logger.Info("Registered job", "job", j.name, "cron", j.spec)
+}
+
+// Jobs returns the state of every job, in registration order.
+func (t *Transport) Jobs() []Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	jobs := make([]Job, len(t.jobs))
+	for i, j := range t.jobs {
+		jobs[i] = j.status()
+	}
+	return jobs
+}
+
+// Job returns the state of the named job.
+func (t *Transport) Job(name string) (Job, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, j := range t.jobs {
+		if j.name == name {
+			return j.status(), true
+		}
+	}
+	return Job{}, false
+}
+
+func (j *job) status() Job {
+	return Job{
+		Name:         j.name,
+		Spec:         j.spec,
+		NextRun:      j.next,
+		LastRun:      j.last,
+		LastDuration: j.lastDur,
+		LastError:    j.lastErr,
+		Running:      j.running,
+		Queued:       j.queued,
+		Runs:         j.runs,
+		Skipped:      j.skipped,
+	}
+}
+
+// Start schedules every job and returns. Jobs stop being scheduled when
+// ctx is cancelled; runs in progress are not cancelled, see Wait. Factory
+// dependencies are built first; if any fails, Start returns the errors
+// without scheduling.
+func (t *Transport) Start(ctx context.Context) error {
+	if err := t.Container().Build(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.started {
+		return errors.New("schedule: already started")
+	}
+	t.started = true
+
+	now := t.clock.Now()
+	for _, j := range t.jobs {
+		t.plan(ctx, j, now)
+	}
+
+	context.AfterFunc(ctx, t.stop)
+	return nil
+}
+
+// stop disarms the timers of every job.
+func (t *Transport) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, j := range t.jobs {
+		if j.timer != nil {
+			j.timer.Stop()
+		}
+		j.timer, j.next = nil, time.Time{}
+	}
+}
+
+// Wait blocks until no run is in progress or queued.
+func (t *Transport) Wait() {
+	t.runs.Wait()
+}
+
+// Run schedules every job and runs them until ctx is cancelled. It then
+// waits for the runs in progress and returns nil.
+func (t *Transport) Run(ctx context.Context) error {
+	if err := t.Start(ctx); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	// No run starts once the timers are disarmed
+	t.stop()
+	t.Wait()
+	return nil
+}
+
+// plan arms the timer of the first run of j after base. The caller holds
+// t.mu.
+func (t *Transport) plan(ctx context.Context, j *job, base time.Time) {
+	j.timer, j.next = nil, time.Time{}
+	if ctx.Err() != nil {
+		return
+	}
+
+	due := j.schedule.Next(base.In(t.location))
+	if due.IsZero() {
+		t.Logger.Warn("Job has no more runs", "job", j.name, "cron", j.spec)
+		return
+	}
+	at := due
+	if j.jitter > 0 {
+		at = at.Add(rand.N(j.jitter))
+	}
+
+	j.next = at
+	j.timer = t.clock.AfterFunc(at.Sub(t.clock.Now()), func() {
+		t.mu.Lock()
+		if j.next != at {
+			// Stopped while firing
+			t.mu.Unlock()
+			return
+		}
+		// Runs missed while the process was suspended are dropped. Once
+		// ctx is cancelled, plan disarms the job even if stop has not
+		// run yet, and no run starts
+		t.plan(ctx, j, latest(due, t.clock.Now()))
+		if ctx.Err() == nil {
+			t.launch(ctx, j)
+		}
+		t.mu.Unlock()
+	})
+}
+
+// launch starts a run of j according to its overlap policy. The caller
+// holds t.mu.
+func (t *Transport) launch(ctx context.Context, j *job) {
+	if j.running > 0 {
+		switch j.overlap {
+		case OverlapSkip:
+			j.skipped++
+			t.Logger.Warn("Job still running, run skipped", "job", j.name)
+			return
+		case OverlapQueue:
+			j.queued++
+			return
+		}
+	}
+	t.start(ctx, j)
+}
+
+// start runs j in a new goroutine. The run starts, and its timeout
+// begins, at the current time of the clock. The caller holds t.mu.
+func (t *Transport) start(ctx context.Context, j *job) {
+	j.running++
+	t.runs.Add(1)
+
+	// Runs outlive the transport's context so they are not cut short
+	// on shutdown; only their own timeout ends them
+	runCtx, stop := context.WithoutCancel(ctx), func() {}
+	if j.timeout > 0 {
+		runCtx, stop = withDeadline(runCtx, t.clock, j.timeout)
+	}
+	started := t.clock.Now()
+
+	go func() {
+		defer t.runs.Done()
+		err := t.run(runCtx, j)
+		stop()
+		dur := t.clock.Now().Sub(started)
+
+		t.mu.Lock()
+		j.running--
+		j.runs++
+		j.last, j.lastDur, j.lastErr = started, dur, err
+		switch {
+		case j.queued > 0 && ctx.Err() != nil:
+			// Like timers, queued runs do not start after shutdown
+			t.Logger.Warn("Transport stopped, queued runs dropped", "job", j.name, "queued", j.queued)
+			j.queued = 0
+		case j.queued > 0:
+			j.queued--
+			t.start(ctx, j)
+		}
+		t.mu.Unlock()
+
+		if err != nil {
+			t.Logger.Error("Job failed", "job", j.name, "duration", dur, "error", err)
+			return
+		}
+		t.Logger.Info("Job finished", "job", j.name, "duration", dur)
+	}()
+}
+
+// run runs j once. A run that outlives its timeout fails with
+// context.DeadlineExceeded even if the handler returns nil.
+func (t *Transport) run(ctx context.Context, j *job) error {
+	// Create new instance
+	newVal := reflect.New(j.prototype.Elem().Type()).Elem()
+	newVal.Set(j.prototype.Elem())
+
+	// Inject dependencies, scoped ones live for this run
+	instance := newVal.Addr().Interface()
+	scope := t.Container().NewScope(ctx)
+	defer scope.Close(core.ErrScopeAborted)
+	if err := scope.Inject(instance); err != nil {
+		return err
+	}
+
+	t.Logger.Debug("Job started", "job", j.name)
+	_, err := core.SafeHandle(ctx, instance.(core.Handler), j.name)
+	var pe *core.PanicError
+	if errors.As(err, &pe) {
+		core.ReportPanic(ctx, pe, t.PanicReporter, t.Logger, "Job", "job")
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	core.CloseScope(scope, &err, t.Logger)
+	return err
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
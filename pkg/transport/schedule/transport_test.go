@@ -0,0 +1,403 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// probe lets tests hold runs and see how they ended.
+type probe struct {
+	mu      sync.Mutex
+	started int
+	release chan struct{}
+	ctxErrs []error
+}
+
+func newProbe() *probe {
+	return &probe{release: make(chan struct{})}
+}
+
+// run records a start, then blocks until released or the context ends.
+func (p *probe) run(ctx context.Context) {
+	p.mu.Lock()
+	p.started++
+	p.mu.Unlock()
+
+	select {
+	case <-p.release:
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.ctxErrs = append(p.ctxErrs, ctx.Err())
+		p.mu.Unlock()
+	}
+}
+
+func (p *probe) starts() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.started
+}
+
+type everyMinute struct {
+	Meta  core.Pattern `cron:"* * * * *"`
+	Probe *probe       `inject:"Probe"`
+}
+
+func (h *everyMinute) Handle(ctx context.Context) (any, error) {
+	h.Probe.run(ctx)
+	return nil, nil
+}
+
+type queued struct {
+	Meta  core.Pattern `cron:"* * * * *" overlap:"queue"`
+	Probe *probe       `inject:"Probe"`
+}
+
+func (h *queued) Handle(ctx context.Context) (any, error) {
+	h.Probe.run(ctx)
+	return nil, nil
+}
+
+type timed struct {
+	Meta  core.Pattern `cron:"* * * * *" timeout:"30s"`
+	Probe *probe       `inject:"Probe"`
+}
+
+func (h *timed) Handle(ctx context.Context) (any, error) {
+	h.Probe.run(ctx)
+	return nil, nil
+}
+
+type cleanup struct {
+	Meta core.Pattern `cron:"*/5 * * * *" job:"cleanup"`
+	Fail bool
+}
+
+func (h *cleanup) Handle(ctx context.Context) (any, error) {
+	if h.Fail {
+		return nil, errors.New("store down")
+	}
+	return nil, nil
+}
+
+type jittered struct {
+	Meta core.Pattern `cron:"0 * * * *" jitter:"30s"`
+}
+
+func (h *jittered) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+type panicky struct {
+	Meta core.Pattern `cron:"* * * * *"`
+}
+
+func (h *panicky) Handle(ctx context.Context) (any, error) { panic("job broke") }
+
+// newTestTransport returns a started transport driven by a fake clock at
+// epoch, with the probe provided as "Probe".
+func newTestTransport(t *testing.T, p *probe, handler core.Handler, opts ...Option) (*Transport, *FakeClock) {
+	t.Helper()
+	clock := NewFakeClock(epoch)
+	tr := New(append([]Option{WithClock(clock), WithLocation(time.UTC)}, opts...)...)
+	tr.Provide("Probe", p)
+	tr.Register(handler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		tr.Wait()
+	})
+	if err := tr.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return tr, clock
+}
+
+func TestSchedule(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     core.Handler
+		advance     time.Duration
+		wantRuns    int
+		wantLastRun time.Time
+		wantNextRun time.Time
+		wantErr     string
+	}{
+		{
+			name:        "before the first run",
+			handler:     &cleanup{},
+			advance:     4 * time.Minute,
+			wantNextRun: epoch.Add(5 * time.Minute),
+		},
+		{
+			name:        "runs when due",
+			handler:     &cleanup{},
+			advance:     11 * time.Minute,
+			wantRuns:    2,
+			wantLastRun: epoch.Add(10 * time.Minute),
+			wantNextRun: epoch.Add(15 * time.Minute),
+		},
+		{
+			name:        "failed runs keep their error",
+			handler:     &cleanup{Fail: true},
+			advance:     5 * time.Minute,
+			wantRuns:    1,
+			wantLastRun: epoch.Add(5 * time.Minute),
+			wantNextRun: epoch.Add(10 * time.Minute),
+			wantErr:     "store down",
+		},
+		{
+			name:        "panics fail the run",
+			handler:     &panicky{},
+			advance:     time.Minute,
+			wantRuns:    1,
+			wantLastRun: epoch.Add(time.Minute),
+			wantNextRun: epoch.Add(2 * time.Minute),
+			wantErr:     "job broke",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, clock := newTestTransport(t, newProbe(), tt.handler, WithPanicReporter(func(context.Context, *core.PanicError) {}))
+			// A minute at a time, so each run ends before the next is due
+			for range tt.advance / time.Minute {
+				clock.Advance(time.Minute)
+				tr.Wait()
+			}
+
+			jobs := tr.Jobs()
+			if len(jobs) != 1 {
+				t.Fatalf("%d jobs, want 1", len(jobs))
+			}
+			j := jobs[0]
+			if j.Runs != tt.wantRuns || !j.LastRun.Equal(tt.wantLastRun) || !j.NextRun.Equal(tt.wantNextRun) {
+				t.Fatalf("runs=%d last=%s next=%s, want runs=%d last=%s next=%s",
+					j.Runs, j.LastRun, j.NextRun, tt.wantRuns, tt.wantLastRun, tt.wantNextRun)
+			}
+			if tt.wantErr == "" && j.LastError != nil || tt.wantErr != "" && (j.LastError == nil || !strings.Contains(j.LastError.Error(), tt.wantErr)) {
+				t.Fatalf("last error %v, want %q", j.LastError, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler core.Handler
+		opts    []Option
+		// state while the first run is held and a second one is due
+		wantRunning, wantQueued, wantSkipped int
+		// finished runs once released
+		wantRuns int
+	}{
+		{name: "skip by default", handler: &everyMinute{}, wantRunning: 1, wantSkipped: 1, wantRuns: 1},
+		{name: "queue tag", handler: &queued{}, wantRunning: 1, wantQueued: 1, wantRuns: 2},
+		{name: "queue option", handler: &everyMinute{}, opts: []Option{WithOverlap(OverlapQueue)}, wantRunning: 1, wantQueued: 1, wantRuns: 2},
+		{name: "allow option", handler: &everyMinute{}, opts: []Option{WithOverlap(OverlapAllow)}, wantRunning: 2, wantRuns: 2},
+		{name: "tag beats option", handler: &queued{}, opts: []Option{WithOverlap(OverlapAllow)}, wantRunning: 1, wantQueued: 1, wantRuns: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProbe()
+			tr, clock := newTestTransport(t, p, tt.handler, tt.opts...)
+
+			clock.Advance(time.Minute)
+			clock.Advance(time.Minute)
+			j := tr.Jobs()[0]
+			if j.Running != tt.wantRunning || j.Queued != tt.wantQueued || j.Skipped != tt.wantSkipped {
+				t.Fatalf("running=%d queued=%d skipped=%d, want %d %d %d",
+					j.Running, j.Queued, j.Skipped, tt.wantRunning, tt.wantQueued, tt.wantSkipped)
+			}
+
+			close(p.release)
+			tr.Wait()
+			j = tr.Jobs()[0]
+			if j.Runs != tt.wantRuns || j.Running != 0 || j.Queued != 0 {
+				t.Fatalf("runs=%d running=%d queued=%d after release, want %d runs", j.Runs, j.Running, j.Queued, tt.wantRuns)
+			}
+			if n := p.starts(); n != tt.wantRuns {
+				t.Fatalf("handler started %d times, want %d", n, tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		handler      core.Handler
+		opts         []Option
+		advance      time.Duration
+		wantTimedOut bool
+	}{
+		{name: "tag", handler: &timed{}, advance: 30 * time.Second, wantTimedOut: true},
+		{name: "option", handler: &everyMinute{}, opts: []Option{WithTimeout(10 * time.Second)}, advance: 10 * time.Second, wantTimedOut: true},
+		{name: "tag beats option", handler: &timed{}, opts: []Option{WithTimeout(10 * time.Second)}, advance: 10 * time.Second},
+		{name: "no timeout by default", handler: &everyMinute{}, advance: 50 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProbe()
+			tr, clock := newTestTransport(t, p, tt.handler, tt.opts...)
+
+			clock.Advance(time.Minute) // starts the run
+			clock.Advance(tt.advance)
+			if !tt.wantTimedOut {
+				close(p.release)
+			}
+			tr.Wait()
+
+			j := tr.Jobs()[0]
+			if got := errors.Is(j.LastError, context.DeadlineExceeded); got != tt.wantTimedOut {
+				t.Fatalf("last error %v, want timed out %v", j.LastError, tt.wantTimedOut)
+			}
+			if tt.wantTimedOut && j.LastDuration != tt.advance {
+				t.Fatalf("last duration %s, want %s", j.LastDuration, tt.advance)
+			}
+			if tt.wantTimedOut && (len(p.ctxErrs) != 1 || p.ctxErrs[0] != context.DeadlineExceeded) {
+				t.Fatalf("handler saw %v, want its context to end with DeadlineExceeded", p.ctxErrs)
+			}
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for range 20 {
+		tr, clock := newTestTransport(t, newProbe(), &jittered{})
+		due := epoch.Add(time.Hour)
+
+		next := tr.Jobs()[0].NextRun
+		if next.Before(due) || !next.Before(due.Add(30*time.Second)) {
+			t.Fatalf("next run %s, want within 30s after %s", next, due)
+		}
+
+		clock.Advance(next.Sub(epoch))
+		tr.Wait()
+		if j := tr.Jobs()[0]; j.Runs != 1 || !j.LastRun.Equal(next) {
+			t.Fatalf("runs=%d last=%s, want one run at %s", j.Runs, j.LastRun, next)
+		}
+	}
+}
+
+func TestStopOnCancel(t *testing.T) {
+	clock := NewFakeClock(epoch)
+	tr := New(WithClock(clock), WithLocation(time.UTC))
+	tr.Register(&cleanup{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := tr.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := tr.Start(ctx); err == nil {
+		t.Fatal("second Start succeeded")
+	}
+	cancel()
+
+	clock.Advance(time.Hour)
+	tr.Wait()
+	j, ok := tr.Job("cleanup")
+	if !ok {
+		t.Fatal("job cleanup not found")
+	}
+	if j.Runs != 0 || !j.NextRun.IsZero() {
+		t.Fatalf("runs=%d next=%s after cancel, want no runs", j.Runs, j.NextRun)
+	}
+	if _, ok := tr.Job("missing"); ok {
+		t.Fatal("found a job that was never registered")
+	}
+}
+
+func TestDropQueuedOnCancel(t *testing.T) {
+	p := newProbe()
+	clock := NewFakeClock(epoch)
+	tr := New(WithClock(clock), WithLocation(time.UTC))
+	tr.Provide("Probe", p)
+	tr.Register(&queued{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := tr.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	clock.Advance(time.Minute)
+	clock.Advance(time.Minute)
+	if j := tr.Jobs()[0]; j.Running != 1 || j.Queued != 1 {
+		t.Fatalf("running=%d queued=%d, want one of each", j.Running, j.Queued)
+	}
+
+	// The run in progress finishes, the queued one never starts
+	cancel()
+	close(p.release)
+	tr.Wait()
+	if j := tr.Jobs()[0]; j.Runs != 1 || j.Queued != 0 {
+		t.Fatalf("runs=%d queued=%d after cancel, want 1 run and none queued", j.Runs, j.Queued)
+	}
+	if n := p.starts(); n != 1 {
+		t.Fatalf("handler started %d times, want 1", n)
+	}
+}
+
+type (
+	noCron struct {
+		Meta core.Pattern `job:"x"`
+	}
+	badCron struct {
+		Meta core.Pattern `cron:"* * *"`
+	}
+	badJitter struct {
+		Meta core.Pattern `cron:"* * * * *" jitter:"-1s"`
+	}
+	badTimeout struct {
+		Meta core.Pattern `cron:"* * * * *" timeout:"0s"`
+	}
+	badOverlap struct {
+		Meta core.Pattern `cron:"* * * * *" overlap:"sometimes"`
+	}
+)
+
+func (h *noCron) Handle(ctx context.Context) (any, error)     { return nil, nil }
+func (h *badCron) Handle(ctx context.Context) (any, error)    { return nil, nil }
+func (h *badJitter) Handle(ctx context.Context) (any, error)  { return nil, nil }
+func (h *badTimeout) Handle(ctx context.Context) (any, error) { return nil, nil }
+func (h *badOverlap) Handle(ctx context.Context) (any, error) { return nil, nil }
+
+func TestRegisterPanics(t *testing.T) {
+	tests := []struct {
+		name      string
+		register  func(*Transport)
+		wantPanic string
+	}{
+		{name: "missing cron", register: func(t *Transport) { t.Register(&noCron{}) }, wantPanic: "missing Pattern with cron tag"},
+		{name: "invalid cron", register: func(t *Transport) { t.Register(&badCron{}) }, wantPanic: "expected 5 fields"},
+		{name: "invalid jitter", register: func(t *Transport) { t.Register(&badJitter{}) }, wantPanic: "invalid jitter"},
+		{name: "invalid timeout", register: func(t *Transport) { t.Register(&badTimeout{}) }, wantPanic: "invalid timeout"},
+		{name: "invalid overlap", register: func(t *Transport) { t.Register(&badOverlap{}) }, wantPanic: "invalid overlap"},
+		{name: "duplicate name", register: func(t *Transport) { t.Register(&cleanup{}); t.Register(&cleanup{}) }, wantPanic: "already registered"},
+		{name: "after start", register: func(t *Transport) {
+			t.Start(context.Background())
+			t.Register(&cleanup{})
+		}, wantPanic: "called after Run"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				msg, _ := recover().(string)
+				if !strings.Contains(msg, tt.wantPanic) {
+					t.Fatalf("panic %q, want %q", msg, tt.wantPanic)
+				}
+			}()
+			tt.register(New(WithClock(NewFakeClock(epoch))))
+		})
+	}
+}
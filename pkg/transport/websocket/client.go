@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Client exchanges Message envelopes with a WS endpoint. It is meant for
+// tests and tools; it is not safe for concurrent use.
+//
+//	c, err := websocket.DialClient(ctx, "ws://localhost:8080/ws/room/42", nil)
+//	reply, err := c.Call("chat.send", map[string]string{"text": "hi"})
+type Client struct {
+	conn    *Conn
+	nextID  int
+	pending []*Message
+}
+
+// DialClient connects to a WS endpoint.
+func DialClient(ctx context.Context, url string, header http.Header) (*Client, error) {
+	conn, err := Dial(ctx, url, header)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Conn returns the underlying connection.
+func (c *Client) Conn() *Conn {
+	return c.conn
+}
+
+// Send sends a message; data is encoded as JSON.
+func (c *Client) Send(typ, id string, data any) error {
+	msg := Message{Type: typ, ID: id}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		msg.Data = raw
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(TextMessage, b)
+}
+
+// Receive returns the next message, including those skipped by Call.
+func (c *Client) Receive() (*Message, error) {
+	if len(c.pending) > 0 {
+		msg := c.pending[0]
+		c.pending = c.pending[1:]
+		return msg, nil
+	}
+	return c.read()
+}
+
+// Call sends a message with a fresh ID and waits for the reply carrying
+// it, a TypeResult or TypeError message. Other messages received in the
+// meantime are kept for Receive.
+func (c *Client) Call(typ string, data any) (*Message, error) {
+	c.nextID++
+	id := strconv.Itoa(c.nextID)
+	if err := c.Send(typ, id, data); err != nil {
+		return nil, err
+	}
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if msg.ID == id {
+			return msg, nil
+		}
+		c.pending = append(c.pending, msg)
+	}
+}
+
+// Close closes the connection normally.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) read() (*Message, error) {
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
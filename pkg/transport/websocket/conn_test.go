@@ -0,0 +1,402 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// frame encodes a frame as a client (masked) or server would send it.
+func frame(fin bool, op int, payload []byte, masked bool) []byte {
+	b := []byte{byte(op)}
+	if fin {
+		b[0] |= 0x80
+	}
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		b = append(b, maskBit|byte(n))
+	case n <= 0xffff:
+		b = append(b, maskBit|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, maskBit|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	if masked {
+		key := [4]byte{0x37, 0xfa, 0x21, 0x3d}
+		b = append(b, key[:]...)
+		start := len(b)
+		b = append(b, payload...)
+		maskBytes(key, b[start:])
+		return b
+	}
+	return append(b, payload...)
+}
+
+func closePayload(code int, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+// sentFrame is a frame written by the Conn under test.
+type sentFrame struct {
+	op      int
+	payload []byte
+}
+
+// serve feeds input to a server Conn and collects the frames it writes.
+// The Conn is returned with a function that closes it and returns them.
+func serve(t *testing.T, input []byte) (*Conn, func() []sentFrame) {
+	t.Helper()
+	server, peer := net.Pipe()
+	c := newConn(server, nil, false)
+
+	go func() {
+		peer.Write(input)
+	}()
+	out := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(peer)
+		out <- b
+	}()
+
+	return c, func() []sentFrame {
+		server.Close()
+		return parseFrames(t, <-out, false)
+	}
+}
+
+// parseFrames decodes frames written by a client (masked) or a server.
+func parseFrames(t *testing.T, b []byte, masked bool) []sentFrame {
+	t.Helper()
+	r := &Conn{br: bufio.NewReader(bytes.NewReader(b)), client: !masked, readLimit: DefaultReadLimit}
+	var frames []sentFrame
+	for {
+		fin, op, payload, err := r.readFrame()
+		if errors.Is(err, io.EOF) {
+			return frames
+		}
+		if err != nil || !fin {
+			t.Fatalf("invalid frame written: fin=%v err=%v", fin, err)
+		}
+		frames = append(frames, sentFrame{op, payload})
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	long := strings.Repeat("x", 70000)
+	invalidUTF8 := []byte{0xff, 0xfe}
+
+	tests := []struct {
+		name      string
+		input     [][]byte
+		readLimit int64
+		wantOp    int
+		want      string
+		wantErr   error
+		wantClose int // code of the close frame sent, 0 for none
+		wantPong  string
+	}{
+		{
+			name:   "masked text (RFC 6455 5.7)",
+			input:  [][]byte{{0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58}},
+			wantOp: TextMessage,
+			want:   "Hello",
+		},
+		{
+			name:   "binary",
+			input:  [][]byte{frame(true, BinaryMessage, invalidUTF8, true)},
+			wantOp: BinaryMessage,
+			want:   string(invalidUTF8),
+		},
+		{
+			name:   "empty text",
+			input:  [][]byte{frame(true, TextMessage, nil, true)},
+			wantOp: TextMessage,
+		},
+		{
+			name:   "16-bit length",
+			input:  [][]byte{frame(true, TextMessage, []byte(long[:300]), true)},
+			wantOp: TextMessage,
+			want:   long[:300],
+		},
+		{
+			name:   "64-bit length",
+			input:  [][]byte{frame(true, TextMessage, []byte(long), true)},
+			wantOp: TextMessage,
+			want:   long,
+		},
+		{
+			name: "fragmented",
+			input: [][]byte{
+				frame(false, TextMessage, []byte("Hel"), true),
+				frame(false, continuationFrame, nil, true),
+				frame(true, continuationFrame, []byte("lo"), true),
+			},
+			wantOp: TextMessage,
+			want:   "Hello",
+		},
+		{
+			name: "ping inside fragmented message",
+			input: [][]byte{
+				frame(false, TextMessage, []byte("Hel"), true),
+				frame(true, PingMessage, []byte("p"), true),
+				frame(true, continuationFrame, []byte("lo"), true),
+			},
+			wantOp:   TextMessage,
+			want:     "Hello",
+			wantPong: "p",
+		},
+		{
+			name:   "pong is skipped",
+			input:  [][]byte{frame(true, PongMessage, nil, true), frame(true, TextMessage, []byte("a"), true)},
+			wantOp: TextMessage,
+			want:   "a",
+		},
+		{
+			name:      "unmasked client frame",
+			input:     [][]byte{frame(true, TextMessage, []byte("a"), false)},
+			wantErr:   &CloseError{Code: CloseProtocolError},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "reserved bits",
+			input:     [][]byte{append([]byte{0xc1}, frame(true, TextMessage, []byte("a"), true)[1:]...)},
+			wantErr:   &CloseError{Code: CloseProtocolError},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "unknown opcode",
+			input:     [][]byte{frame(true, 3, []byte("a"), true)},
+			wantErr:   &CloseError{Code: CloseProtocolError},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "continuation without message",
+			input:     [][]byte{frame(true, continuationFrame, []byte("a"), true)},
+			wantErr:   &CloseError{Code: CloseProtocolError},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "message inside fragmented message",
+			input:     [][]byte{frame(false, TextMessage, []byte("a"), true), frame(true, TextMessage, []byte("b"), true)},
+			wantErr:   &CloseError{Code: CloseProtocolError},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "fragmented control frame",
+			input:     [][]byte{frame(false, PingMessage, nil, true)},
+			wantErr:   &CloseError{Code: CloseProtocolError},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "control frame too long",
+			input:     [][]byte{frame(true, PingMessage, bytes.Repeat([]byte("p"), 126), true)},
+			wantErr:   &CloseError{Code: CloseProtocolError},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "invalid UTF-8 text",
+			input:     [][]byte{frame(true, TextMessage, invalidUTF8, true)},
+			wantErr:   &CloseError{Code: CloseInvalidPayload},
+			wantClose: CloseInvalidPayload,
+		},
+		{
+			name:      "frame over read limit",
+			input:     [][]byte{frame(true, TextMessage, []byte("12345"), true)},
+			readLimit: 4,
+			wantErr:   ErrMessageTooBig,
+			wantClose: CloseMessageTooBig,
+		},
+		{
+			name:      "fragments over read limit",
+			input:     [][]byte{frame(false, TextMessage, []byte("123"), true), frame(true, continuationFrame, []byte("45"), true)},
+			readLimit: 4,
+			wantErr:   ErrMessageTooBig,
+			wantClose: CloseMessageTooBig,
+		},
+		{
+			name:      "peer close",
+			input:     [][]byte{frame(true, CloseMessage, closePayload(CloseGoingAway, "bye"), true)},
+			wantErr:   &CloseError{Code: CloseGoingAway, Reason: "bye"},
+			wantClose: CloseNormal,
+		},
+		{
+			name:      "peer close without status",
+			input:     [][]byte{frame(true, CloseMessage, nil, true)},
+			wantErr:   &CloseError{Code: closeNoStatus},
+			wantClose: CloseNormal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, sent := serve(t, bytes.Join(tt.input, nil))
+			if tt.readLimit > 0 {
+				c.SetReadLimit(tt.readLimit)
+			}
+
+			op, data, err := c.ReadMessage()
+			frames := sent()
+
+			switch want := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("ReadMessage: %v", err)
+				}
+				if op != tt.wantOp || string(data) != tt.want {
+					t.Fatalf("ReadMessage = %d %q, want %d %q", op, data, tt.wantOp, tt.want)
+				}
+			case *CloseError:
+				var ce *CloseError
+				if !errors.As(err, &ce) || ce.Code != want.Code || (want.Reason != "" && ce.Reason != want.Reason) {
+					t.Fatalf("ReadMessage error %v, want %v", err, want)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Fatalf("ReadMessage error %v, want %v", err, want)
+				}
+			}
+
+			var pong string
+			closeCode := 0
+			for _, f := range frames {
+				switch f.op {
+				case PongMessage:
+					pong = string(f.payload)
+				case CloseMessage:
+					closeCode = int(binary.BigEndian.Uint16(f.payload))
+				}
+			}
+			if pong != tt.wantPong {
+				t.Fatalf("pong %q, want %q", pong, tt.wantPong)
+			}
+			if closeCode != tt.wantClose {
+				t.Fatalf("close frame with code %d, want %d", closeCode, tt.wantClose)
+			}
+		})
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		client    bool
+		op        int
+		size      int
+		wantHead  []byte // first bytes of the frame
+		wantError bool
+	}{
+		{name: "server text", op: TextMessage, size: 5, wantHead: []byte{0x81, 0x05}},
+		{name: "server empty", op: TextMessage, size: 0, wantHead: []byte{0x81, 0x00}},
+		{name: "server 125", op: BinaryMessage, size: 125, wantHead: []byte{0x82, 125}},
+		{name: "server 126", op: BinaryMessage, size: 126, wantHead: []byte{0x82, 126, 0x00, 126}},
+		{name: "server 65535", op: BinaryMessage, size: 65535, wantHead: []byte{0x82, 126, 0xff, 0xff}},
+		{name: "server 65536", op: BinaryMessage, size: 65536, wantHead: []byte{0x82, 127, 0, 0, 0, 0, 0, 1, 0, 0}},
+		{name: "client text", client: true, op: TextMessage, size: 5, wantHead: []byte{0x81, 0x85}},
+		{name: "client 126", client: true, op: BinaryMessage, size: 126, wantHead: []byte{0x82, 0x80 | 126, 0x00, 126}},
+		{name: "client 65536", client: true, op: BinaryMessage, size: 65536, wantHead: []byte{0x82, 0x80 | 127, 0, 0, 0, 0, 0, 1, 0, 0}},
+		{name: "control type", op: PingMessage, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, peer := net.Pipe()
+			c := newConn(local, nil, tt.client)
+			out := make(chan []byte)
+			go func() {
+				b, _ := io.ReadAll(peer)
+				out <- b
+			}()
+
+			payload := bytes.Repeat([]byte("a"), tt.size)
+			err := c.WriteMessage(tt.op, payload)
+			local.Close()
+			raw := <-out
+
+			if tt.wantError {
+				if err == nil {
+					t.Fatal("WriteMessage succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WriteMessage: %v", err)
+			}
+			if !bytes.HasPrefix(raw, tt.wantHead) {
+				t.Fatalf("frame starts with % x, want % x", raw[:min(len(raw), len(tt.wantHead))], tt.wantHead)
+			}
+			if tt.client && tt.size > 0 && bytes.Contains(raw, payload) {
+				t.Fatal("client frame payload is not masked")
+			}
+			frames := parseFrames(t, raw, tt.client)
+			if len(frames) != 1 || frames[0].op != tt.op || !bytes.Equal(frames[0].payload, payload) {
+				t.Fatalf("frames %v, want one %d frame with the payload", frames, tt.op)
+			}
+		})
+	}
+}
+
+func TestMaskBytes(t *testing.T) {
+	key := [4]byte{0x37, 0xfa, 0x21, 0x3d}
+	b := []byte("Hello")
+	maskBytes(key, b)
+	if want := []byte{0x7f, 0x9f, 0x4d, 0x51, 0x58}; !bytes.Equal(b, want) {
+		t.Fatalf("masked % x, want % x", b, want)
+	}
+	maskBytes(key, b)
+	if string(b) != "Hello" {
+		t.Fatalf("unmasked %q", b)
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       int
+		reason     string
+		wantReason string
+	}{
+		{name: "normal", code: CloseNormal},
+		{name: "going away with reason", code: CloseGoingAway, reason: "bye", wantReason: "bye"},
+		{name: "reason truncated", code: CloseInternalError, reason: strings.Repeat("r", 200), wantReason: strings.Repeat("r", maxControlPayloadLen-2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := net.Pipe()
+			client := newConn(a, nil, true)
+			server := newConn(b, nil, false)
+
+			done := make(chan error)
+			go func() { done <- client.CloseWith(tt.code, tt.reason) }()
+
+			_, _, err := server.ReadMessage()
+			var ce *CloseError
+			if !errors.As(err, &ce) || ce.Code != tt.code || ce.Reason != tt.wantReason {
+				t.Fatalf("server read %v, want close %d %q", err, tt.code, tt.wantReason)
+			}
+			if err := <-done; err != nil {
+				t.Fatalf("CloseWith: %v", err)
+			}
+
+			if err := client.WriteMessage(TextMessage, []byte("late")); !errors.Is(err, net.ErrClosed) {
+				t.Fatalf("write after close: %v, want net.ErrClosed", err)
+			}
+			if err := server.WriteMessage(TextMessage, []byte("late")); !errors.Is(err, net.ErrClosed) {
+				t.Fatalf("write after acknowledged close: %v, want net.ErrClosed", err)
+			}
+			if err := client.Close(); err != nil {
+				t.Fatalf("second Close: %v", err)
+			}
+		})
+	}
+}
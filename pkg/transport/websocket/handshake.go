@@ -0,0 +1,217 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// IsUpgrade reports whether req asks for a WebSocket upgrade.
+func IsUpgrade(req *http.Request) bool {
+	return headerHasToken(req.Header, "Connection", "upgrade") &&
+		headerHasToken(req.Header, "Upgrade", "websocket")
+}
+
+// OriginAllowed reports whether req may open a connection. Browsers send
+// an Origin header with cross-site requests, which must match the request
+// host or be listed in origins ("*" allows any); requests without one, such
+// as those of non-browser clients, are allowed.
+func OriginAllowed(req *http.Request, origins []string) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if slices.Contains(origins, origin) || slices.Contains(origins, "*") {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, req.Host)
+}
+
+// RequestError is a request that is not a valid opening handshake.
+type RequestError struct {
+	// Status is the HTTP status to answer with.
+	Status int
+	// Header holds the response headers telling the client what the
+	// server expects, such as the supported version.
+	Header http.Header
+	Reason string
+}
+
+func (e *RequestError) Error() string   { return "websocket: " + e.Reason }
+func (e *RequestError) StatusCode() int { return e.Status }
+
+// CheckRequest reports whether req is a valid opening handshake, returning
+// a *RequestError when it is not. The origin is not checked, see
+// OriginAllowed. Servers that do work before upgrading call it first, so
+// plain HTTP requests are refused before that work is done.
+func CheckRequest(req *http.Request) error {
+	switch {
+	case req.Method != http.MethodGet || !IsUpgrade(req):
+		return &RequestError{Status: http.StatusUpgradeRequired, Header: http.Header{"Upgrade": {"websocket"}}, Reason: "websocket upgrade required"}
+	case req.Header.Get("Sec-WebSocket-Version") != "13":
+		return &RequestError{Status: http.StatusBadRequest, Header: http.Header{"Sec-Websocket-Version": {"13"}}, Reason: "unsupported websocket version"}
+	case req.Header.Get("Sec-WebSocket-Key") == "":
+		return &RequestError{Status: http.StatusBadRequest, Reason: "missing Sec-WebSocket-Key"}
+	}
+	return nil
+}
+
+// Upgrade completes the opening handshake and takes over the connection.
+// On failure it has already answered the request with an error status.
+// Cross-origin requests are rejected with 403 unless their origin is listed
+// in origins, see OriginAllowed.
+func Upgrade(w http.ResponseWriter, req *http.Request, origins ...string) (*Conn, error) {
+	if err := CheckRequest(req); err != nil {
+		re := err.(*RequestError)
+		for k, v := range re.Header {
+			w.Header()[k] = v
+		}
+		http.Error(w, re.Reason, re.Status)
+		return nil, err
+	}
+	if !OriginAllowed(req, origins) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil, errors.New("websocket: origin not allowed")
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+
+	netConn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := netConn.Write([]byte(resp)); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return newConn(netConn, rw.Reader, false), nil
+}
+
+// Dial opens a client connection to a ws:// or wss:// URL.
+func Dial(ctx context.Context, rawURL string, header http.Header) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var netConn net.Conn
+	host := u.Host
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			host += ":80"
+		}
+		netConn, err = (&net.Dialer{}).DialContext(ctx, "tcp", host)
+	case "wss":
+		if u.Port() == "" {
+			host += ":443"
+		}
+		netConn, err = (&tls.Dialer{}).DialContext(ctx, "tcp", host)
+	default:
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keyBytes := make([]byte, 16)
+	rand.Read(keyBytes)
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Host:       u.Host,
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	if deadline, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(deadline)
+		defer netConn.SetDeadline(time.Time{})
+	}
+	if err := req.Write(netConn); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		netConn.Close()
+		return nil, &HandshakeError{Response: resp}
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		netConn.Close()
+		return nil, errors.New("websocket: invalid Sec-WebSocket-Accept")
+	}
+	return newConn(netConn, br, true), nil
+}
+
+// HandshakeError is returned by Dial when the server refuses the upgrade.
+// The response body stays readable (up to 64 KiB).
+type HandshakeError struct {
+	Response *http.Response
+}
+
+func (e *HandshakeError) Error() string {
+	return "websocket: handshake failed with status " + e.Response.Status
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func newMaskKey() [4]byte {
+	var key [4]byte
+	rand.Read(key[:])
+	return key
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for t := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		host    string
+		origins []string
+		want    bool
+	}{
+		{name: "no origin", host: "api.example", want: true},
+		{name: "same host", origin: "https://api.example", host: "api.example", want: true},
+		{name: "same host with port", origin: "http://localhost:8080", host: "localhost:8080", want: true},
+		{name: "host case", origin: "https://API.example", host: "api.example", want: true},
+		{name: "cross origin", origin: "https://evil.example", host: "api.example"},
+		{name: "other port", origin: "http://localhost:9000", host: "localhost:8080"},
+		{name: "invalid origin", origin: "://", host: "api.example"},
+		{name: "null origin", origin: "null", host: "api.example"},
+		{name: "listed", origin: "https://app.example", host: "api.example", origins: []string{"https://app.example"}, want: true},
+		{name: "not listed", origin: "https://evil.example", host: "api.example", origins: []string{"https://app.example"}},
+		{name: "wildcard", origin: "https://evil.example", host: "api.example", origins: []string{"*"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if got := OriginAllowed(req, tt.origins); got != tt.want {
+				t.Fatalf("OriginAllowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgradeRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		header map[string]string
+		want   int
+	}{
+		{
+			name:   "not an upgrade",
+			method: http.MethodGet,
+			want:   http.StatusUpgradeRequired,
+		},
+		{
+			name:   "post",
+			method: http.MethodPost,
+			header: map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ=="},
+			want:   http.StatusUpgradeRequired,
+		},
+		{
+			name:   "cross origin",
+			method: http.MethodGet,
+			header: map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ==", "Origin": "https://evil.example"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "unsupported version",
+			method: http.MethodGet,
+			header: map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8", "Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ=="},
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "missing key",
+			method: http.MethodGet,
+			header: map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13"},
+			want:   http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			if _, err := Upgrade(rec, req); err == nil {
+				t.Fatal("Upgrade succeeded")
+			}
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455, section 1.3
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("acceptKey = %q", got)
+	}
+}
+
+func TestDial(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := Upgrade(w, req, "https://app.example")
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(op, data)
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	tests := []struct {
+		name       string
+		origin     string
+		wantStatus int
+	}{
+		{name: "no origin"},
+		{name: "allowed origin", origin: "https://app.example"},
+		{name: "other origin", origin: "https://evil.example", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			conn, err := Dial(context.Background(), url, header)
+			if tt.wantStatus != 0 {
+				var he *HandshakeError
+				if !errors.As(err, &he) || he.Response.StatusCode != tt.wantStatus {
+					t.Fatalf("Dial error %v, want status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Dial: %v", err)
+			}
+			defer conn.Close()
+
+			if err := conn.WriteMessage(TextMessage, []byte("echo")); err != nil {
+				t.Fatalf("WriteMessage: %v", err)
+			}
+			op, data, err := conn.ReadMessage()
+			if err != nil || op != TextMessage || string(data) != "echo" {
+				t.Fatalf("ReadMessage = %d %q %v", op, data, err)
+			}
+		})
+	}
+}
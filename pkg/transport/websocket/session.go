@@ -0,0 +1,140 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/mirkobrombin/go-module-router/v2/pkg/core"
+)
+
+// Message is the JSON envelope exchanged on WS endpoints. Inbound
+// messages are routed by Type; replies carry the ID of the message they
+// answer.
+type Message struct {
+	Type string          `json:"type"`
+	ID   string          `json:"id,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Reply types sent by the HTTP transport.
+const (
+	// TypeOpen carries the result of the endpoint's Handle, if any.
+	TypeOpen = "open"
+	// TypeResult carries the result of a message handler.
+	TypeResult = "result"
+	// TypeError carries an RFC 9457 problem (core.Problem).
+	TypeError = "error"
+)
+
+// Endpoint is implemented by WS endpoints that accept messages. Each
+// handler declares the message type it handles with a message tag:
+//
+//	type SendChat struct {
+//		Meta core.Pattern `message:"chat.send"`
+//		Body ChatMessage  `body:"json"`
+//	}
+type Endpoint interface {
+	Messages() []core.Handler
+}
+
+// OpenHandler is implemented by WS endpoints that want to know when the
+// connection is established, e.g. to join a hub. An error closes it.
+type OpenHandler interface {
+	OnOpen(ctx context.Context, s *Session) error
+}
+
+// CloseHandler is implemented by WS endpoints that want to know when the
+// connection ends. err is nil after a normal close.
+type CloseHandler interface {
+	OnClose(ctx context.Context, s *Session, err error)
+}
+
+// Session is a server-side connection of a WS endpoint. It is safe for
+// concurrent use, so other goroutines (a hub broadcasting to a room) can
+// send to it.
+type Session struct {
+	conn     *Conn
+	endpoint any
+
+	mu     sync.Mutex
+	values map[string]any
+}
+
+// NewSession wraps a server connection. endpoint is the bound endpoint
+// instance the session belongs to.
+func NewSession(conn *Conn, endpoint any) *Session {
+	return &Session{conn: conn, endpoint: endpoint}
+}
+
+// Conn returns the underlying connection.
+func (s *Session) Conn() *Conn {
+	return s.conn
+}
+
+// Endpoint returns the endpoint instance, with the fields bound at upgrade.
+func (s *Session) Endpoint() any {
+	return s.endpoint
+}
+
+// Send sends a message of the given type; data is encoded as JSON.
+func (s *Session) Send(typ string, data any) error {
+	return s.send(typ, "", data)
+}
+
+// Reply sends a message answering the message with id.
+func (s *Session) Reply(typ, id string, data any) error {
+	return s.send(typ, id, data)
+}
+
+func (s *Session) send(typ, id string, data any) error {
+	msg := Message{Type: typ, ID: id}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		msg.Data = raw
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.conn.WriteMessage(TextMessage, b)
+}
+
+// Close closes the connection normally.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+// Set stores a value for the lifetime of the session.
+func (s *Session) Set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]any)
+	}
+	s.values[key] = value
+}
+
+// Get returns a value stored with Set.
+func (s *Session) Get(key string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[key]
+	return v, ok
+}
+
+type sessionKey struct{}
+
+// WithSession returns a context carrying s.
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// SessionFrom returns the session of a message handler's context.
+func SessionFrom(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionKey{}).(*Session)
+	return s, ok
+}